@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// splitAlbumPattern matches the numbered suffix Google adds when a large album
+// is split across several folders, e.g. "Trip to Japan (2)".
+var splitAlbumPattern = regexp.MustCompile(`^(.+?) \((\d+)\)$`)
+
+// albumName returns the logical album a folder belongs to, stripping the
+// " (n)" suffix of split album folders. "Untitled" albums are numbered the same
+// way but are distinct albums, so they keep their full name.
+func albumName(folder string) string {
+	name := filepath.Base(folder)
+	match := splitAlbumPattern.FindStringSubmatch(name)
+	if match == nil || match[1] == "Untitled" {
+		return name
+	}
+	return match[1]
+}
+
+// albumFolders lists the folders directly under root grouped by logical album,
+// so that "Album", "Album (1)" and "Album (2)" are treated as one album.
+func albumFolders(root string) (map[string][]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := make(map[string][]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		folder := filepath.Join(root, entry.Name())
+		album := albumName(folder)
+		albums[album] = append(albums[album], folder)
+	}
+	for _, folders := range albums {
+		sort.Strings(folders)
+	}
+	return albums, nil
+}
+
+// expandAlbums resolves the selected logical albums back into their folders.
+func expandAlbums(root string, selected []string) ([]string, error) {
+	albums, err := albumFolders(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []string
+	for _, album := range selected {
+		folders = append(folders, albums[album]...)
+	}
+	return folders, nil
+}
+
+// sharedAlbum is the privacy-relevant part of a shared album's metadata.
+type sharedAlbum struct {
+	Folder       string
+	Title        string
+	Access       string
+	Contributors []string
+}
+
+// readAlbum parses an album's metadata.json and reports whether the album was shared,
+// either through a link (access is set) or with other people commenting or contributing.
+func readAlbum(path string) (sharedAlbum, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return sharedAlbum{}, false, err
+	}
+	defer file.Close()
+
+	var album takeout.Album
+	if err := json.NewDecoder(file).Decode(&album); err != nil {
+		return sharedAlbum{}, false, fmt.Errorf("failed to parse: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var contributors []string
+	for _, comment := range album.SharedAlbumComments {
+		if name := comment.ContentOwnerName; name != "" && !seen[name] {
+			seen[name] = true
+			contributors = append(contributors, name)
+		}
+	}
+	sort.Strings(contributors)
+
+	shared := album.Access != "" || len(contributors) > 0
+	return sharedAlbum{
+		Folder:       filepath.Dir(path),
+		Title:        album.Title,
+		Access:       album.Access,
+		Contributors: contributors,
+	}, shared, nil
+}
+
+// processAlbum records the album's sharing state in the summary.
+func processAlbum(path string) {
+	album, shared, err := readAlbum(path)
+	if err != nil {
+		color.Red("Error reading album metadata %s: %v\n", path, err)
+		return
+	}
+	if shared {
+		stats.sharedAlbum(album)
+	}
+}
+
+// warnSharedAlbums lists the albums that were shared, as a privacy review step before
+// the migrated library is published anywhere.
+func warnSharedAlbums(albums []sharedAlbum) {
+	if len(albums) == 0 {
+		return
+	}
+	color.Yellow("⚠ %d albums were shared on Google Photos, review them before sharing the migrated library:\n", len(albums))
+	for _, album := range albums {
+		line := fmt.Sprintf("  %s", album.Title)
+		if album.Access != "" {
+			line += fmt.Sprintf(" (link access: %s)", album.Access)
+		}
+		if len(album.Contributors) > 0 {
+			line += fmt.Sprintf(", shared with %s", strings.Join(album.Contributors, ", "))
+		}
+		color.Yellow("%s\n", line)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// auditPath is set by -report to write every sidecar and media file of the run, with its
+// outcome, for auditing large runs afterwards.
+var auditPath string
+
+// outcomeNoSidecar marks media found in the folders that no sidecar resolved to. It is only
+// used in the audit report, since the other outcomes count sidecars.
+const outcomeNoSidecar outcome = "No sidecar"
+
+// auditEntry is a single file of the audit report. Media without a sidecar have no Sidecar.
+// Width, Height and Duration, in seconds, are read from the media's headers when it could
+// be read; Duration is only set for videos.
+type auditEntry struct {
+	Sidecar  string  `json:"sidecar,omitempty"`
+	Media    string  `json:"media,omitempty"`
+	Outcome  outcome `json:"outcome"`
+	Detail   string  `json:"detail,omitempty"`
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// audit is the report written by -report with a .json extension. Paths are relative to
+// Root and slash-separated.
+type audit struct {
+	RunID   string        `json:"runId"`
+	Root    string        `json:"root"`
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed"`
+	Files   []auditEntry  `json:"files"`
+}
+
+// auditEntries returns an entry for every sidecar, sorted by sidecar, followed by the
+// media without one. The caller must hold s.mu.
+func (s *summary) auditEntries(root string) []auditEntry {
+	sidecars := make([]string, 0, len(s.files))
+	for path := range s.files {
+		sidecars = append(sidecars, path)
+	}
+	sort.Strings(sidecars)
+
+	entries := make([]auditEntry, 0, len(sidecars)+len(s.found))
+	for _, path := range sidecars {
+		entry := auditEntry{Sidecar: relativeTo(root, path), Outcome: s.files[path], Detail: s.details[path]}
+		if media, ok := s.media[path]; ok {
+			entry.Media = relativeTo(root, media)
+		}
+		if size, ok := s.sizes[path]; ok {
+			entry.Width, entry.Height, entry.Duration = size.Width, size.Height, size.Duration.Seconds()
+		}
+		if c, ok := s.conflicts[path]; ok && entry.Detail == "" {
+			entry.Detail = fmt.Sprintf("timestamp %s and formatted time %s disagree, used %s",
+				c.Timestamp.UTC().Format(time.RFC3339), c.Formatted.UTC().Format(time.RFC3339), c.used().UTC().Format(time.RFC3339))
+		}
+		if taken, ok := s.future[path]; ok && entry.Detail == "" {
+			entry.Detail = fmt.Sprintf("taken %s, in the future, handled with -future %s", taken.UTC().Format(time.RFC3339), futurePolicy)
+		}
+		entries = append(entries, entry)
+	}
+	for _, media := range s.orphans() {
+		entries = append(entries, auditEntry{Media: relativeTo(root, media), Outcome: outcomeNoSidecar})
+	}
+	return entries
+}
+
+// writeAudit writes the audit report to path, as CSV for paths ending in .csv and as JSON
+// otherwise.
+func (s *summary) writeAudit(path, root string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.auditEntries(root)
+	err := takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		if strings.ToLower(filepath.Ext(path)) != ".csv" {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(audit{RunID: runID, Root: root, Started: s.started, Elapsed: time.Since(s.started), Files: entries})
+		}
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"run", "sidecar", "media", "outcome", "detail", "width", "height", "duration"}); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			record := []string{runID, entry.Sidecar, entry.Media, string(entry.Outcome), entry.Detail, "", "", ""}
+			if entry.Width > 0 {
+				record[5], record[6] = strconv.Itoa(entry.Width), strconv.Itoa(entry.Height)
+			}
+			if entry.Duration > 0 {
+				record[7] = strconv.FormatFloat(entry.Duration, 'f', 3, 64)
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
+
+// printSummary prints the outcome counts of the run, the media no sidecar resolved to and
+// how long the run took. Like the rest of the output it goes to stderr when the archive is
+// written to stdout.
+func (s *summary) printSummary(elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintln(color.Output, "Summary:")
+	for _, o := range outcomes {
+		if n := s.counts[o]; n > 0 || o == outcomeUpdated {
+			c := color.New(color.Reset)
+			if failed(o) {
+				c = color.New(color.FgRed)
+			} else if o == outcomeUpdated {
+				c = color.New(color.FgGreen)
+			}
+			c.Printf("  %-26s %d\n", o, n)
+		}
+	}
+	if len(s.future) > 0 {
+		color.Yellow("  %-26s %d\n", "Future dates", len(s.future))
+	}
+	if len(s.conflicts) > 0 {
+		color.Yellow("  %-26s %d\n", "Timestamp conflicts", len(s.conflicts))
+	}
+	if orphans := len(s.orphans()); orphans > 0 {
+		color.Yellow("  %-26s %d\n", "Media without a sidecar", orphans)
+	}
+	if empty := len(s.empty); empty > 0 {
+		color.Yellow("  %-26s %d\n", "Empty folders", empty)
+	}
+	fmt.Fprintf(color.Output, "  %-26s %s\n", "Run ID", runID)
+	fmt.Fprintf(color.Output, "  %-26s %s\n", "Elapsed", elapsed.Round(time.Second))
+}
+
+// emptyFolderLimit is the number of empty folders listed after the summary; -summary-out
+// lists all of them.
+const emptyFolderLimit = 10
+
+// warnEmptyFolders lists the folders that held nothing to process, relative to root.
+func (s *summary) warnEmptyFolders(root string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	empty := s.emptyFolders()
+	if len(empty) == 0 {
+		return
+	}
+	color.Yellow("⚠ %d folders held no sidecars or media:\n", len(empty))
+	for _, folder := range empty[:min(len(empty), emptyFolderLimit)] {
+		color.Yellow("  %s\n", relativeTo(root, folder))
+	}
+	if len(empty) > emptyFolderLimit {
+		color.Yellow("  and %d more\n", len(empty)-emptyFolderLimit)
+	}
+}
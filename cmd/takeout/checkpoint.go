@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/fatih/color"
+)
+
+// checkpointName is the file in the root folder that lists the sidecars an unfinished run already handled.
+const checkpointName = "takeout-checkpoint.txt"
+
+// checkpoint is an append-only list of handled sidecars and their outcomes, so a run that
+// crashed, was cancelled or was stopped by its time budget can continue where it left off
+// with -resume. Each line is written as soon as its sidecar is handled, as the outcome, the
+// sidecar and its media separated by tabs; lines of older checkpoints hold only the
+// sidecar. Every run appending to it first writes its run ID. It is safe for concurrent use.
+type checkpoint struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	done map[string]handledSidecar
+}
+
+// handledSidecar is what the checkpoint holds about a handled sidecar.
+type handledSidecar struct {
+	outcome outcome
+	media   string
+}
+
+// openCheckpoint opens the checkpoint in root. With resume the sidecars it already lists
+// are loaded to be skipped; otherwise any previous checkpoint is started over.
+func openCheckpoint(root string, resume bool) (*checkpoint, error) {
+	path := filepath.Join(root, checkpointName)
+	done := make(map[string]handledSidecar)
+
+	if resume {
+		file, err := os.Open(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				// Lines starting with # name the runs that wrote the checkpoint.
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				// A later line for the same sidecar, such as a retry, replaces the earlier one.
+				o, rest, ok := strings.Cut(line, "\t")
+				if !ok {
+					done[line] = handledSidecar{}
+					continue
+				}
+				sidecar, media, _ := strings.Cut(rest, "\t")
+				done[sidecar] = handledSidecar{outcome: outcome(o), media: media}
+			}
+			file.Close()
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+			}
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(file, "# run %s\n", runID); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &checkpoint{path: path, file: file, done: done}, nil
+}
+
+// handled reports whether the sidecar was already handled by the run being resumed, and
+// how; checkpoints of older versions leave the outcome and media empty. Sidecars that
+// failed are handled again.
+func (c *checkpoint) handled(sidecar string) (handledSidecar, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.done[sidecar]
+	return h, ok && !failed(h.outcome)
+}
+
+// resumed returns the number of sidecars the runs being resumed completed.
+func (c *checkpoint) resumed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, h := range c.done {
+		if !failed(h.outcome) {
+			n++
+		}
+	}
+	return n
+}
+
+// record appends the sidecar, its outcome and media to the checkpoint once it has been handled.
+func (c *checkpoint) record(sidecar string, h handledSidecar) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done[sidecar] = h
+	fmt.Fprintf(c.file, "%s\t%s\t%s\n", h.outcome, sidecar, h.media)
+}
+
+// close closes the checkpoint. A run that finished removes it, a stopped run keeps it for -resume.
+func (c *checkpoint) close(finished bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	if finished {
+		return os.Remove(c.path)
+	}
+	return nil
+}
+
+// resumeSidecar counts a sidecar the run being resumed handled as if this run did, so the
+// summary covers the whole job and its media isn't reported as having no sidecar.
+func resumeSidecar(jsonPath string, h handledSidecar) {
+	if h.outcome != "" {
+		stats.record(jsonPath, h.outcome)
+	}
+	if h.media == "" {
+		return
+	}
+	stats.claimMedia(jsonPath, h.media)
+	if withEdited {
+		for _, variant := range editedVariants(h.media) {
+			stats.claimMedia("", variant)
+		}
+	}
+	if h.outcome == outcomeUpdated {
+		placeResumed(jsonPath, h.media)
+	}
+}
+
+// offerResume reports whether to resume an unfinished run whose checkpoint is in root,
+// asking in a terminal. Otherwise the checkpoint is started over, with a warning.
+func offerResume(root string) bool {
+	if !fileExists(filepath.Join(root, checkpointName)) {
+		return false
+	}
+	if !terminal || noUI {
+		color.Yellow("An earlier run didn't finish; starting over, pass -resume to continue it instead\n")
+		return false
+	}
+	var resume bool
+	err := runField(huh.NewConfirm().
+		Title("An earlier run didn't finish. Continue where it stopped?").
+		Affirmative("Resume").
+		Negative("Start over").
+		Value(&resume),
+	)
+	if err != nil {
+		os.Exit(0)
+	}
+	return resume
+}
+
+// nextClock returns the next time the local wall clock reads clock ("15:04") after now.
+func nextClock(clock string, now time.Time) (time.Time, error) {
+	at, err := time.ParseInLocation("15:04", clock, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a time like 23:00: %w", err)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// budgetContext returns a context that is cancelled when the run's time budget runs out:
+// after maxDuration, or at the next pauseAt wall-clock time, whichever comes first.
+func budgetContext(maxDuration time.Duration, pauseAt string) (context.Context, context.CancelFunc, error) {
+	now := time.Now()
+	var deadline time.Time
+	if maxDuration > 0 {
+		deadline = now.Add(maxDuration)
+	}
+	if pauseAt != "" {
+		at, err := nextClock(pauseAt, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if deadline.IsZero() || at.Before(deadline) {
+			deadline = at
+		}
+	}
+	if deadline.IsZero() {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// withCompanions is set by -companions, on by default, to give the video of a motion photo
+// or Live Photo the photo's times and location when Google exported it as a file of its own
+// next to the photo without a sidecar, such as IMG_1234.MP next to IMG_1234.jpg or
+// IMG_1234.MOV next to IMG_1234.HEIC.
+var withCompanions = true
+
+// companionVideos returns the motion videos paired with the photo at imagePath in its
+// folder that have no sidecar of their own. jsonPath is the photo's sidecar, next to which
+// a video's own sidecar would be.
+func companionVideos(jsonPath, imagePath string) []string {
+	if kindOf(imagePath) != kindPhoto {
+		return nil
+	}
+	return takeout.CompanionVideos(filepath.Dir(jsonPath), imagePath)
+}
+
+// processCompanions gives the motion videos paired with the photo at imagePath the times
+// the photo got, in the same way the run treated the photo: reported for -dry-run, added to
+// the archive for -output-tar, changed in place otherwise. -exif writes the dates into their
+// movie headers and -gps the location into an XMP sidecar. Failures are reported without
+// failing the sidecar.
+func processCompanions(jsonPath, imagePath string, meta *takeout.Takeout, takenTime time.Time) {
+	if !withCompanions || skipVideos {
+		return
+	}
+	for _, video := range companionVideos(jsonPath, imagePath) {
+		stats.claimMedia("", video)
+		switch {
+		case dryRun:
+			tracef(jsonPath, "dry run: would set times of motion video %s to %s", video, takenTime.Format(time.RFC3339))
+			color.Cyan("Would set the times of motion video %s to %s\n", video, takenTime.Format(time.RFC3339))
+			placeLater(jsonPath, video, meta, takenTime)
+		case archive != nil:
+			err := archive.addMedia(video, meta, takenTime)
+			tracef(jsonPath, "added motion video %s to the archive: %v", video, result(err))
+			if err != nil {
+				color.Red("Error adding %s to the archive: %v\n", video, err)
+				continue
+			}
+			color.Green("✓ Added motion video %s to the archive with times %s\n", video, takenTime.Format(time.RFC3339))
+		default:
+			if err := updateCompanion(jsonPath, video, meta, takenTime); err != nil {
+				color.Red("Error updating motion video %s: %v\n", video, err)
+				continue
+			}
+			color.Green("✓ Updated file times of motion video %s to %s\n", video, takenTime.Format(time.RFC3339))
+			placeLater(jsonPath, video, meta, takenTime)
+		}
+	}
+}
+
+// updateCompanion writes the taken time and location into the motion video at path and
+// sets its times.
+func updateCompanion(jsonPath, path string, meta *takeout.Takeout, takenTime time.Time) error {
+	if writeExif {
+		edit := takeout.MediaEdit{Meta: meta, Taken: exifLocalTime(meta, takenTime), Dates: true}
+		_, err := takeout.HandlerFor(path).Edit(path, edit)
+		tracef(jsonPath, "set movie header dates of motion video %s: %v", path, result(err))
+		if err != nil && !errors.Is(err, takeout.ErrUnsupported) {
+			return err
+		}
+	}
+	if packet := xmpFor(meta, takenTime, false); packet != "" {
+		xmp, err := takeout.WriteXMP(path, packet)
+		tracef(jsonPath, "wrote %s: %v", xmp, result(err))
+		if err != nil && !errors.Is(err, takeout.ErrXMPExists) {
+			return err
+		}
+	}
+	if err := os.Chtimes(path, takenTime, takenTime); err != nil {
+		return err
+	}
+	if vol := volumeOf(path); vol.creationSupported() {
+		if err := timestamps.SetCreated(path, takenTime); err != nil && !vol.creationUnsupported(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// trustFormatted is set by -trust formatted to use the formatted photoTakenTime of a
+// sidecar, rather than its Unix timestamp, when the two disagree.
+var trustFormatted bool
+
+// setTrust sets the -trust policy.
+func setTrust(value string) error {
+	switch value {
+	case "timestamp":
+		trustFormatted = false
+	case "formatted":
+		trustFormatted = true
+	default:
+		return fmt.Errorf("expected timestamp or formatted, got %q", value)
+	}
+	return nil
+}
+
+// timeConflict is a sidecar whose photoTakenTime timestamp and formatted time disagree.
+type timeConflict struct {
+	Timestamp time.Time `json:"timestamp"`
+	Formatted time.Time `json:"formatted"`
+}
+
+// used returns the time the -trust policy picked.
+func (c timeConflict) used() time.Time {
+	if trustFormatted {
+		return c.Formatted
+	}
+	return c.Timestamp
+}
+
+// checkTakenTime compares the parsed timestamp of the sidecar's photoTakenTime with its
+// formatted time, which occasionally disagree. Conflicts are warned about and recorded for
+// the summary, and resolved by the -trust policy. Formatted times that can't be parsed,
+// such as ones in other languages, are not checked.
+func checkTakenTime(jsonPath string, meta *takeout.Takeout, takenTime time.Time) time.Time {
+	formatted, err := meta.PhotoTakenTime.FormattedTime()
+	if err != nil {
+		tracef(jsonPath, "formatted time not checked: %v", err)
+		return takenTime
+	}
+	if formatted.Equal(takenTime) {
+		return takenTime
+	}
+	conflict := timeConflict{Timestamp: takenTime, Formatted: formatted}
+	stats.conflict(jsonPath, conflict)
+	source := "timestamp"
+	if trustFormatted {
+		source = "formatted time"
+	}
+	color.Yellow("photoTakenTime of %s is %s but formatted as %q, using the %s\n", jsonPath,
+		takenTime.UTC().Format(time.RFC3339), meta.PhotoTakenTime.Formatted, source)
+	return conflict.used()
+}
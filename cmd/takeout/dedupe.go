@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// dedupe is set by -dedupe to set the times of only the first copy of identical media, as
+// multi-part exports and album folders hold the same photo several times. With "skip" the
+// other copies are left alone; with "link" they are replaced by hard links to the first and
+// with "move" they are moved into the duplicates folder at the end of the run.
+var dedupe string
+
+// setDedupe parses -dedupe.
+func setDedupe(value string) error {
+	switch value {
+	case "skip", "link", "move":
+		dedupe = value
+		return nil
+	}
+	return errors.New("expected skip, link or move")
+}
+
+// duplicatesFolder is the folder below the export -dedupe move moves duplicates into,
+// keeping their paths, with a manifest of what they duplicate.
+const duplicatesFolder = "duplicates"
+
+// duplicateManifest lists the media moved into the duplicates folder and their originals.
+const duplicateManifest = "manifest.csv"
+
+// duplicate is media whose content is the same as media an earlier sidecar named.
+type duplicate struct {
+	media, sidecar, original string
+	key                      contentKey
+}
+
+// contentIndex pairs media files by their size and SHA-256. It is safe for concurrent use.
+type contentIndex struct {
+	mu         sync.Mutex
+	first      map[contentKey]string // the first media with the content
+	keys       map[string]contentKey // media already hashed
+	duplicates []duplicate
+}
+
+// contents is the content index of the current run.
+var contents = &contentIndex{first: make(map[contentKey]string), keys: make(map[string]contentKey)}
+
+// claim hashes the media of a sidecar and returns the earlier media with the same
+// content, or an empty string if it is the first. Another sidecar naming the same media
+// doesn't make it a duplicate of itself.
+func (c *contentIndex) claim(jsonPath, media string, size int64) (string, error) {
+	c.mu.Lock()
+	key, ok := c.keys[media]
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		if key, err = hashFile(media, size); err != nil {
+			return "", err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys[media] = key
+	original, ok := c.first[key]
+	if !ok || original == media {
+		c.first[key] = media
+		return "", nil
+	}
+	c.duplicates = append(c.duplicates, duplicate{media: media, sidecar: jsonPath, original: original, key: key})
+	return original, nil
+}
+
+// resolveDuplicates links or moves the duplicates found during the run, as -dedupe asks.
+// It runs after every sidecar was handled, so the originals have their final content and
+// times before they are linked to. Duplicates it fails to resolve, or to list in the
+// manifest, fail their sidecar.
+func resolveDuplicates(root string) {
+	if dedupe != "link" && dedupe != "move" {
+		return
+	}
+	contents.mu.Lock()
+	duplicates := contents.duplicates
+	contents.mu.Unlock()
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].media < duplicates[j].media })
+
+	var moved []duplicate
+	for _, d := range duplicates {
+		if runCtx.Err() != nil {
+			return
+		}
+		var err error
+		switch {
+		case dryRun && dedupe == "link":
+			color.Cyan("Would replace %s with a link to %s\n", d.media, d.original)
+			continue
+		case dryRun:
+			color.Cyan("Would move %s into %s\n", d.media, filepath.Join(root, duplicatesFolder))
+			continue
+		case dedupe == "link":
+			err = linkDuplicate(d)
+		default:
+			err = moveDuplicate(root, d)
+		}
+		if err != nil {
+			color.Red("Error resolving duplicate %s: %v\n", d.media, err)
+			stats.fail(d.sidecar, writeFailure(err), "Resolving duplicate", err)
+			continue
+		}
+		if dedupe == "link" {
+			color.Green("✓ Replaced %s with a link to %s\n", d.media, d.original)
+		} else {
+			color.Green("✓ Moved duplicate %s into %s\n", d.media, duplicatesFolder)
+			moved = append(moved, d)
+		}
+	}
+	if len(moved) > 0 {
+		if err := appendManifest(root, moved); err != nil {
+			color.Red("Error writing the duplicates manifest: %v\n", err)
+			for _, d := range moved {
+				stats.fail(d.sidecar, writeFailure(err), "Writing duplicates manifest", err)
+			}
+		}
+	}
+}
+
+// linkDuplicate replaces the duplicate with a hard link to its original, through a link
+// next to it that is renamed over it, so it is never missing.
+func linkDuplicate(d duplicate) error {
+	original, err := os.Stat(d.original)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(d.media); err == nil && os.SameFile(info, original) {
+		return nil
+	}
+	link := d.media + ".link" + takeout.TempSuffix
+	os.Remove(link)
+	if err := os.Link(d.original, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, d.media); err != nil {
+		os.Remove(link)
+		return err
+	}
+	return nil
+}
+
+// moveDuplicate moves the duplicate and its sidecar into the duplicates folder, at the
+// same path below it as below root, so later runs don't report the sidecar's media missing.
+func moveDuplicate(root string, d duplicate) error {
+	target := filepath.Join(root, duplicatesFolder, relativeTo(root, d.media))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := keepOutOfRuns(filepath.Join(root, duplicatesFolder)); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+	if err := os.Rename(d.media, target); err != nil {
+		return err
+	}
+	takeout.RemoveMediaName(filepath.Dir(d.media), filepath.Base(d.media))
+	takeout.AddMediaName(filepath.Dir(target), filepath.Base(target))
+	return os.Rename(d.sidecar, filepath.Join(filepath.Dir(target), filepath.Base(d.sidecar)))
+}
+
+// keepOutOfRuns writes a .takeoutignore excluding everything in dir, unless it has one.
+func keepOutOfRuns(dir string) error {
+	path := filepath.Join(dir, ignoreName)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return os.WriteFile(path, []byte("# Written by takeout -dedupe move\n*\n"), 0o644)
+}
+
+// appendManifest adds the moved duplicates to the manifest in the duplicates folder,
+// starting it with a header if it is new. Paths are relative to root.
+func appendManifest(root string, moved []duplicate) error {
+	path := filepath.Join(root, duplicatesFolder, duplicateManifest)
+	_, err := os.Stat(path)
+	exists := err == nil
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	if !exists {
+		writer.Write([]string{"run", "duplicate", "original", "sidecar", "sha256"})
+	}
+	for _, d := range moved {
+		writer.Write([]string{runID, relativeTo(root, d.media), relativeTo(root, d.original), relativeTo(root, d.sidecar), hex.EncodeToString(d.key.hash[:])})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
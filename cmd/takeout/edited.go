@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// withEdited is set by -edited to also give the edited copies Google exports next to a
+// photo, which share its sidecar, the photo's taken time.
+var withEdited bool
+
+// editedSuffixes are the suffixes edited copies are matched by: takeout.EditedSuffixes and
+// those added with -edited-suffixes.
+var editedSuffixes = slices.Clone(takeout.EditedSuffixes)
+
+// defaultEditedSuffixesPath returns the file of extra suffixes used when -edited-suffixes
+// isn't given.
+func defaultEditedSuffixesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "takeout", "edited.txt"), nil
+}
+
+// loadEditedSuffixes adds the suffixes in the file at path, one per line, to editedSuffixes.
+// Blank lines and lines starting with # are ignored. A missing file is only an error if
+// required is set.
+func loadEditedSuffixes(path string, required bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	known := make(map[string]bool)
+	for _, suffix := range editedSuffixes {
+		known[takeout.LooseName(suffix)] = true
+	}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		suffix := strings.TrimSpace(scanner.Text())
+		if suffix == "" || strings.HasPrefix(suffix, "#") {
+			continue
+		}
+		if strings.ContainsAny(suffix, `/\.`) {
+			return fmt.Errorf("%s:%d: a suffix can't hold a slash or dot", path, line)
+		}
+		if key := takeout.LooseName(suffix); !known[key] {
+			known[key] = true
+			editedSuffixes = append(editedSuffixes, suffix)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// editedVariants returns the edited copies of the media at imagePath in its folder,
+// e.g. "IMG_1234-edited.jpg" for "IMG_1234.jpg".
+func editedVariants(imagePath string) []string {
+	return takeout.EditedVariants(imagePath, editedSuffixes)
+}
+
+// processEdited gives the edited copies of the media at imagePath the times the media got,
+// in the same way the run treated the media: reported for -dry-run, added to the archive for
+// -output-tar, changed in place otherwise. Their EXIF data is left alone in place, since
+// editors often rewrite it. Failures are reported without failing the sidecar.
+func processEdited(jsonPath, imagePath string, meta *takeout.Takeout, takenTime time.Time) {
+	if !withEdited {
+		return
+	}
+	for _, variant := range editedVariants(imagePath) {
+		stats.claimMedia("", variant)
+		switch {
+		case dryRun:
+			tracef(jsonPath, "dry run: would set times of edited copy %s to %s", variant, takenTime.Format(time.RFC3339))
+			color.Cyan("Would set the times of edited copy %s to %s\n", variant, takenTime.Format(time.RFC3339))
+			placeLater(jsonPath, variant, meta, takenTime)
+		case archive != nil:
+			err := archive.addMedia(variant, meta, takenTime)
+			tracef(jsonPath, "added edited copy %s to the archive: %v", variant, result(err))
+			if err != nil {
+				color.Red("Error adding %s to the archive: %v\n", variant, err)
+				continue
+			}
+			color.Green("✓ Added edited copy %s to the archive with times %s\n", variant, takenTime.Format(time.RFC3339))
+		default:
+			err := os.Chtimes(variant, takenTime, takenTime)
+			tracef(jsonPath, "set times of edited copy %s: %v", variant, result(err))
+			if err != nil {
+				color.Red("Error updating file times for %s: %v\n", variant, err)
+				continue
+			}
+			if vol := volumeOf(variant); vol.creationSupported() {
+				if err := timestamps.SetCreated(variant, takenTime); err != nil && !vol.creationUnsupported(err) {
+					color.Red("Error updating creation time for %s: %v\n", variant, err)
+					continue
+				}
+			}
+			color.Green("✓ Updated file times of edited copy %s to %s\n", variant, takenTime.Format(time.RFC3339))
+			placeLater(jsonPath, variant, meta, takenTime)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// isElevated reports whether the process runs as root.
+func isElevated() bool {
+	return os.Geteuid() == 0
+}
+
+// relaunchElevated runs the current executable again with the same arguments through sudo,
+// in the same terminal, and waits for it to finish.
+func relaunchElevated() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	args := []string{exe}
+	for _, arg := range os.Args[1:] {
+		// Don't pass -elevate on, so a declined prompt can't loop.
+		if name := strings.TrimLeft(strings.SplitN(arg, "=", 2)[0], "-"); name == "elevate" {
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	cmd := exec.Command("sudo", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("elevated run exited with status %d", exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to relaunch with sudo: %w", err)
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given ID is still running.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// isElevated reports whether the process runs with an elevated administrator token.
+func isElevated() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
+
+// relaunchElevated starts the current executable again with the same arguments through
+// the UAC "runas" verb. The elevated copy runs in its own console window.
+func relaunchElevated() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	args := make([]string, 0, len(os.Args)-1)
+	for _, arg := range os.Args[1:] {
+		// Don't pass -elevate on, so a declined prompt can't loop.
+		if name := strings.TrimLeft(strings.SplitN(arg, "=", 2)[0], "-"); name == "elevate" {
+			continue
+		}
+		args = append(args, syscall.EscapeArg(arg))
+	}
+
+	verb, _ := windows.UTF16PtrFromString("runas")
+	file, _ := windows.UTF16PtrFromString(exe)
+	params, _ := windows.UTF16PtrFromString(strings.Join(args, " "))
+	dir, _ := windows.UTF16PtrFromString(cwd)
+	if err := windows.ShellExecute(0, verb, file, params, dir, windows.SW_NORMAL); err != nil {
+		return fmt.Errorf("failed to relaunch %s as administrator: %w", filepath.Base(exe), err)
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given ID is still running.
+func processAlive(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	const stillActive = 259
+	return code == stillActive
+}
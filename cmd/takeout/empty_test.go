@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the tool itself when the test binary is started by runTakeout.
+func TestMain(m *testing.M) {
+	if os.Getenv("TAKEOUT_TEST_MAIN") == "1" {
+		os.Args = append([]string{"takeout"}, strings.Fields(os.Getenv("TAKEOUT_TEST_ARGS"))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTakeout runs the tool with args, away from the user's config, and returns its output
+// and exit status.
+func runTakeout(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(),
+		"TAKEOUT_TEST_MAIN=1",
+		"TAKEOUT_TEST_ARGS="+strings.Join(args, " "),
+		"HOME="+home,
+		"XDG_CONFIG_HOME="+filepath.Join(home, "config"),
+		"XDG_CACHE_HOME="+filepath.Join(home, "cache"),
+		"APPDATA="+filepath.Join(home, "config"),
+		"LOCALAPPDATA="+filepath.Join(home, "cache"),
+	)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("running takeout: %v", err)
+	}
+	return string(out), 0
+}
+
+// writeFiles creates the files below root, with the given contents.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const sidecar = `{"title":"a.jpg","photoTakenTime":{"timestamp":"1500000000"}}`
+
+// jpeg is the smallest file that passes for a JPEG: its start and end markers.
+const jpeg = "\xff\xd8\xff\xd9"
+
+func TestEmptySelectionExitsNothingDone(t *testing.T) {
+	root := t.TempDir()
+	out, code := runTakeout(t, "-dir", root, "-select-all", "-force")
+	if code != exitNothingDone {
+		t.Fatalf("exit status %d, want %d; output:\n%s", code, exitNothingDone, out)
+	}
+	if !strings.Contains(out, "holds no folders to process") {
+		t.Errorf("output doesn't mention the empty selection:\n%s", out)
+	}
+}
+
+func TestEmptyFolderIsReported(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"Album/a.jpg":      jpeg,
+		"Album/a.jpg.json": sidecar,
+	})
+	if err := os.Mkdir(filepath.Join(root, "Empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(t.TempDir(), "summary.json")
+
+	out, code := runTakeout(t, "-dir", root, "-select-all", "-force", "-summary-out", reportPath)
+	if code != 0 {
+		t.Fatalf("exit status %d, want 0; output:\n%s", code, out)
+	}
+	if !strings.Contains(out, "Empty folders") {
+		t.Errorf("summary doesn't count the empty folder:\n%s", out)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.EmptyFolders, []string{"Empty"}) {
+		t.Errorf("report lists empty folders %q, want [Empty]", report.EmptyFolders)
+	}
+	if len(report.Files) != 1 || report.Counts[outcomeUpdated] != 1 {
+		t.Errorf("report has files %v and counts %v, want only Album/a.jpg.json updated", report.Files, report.Counts)
+	}
+	for path := range report.Files {
+		if strings.HasPrefix(path, "Empty") {
+			t.Errorf("empty folder counted as processed: %s", path)
+		}
+	}
+}
+
+func TestNoSidecarsExitsNothingDone(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"Album/a.jpg": jpeg})
+
+	out, code := runTakeout(t, "-dir", root, "-select-all", "-force")
+	if code != exitNothingDone {
+		t.Fatalf("exit status %d, want %d; output:\n%s", code, exitNothingDone, out)
+	}
+	if !strings.Contains(out, "No sidecars were found") {
+		t.Errorf("output doesn't say nothing was done:\n%s", out)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envName returns the environment variable that sets the flag name,
+// e.g. "TAKEOUT_MAX_DURATION" for -max-duration with the "TAKEOUT_" prefix.
+func envName(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setFlagsFromEnv sets every flag whose environment variable is present, so the tool can be
+// configured inside a container without a wrapper script. It runs before the command line
+// is parsed so that flags given explicitly still win.
+func setFlagsFromEnv(flags *flag.FlagSet, prefix string) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(prefix, f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", envName(prefix, f.Name), setErr)
+		}
+	})
+	return err
+}
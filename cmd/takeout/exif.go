@@ -0,0 +1,35 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// writeExif is set by -exif to also write the taken time into the EXIF block of JPEG, TIFF
+// and HEIC files and the movie headers of MP4 and MOV videos, so it survives copies that
+// don't keep file times.
+var writeExif bool
+
+// requestedEdit returns the metadata -exif, -gps, -iptc and -captions ask to embed into the
+// item's media, or false if they ask for none.
+func requestedEdit(meta *takeout.Takeout, takenTime time.Time) (takeout.MediaEdit, bool) {
+	_, hasLocation := meta.Location()
+	description, names := captionsOf(meta)
+	edit := takeout.MediaEdit{
+		Meta:     meta,
+		Taken:    exifLocalTime(meta, takenTime),
+		Dates:    writeExif,
+		IPTC:     writeIPTC,
+		Location: writeGPS && hasLocation,
+		Captions: description != "" || len(names) > 0,
+	}
+	return edit, edit.Dates || edit.IPTC || edit.Location || edit.Captions
+}
+
+// exifLocalTime returns the taken time in the zone EXIF dates are read in: the zone set
+// with -tz, this machine's by default, or with -tz auto the nautical zone of the item's
+// location when known.
+func exifLocalTime(meta *takeout.Takeout, takenTime time.Time) time.Time {
+	return takenTime.In(takenLocation(meta))
+}
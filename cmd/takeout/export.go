@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// exportRoot is the folder the run was started on. Media missing next to its sidecar
+// is looked up across every part below it before it is reported as never exported.
+var exportRoot string
+
+// exported indexes the media file names found anywhere below exportRoot. It is built
+// the first time a sidecar's media is missing, so complete exports never pay for the walk.
+var exported = struct {
+	once  sync.Once
+	names map[string]bool
+}{}
+
+// exportedElsewhere reports whether media with the name of imagePath exists anywhere in
+// the export, for instance in the split album folder of another Takeout part. Without an
+// export root every missing file is assumed to exist elsewhere.
+func exportedElsewhere(imagePath string) bool {
+	if exportRoot == "" {
+		return true
+	}
+	exported.once.Do(func() {
+		exported.names = make(map[string]bool)
+		_ = filepath.WalkDir(exportRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(strings.ToLower(path), ".json") {
+				return nil
+			}
+			exported.names[strings.ToLower(d.Name())] = true
+			return nil
+		})
+	})
+	return exported.names[strings.ToLower(filepath.Base(imagePath))]
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// sourceArchives are the Takeout archives given with -from-archives, extracted into -dir
+// before their sidecars are processed.
+var sourceArchives []string
+
+// addSourceArchives expands the -from-archives pattern, e.g. "takeout-*.zip".
+func addSourceArchives(pattern string) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no archives match %s", pattern)
+	}
+	for _, path := range paths {
+		if archiveFormat(path) == "" {
+			return fmt.Errorf("%s is not a .zip, .tgz, .tar.gz or .tar archive", path)
+		}
+	}
+	sort.Strings(paths)
+	sourceArchives = append(sourceArchives, paths...)
+	return nil
+}
+
+// archiveFormat returns "zip", "tgz" or "tar" for the archive at path, or an empty string
+// if the name has no known archive extension.
+func archiveFormat(path string) string {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tgz"), strings.HasSuffix(name, ".tar.gz"):
+		return "tgz"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	}
+	return ""
+}
+
+// archiveExtraction tallies what extractArchives did.
+type archiveExtraction struct {
+	sidecars  []string
+	extracted int
+	existing  int
+}
+
+// extractArchives extracts the archives into root in a single read of each, keeping the
+// paths they hold, and returns the sidecars found. The sidecars are only processed once
+// every archive is extracted, since Google splits an album across parts and a sidecar
+// may be in another part than its media. Files already extracted by an earlier run, of
+// the same size, are left alone.
+func extractArchives(archives []string, root string) (archiveExtraction, error) {
+	var result archiveExtraction
+	for _, archive := range archives {
+		if runCtx.Err() != nil {
+			break
+		}
+		err := readArchive(archive, func(name string, size int64, modified time.Time, perm fs.FileMode, r io.Reader) error {
+			target, isSidecar, err := extractEntry(root, name, size, perm, r)
+			switch {
+			case errors.Is(err, fs.ErrExist):
+				result.existing++
+			case err != nil:
+				return err
+			default:
+				result.extracted++
+				// Until their sidecars are processed, media keep the times recorded in the archive.
+				if err := os.Chtimes(target, modified, modified); err != nil {
+					return err
+				}
+			}
+			if isSidecar {
+				result.sidecars = append(result.sidecars, target)
+			} else if filepath.Base(target) == "metadata.json" {
+				processAlbum(target)
+			} else if kindOf(target) != kindOther {
+				stats.sawMedia(target)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", archive, err)
+		}
+		color.Green("✓ Extracted %s\n", archive)
+	}
+	return result, nil
+}
+
+// readArchive calls extract for every regular file in the archive at path, in the order
+// they are stored.
+func readArchive(path string, extract func(name string, size int64, modified time.Time, perm fs.FileMode, r io.Reader) error) error {
+	if archiveFormat(path) == "zip" {
+		reader, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		for _, file := range reader.File {
+			if runCtx.Err() != nil {
+				return nil
+			}
+			if !file.Mode().IsRegular() {
+				continue
+			}
+			r, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = extract(file.Name, int64(file.UncompressedSize64), file.Modified, file.Mode().Perm(), r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var stream io.Reader = file
+	if archiveFormat(path) == "tgz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stream = gz
+	}
+	reader := tar.NewReader(stream)
+	for runCtx.Err() == nil {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extract(header.Name, header.Size, header.ModTime, header.FileInfo().Mode().Perm(), reader); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractEntry writes the archive entry name below root through a temporary file, with the
+// permissions it was stored with, or 0644 if it has none. It returns fs.ErrExist if a file
+// of the same size is already there. Names that would leave root are refused.
+func extractEntry(root, name string, size int64, perm fs.FileMode, r io.Reader) (target string, isSidecar bool, err error) {
+	name = path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", false, fmt.Errorf("entry %s would be extracted outside %s", name, root)
+	}
+	target = filepath.Join(root, filepath.FromSlash(name))
+	isSidecar = strings.HasSuffix(strings.ToLower(name), ".json") && path.Base(name) != "metadata.json"
+
+	if info, err := os.Stat(target); err == nil && info.Size() == size {
+		return target, isSidecar, fs.ErrExist
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", false, err
+	}
+	file, err := takeout.CreateTemp(target)
+	if err != nil {
+		return "", false, err
+	}
+	if perm == 0 {
+		perm = 0o644
+	}
+	if err := file.Chmod(perm); err != nil {
+		takeout.DiscardTemp(file)
+		return "", false, err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		takeout.DiscardTemp(file)
+		return "", false, err
+	}
+	return target, isSidecar, takeout.CommitTemp(file, target)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrokenArchiveStopsRun(t *testing.T) {
+	root := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "takeout-001.zip")
+	if err := os.WriteFile(archive, []byte("PK\x03\x04broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, code := runTakeout(t, "-dir", root, "-select-all", "-force", "-from-archives", archive)
+	if code == 0 {
+		t.Errorf("exit status 0 for a broken archive; output:\n%s", out)
+	}
+	if !strings.Contains(out, "extracting archives") {
+		t.Errorf("output doesn't report the failed extraction:\n%s", out)
+	}
+	if strings.Contains(out, "Extracted") {
+		t.Errorf("output reports the broken archive as extracted:\n%s", out)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// dateBound is a date set by -after or -before. A year, month or day is taken in the zone
+// the item's local dates are written in, so the bounds match the dates its EXIF will show;
+// a full timestamp is an instant.
+type dateBound struct {
+	set     bool
+	instant time.Time
+	civil   time.Time // the date, in UTC, when no instant was given
+}
+
+// takenAfter and takenBefore, set by -after and -before, keep the items taken outside
+// their range out of the run. The range includes the start of -after and ends where
+// -before starts, so -after 2019 -before 2022 keeps 2019 through 2021.
+var takenAfter, takenBefore dateBound
+
+// dateLayouts are the forms of the dates -after and -before take, civil ones first.
+var dateLayouts = []string{"2006", "2006-01", time.DateOnly}
+
+// parseDateBound parses a date for -after or -before.
+func parseDateBound(value string) (dateBound, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return dateBound{set: true, civil: t}, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return dateBound{set: true, instant: t}, nil
+	}
+	return dateBound{}, errors.New("expected a year, month or day like 2019, 2019-06 or 2019-06-15, or a time like 2019-06-15T12:00:00Z")
+}
+
+// setTakenAfter parses -after.
+func setTakenAfter(value string) (err error) {
+	takenAfter, err = parseDateBound(value)
+	return err
+}
+
+// setTakenBefore parses -before.
+func setTakenBefore(value string) (err error) {
+	takenBefore, err = parseDateBound(value)
+	return err
+}
+
+// at returns the bound as an instant for an item whose local dates are in loc.
+func (b dateBound) at(loc *time.Location) time.Time {
+	if !b.instant.IsZero() {
+		return b.instant
+	}
+	return time.Date(b.civil.Year(), b.civil.Month(), b.civil.Day(), 0, 0, 0, 0, loc)
+}
+
+// mediaTypes are the lowercase extensions -types keeps, without their dot; empty keeps all.
+var mediaTypes = make(map[string]bool)
+
+// setMediaTypes parses -types, a comma-separated list of extensions like jpg,png,heic.
+func setMediaTypes(value string) error {
+	for _, ext := range strings.Split(value, ",") {
+		ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		if ext == "" || strings.ContainsAny(ext, `/\.`) {
+			return fmt.Errorf("expected extensions like jpg,png,heic, got %q", value)
+		}
+		mediaTypes[ext] = true
+	}
+	return nil
+}
+
+// filteredOut returns why -after, -before or -types keep the item out of the run, or an
+// empty string if they don't.
+func filteredOut(meta *takeout.Takeout, imagePath string, takenTime time.Time) string {
+	if len(mediaTypes) > 0 {
+		if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(imagePath)), "."); !mediaTypes[ext] {
+			return "not one of -types"
+		}
+	}
+	loc := takenLocation(meta)
+	if takenAfter.set && takenTime.Before(takenAfter.at(loc)) {
+		return "taken before -after"
+	}
+	if takenBefore.set && !takenTime.Before(takenBefore.at(loc)) {
+		return "taken after -before"
+	}
+	return ""
+}
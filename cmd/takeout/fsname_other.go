@@ -0,0 +1,13 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+// fileSystemName can't detect filesystems on this platform.
+func fileSystemName(root string) (string, bool) {
+	return "unknown", false
+}
+
+// accessTimeUpdates can't detect how access times are kept on this platform.
+func accessTimeUpdates(root, fileSystem string) string {
+	return ""
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// futurePolicy is what -future does with items whose taken time is still to come, from
+// cameras with a wrong clock or corrupt sidecars: "skip" leaves them alone, "clamp" gives
+// them the time of the run instead and "apply" stamps the future time anyway.
+var futurePolicy = "skip"
+
+// setFuture sets the -future policy.
+func setFuture(value string) error {
+	switch value {
+	case "skip", "clamp", "apply":
+		futurePolicy = value
+	default:
+		return fmt.Errorf("expected skip, clamp or apply, got %q", value)
+	}
+	return nil
+}
+
+// futureTime resolves a taken time later than now by the -future policy, returning the
+// time to use or false to leave the item alone.
+func futureTime(takenTime, now time.Time) (time.Time, bool) {
+	switch {
+	case !takenTime.After(now):
+		return takenTime, true
+	case futurePolicy == "clamp":
+		return now.Truncate(time.Second), true
+	case futurePolicy == "apply":
+		return takenTime, true
+	}
+	return time.Time{}, false
+}
+
+// checkFutureTime warns about a sidecar whose taken time is in the future and records it
+// for the summary, then resolves it by the -future policy. Skipped items get their outcome.
+func checkFutureTime(jsonPath string, takenTime time.Time) (time.Time, bool) {
+	now := time.Now()
+	if !takenTime.After(now) {
+		return takenTime, true
+	}
+	stats.futureDate(jsonPath, takenTime)
+	resolved, ok := futureTime(takenTime, now)
+	switch {
+	case !ok:
+		color.Yellow("%s is dated %s, in the future; skipping it, see -future\n", jsonPath, takenTime.UTC().Format(time.RFC3339))
+		stats.record(jsonPath, outcomeFuture)
+	case futurePolicy == "clamp":
+		color.Yellow("%s is dated %s, in the future; using the current time instead\n", jsonPath, takenTime.UTC().Format(time.RFC3339))
+	default:
+		color.Yellow("%s is dated %s, in the future; applying it anyway\n", jsonPath, takenTime.UTC().Format(time.RFC3339))
+	}
+	return resolved, ok
+}
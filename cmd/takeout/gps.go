@@ -0,0 +1,7 @@
+package main
+
+import ()
+
+// writeGPS is set by -gps to write the sidecar's location into the media, so it survives
+// re-importing into other photo managers.
+var writeGPS bool
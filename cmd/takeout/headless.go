@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// terminal reports whether stdin is an interactive terminal the huh forms can read from.
+var terminal = isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+
+// noUI is set by -yes or -no-ui for runs over SSH or from a scheduled task: the folder is
+// taken from -dir, every album is processed and no dialog or form is ever shown.
+var noUI bool
+
+// headlessMissing lists the flags a run without a terminal or display needs in place of
+// the prompts it can't show, such as in a container. A nil result means the run can go ahead.
+func headlessMissing(startDir string, selectAll, stdin bool) []string {
+	if stdin || noUI {
+		return nil
+	}
+
+	var missing []string
+	if startDir == "." && !canPickRoot() {
+		missing = append(missing, "-dir: the folder picker can't be shown")
+	}
+	if !selectAll && !terminal {
+		missing = append(missing, "-select-all: there is no terminal to choose folders in")
+	}
+	return missing
+}
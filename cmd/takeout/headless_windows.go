@@ -0,0 +1,37 @@
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                       = windows.NewLazySystemDLL("user32.dll")
+	procGetProcessWindowStation  = user32.NewProc("GetProcessWindowStation")
+	procGetUserObjectInformation = user32.NewProc("GetUserObjectInformationW")
+)
+
+// hasDisplay reports whether the process runs on a visible window station, so that dialogs
+// can be shown. Services, scheduled tasks without a logged on user and containers don't.
+func hasDisplay() bool {
+	const (
+		uoiFlags   = 1
+		wsfVisible = 0x0001
+	)
+
+	station, _, _ := procGetProcessWindowStation.Call()
+	if station == 0 {
+		return false
+	}
+
+	// USEROBJECTFLAGS
+	var flags struct {
+		Inherit  int32
+		Reserved int32
+		Flags    uint32
+	}
+	var needed uint32
+	ok, _, _ := procGetUserObjectInformation.Call(station, uoiFlags, uintptr(unsafe.Pointer(&flags)), unsafe.Sizeof(flags), uintptr(unsafe.Pointer(&needed)))
+	return ok != 0 && flags.Flags&wsfVisible != 0
+}
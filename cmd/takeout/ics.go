@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// icsPath is set by -ics to export the photo activity of the run as a calendar.
+var icsPath string
+
+// day is the photo activity of a single calendar day for the -ics export.
+type day struct {
+	count  int
+	albums map[string]bool
+	geo    takeout.GeoData
+	hasGeo bool
+}
+
+// activity collects the photo activity per day for the -ics export. It is safe for concurrent use.
+var activity = struct {
+	mu   sync.Mutex
+	days map[string]*day
+}{days: make(map[string]*day)}
+
+// recordActivity counts the item on the day it was taken, in the zone its EXIF dates are
+// written in, so travel photos land on the day they were taken there.
+func recordActivity(meta *takeout.Takeout, imagePath string, takenTime time.Time) {
+	g, hasGeo := meta.Location()
+	date := exifLocalTime(meta, takenTime).Format("20060102")
+
+	activity.mu.Lock()
+	defer activity.mu.Unlock()
+	d, ok := activity.days[date]
+	if !ok {
+		d = &day{albums: make(map[string]bool)}
+		activity.days[date] = d
+	}
+	d.count++
+	d.albums[albumName(filepath.Dir(imagePath))] = true
+	if hasGeo && !d.hasGeo {
+		d.geo, d.hasGeo = g, true
+	}
+}
+
+// writeICS writes an iCalendar file with one all-day event per day with photos,
+// summarizing the number of items, their albums and the first location of the day.
+func writeICS(path string) error {
+	activity.mu.Lock()
+	defer activity.mu.Unlock()
+
+	dates := make([]string, 0, len(activity.days))
+	for date := range activity.days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//takeout//Google Takeout photo activity//EN\r\n")
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, date := range dates {
+		d := activity.days[date]
+		start, _ := time.Parse("20060102", date)
+
+		albums := make([]string, 0, len(d.albums))
+		for album := range d.albums {
+			albums = append(albums, album)
+		}
+		sort.Strings(albums)
+
+		noun := "photos"
+		if d.count == 1 {
+			noun = "photo"
+		}
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:%s-photos@takeout\r\n", date)
+		fmt.Fprintf(&b, "DTSTAMP:%s\r\n", stamp)
+		fmt.Fprintf(&b, "DTSTART;VALUE=DATE:%s\r\n", date)
+		fmt.Fprintf(&b, "DTEND;VALUE=DATE:%s\r\n", start.AddDate(0, 0, 1).Format("20060102"))
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", icsText(fmt.Sprintf("%d %s", d.count, noun)))
+		fmt.Fprintf(&b, "DESCRIPTION:%s\r\n", icsText("Albums: "+strings.Join(albums, ", ")))
+		if d.hasGeo {
+			fmt.Fprintf(&b, "GEO:%.6f;%.6f\r\n", d.geo.Latitude, d.geo.Longitude)
+		}
+		b.WriteString("TRANSP:TRANSPARENT\r\nEND:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+
+	err := takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write calendar %s: %w", path, err)
+	}
+	return nil
+}
+
+// icsText escapes text for an iCalendar property value.
+func icsText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ellypaws/takeout"
+)
+
+// ignoreName is the gitignore-style file that excludes paths below its folder from processing.
+const ignoreName = ".takeoutignore"
+
+// ignoreRule is a single pattern line of a .takeoutignore file.
+type ignoreRule struct {
+	base    string // folder holding the .takeoutignore
+	pattern *regexp.Regexp
+	negate  bool // "!pattern" re-includes what an earlier rule ignored
+	dirOnly bool // "pattern/" only matches folders
+	path    bool // the pattern contains a slash, so it matches the path below base rather than the name
+}
+
+// ignoreList is the rules of every .takeoutignore from the walk's starting folder
+// down to the current one, outermost first. A nil list ignores nothing.
+type ignoreList struct {
+	rules []ignoreRule
+}
+
+// load returns the list extended with the .takeoutignore in dir, or l itself if dir has none.
+func (l *ignoreList) load(dir string) *ignoreList {
+	file, err := os.Open(filepath.Join(dir, ignoreName))
+	if err != nil {
+		return l
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	if l != nil {
+		rules = append(rules, l.rules...)
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.path = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		r.pattern = globRegexp(line)
+		rules = append(rules, r)
+	}
+	return &ignoreList{rules: rules}
+}
+
+// ignoresAbove loads the .takeoutignore files from root down to the parent of dir,
+// so a walk starting at dir honours the files above it.
+func ignoresAbove(root, dir string) *ignoreList {
+	rel, err := filepath.Rel(root, filepath.Dir(dir))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	var list *ignoreList
+	list = list.load(root)
+	current := root
+	if rel != "." {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			current = filepath.Join(current, part)
+			list = list.load(current)
+		}
+	}
+	return list
+}
+
+// ignored reports whether path is excluded. The last matching rule wins, as in gitignore.
+func (l *ignoreList) ignored(path string, isDir bool) bool {
+	if l == nil {
+		return false
+	}
+	ignored := false
+	for _, r := range l.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		subject := filepath.Base(path)
+		if r.path {
+			rel, err := filepath.Rel(r.base, path)
+			if err != nil {
+				continue
+			}
+			subject = filepath.ToSlash(rel)
+		}
+		if r.pattern.MatchString(subject) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// ignoredSidecar reports whether a sidecar is excluded, either itself or through the media
+// its name points at, so that a pattern like "*.mov" also leaves "clip.mov.json" and
+// "clip.mov.supplemental-metadata.json" alone.
+func (l *ignoreList) ignoredSidecar(path string) bool {
+	media, ok := takeout.SidecarMedia(filepath.Base(path))
+	return l.ignored(path, false) || (ok && l.ignored(filepath.Join(filepath.Dir(path), media), false))
+}
+
+// globRegexp translates a gitignore glob into an anchored, case-insensitive regexp.
+// "**" matches across folders, "*" and "?" stay within one.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(glob[i:], ']'); end > 0 {
+				class := glob[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+				i += end
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		// A malformed character class; match the line literally instead.
+		return regexp.MustCompile("(?i)^" + regexp.QuoteMeta(glob) + "$")
+	}
+	return re
+}
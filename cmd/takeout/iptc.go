@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ellypaws/takeout"
+)
+
+// writeIPTC is set by -iptc to also write the taken time into the IPTC DateCreated and
+// TimeCreated of JPEG and TIFF files, for asset managers that read nothing else.
+var writeIPTC bool
+
+// writeCaptions is set by -captions to write the sidecar's description as the caption and
+// the names of the people in it as keywords, into the IPTC record of JPEG and TIFF files
+// and, with -xmp, into the XMP sidecar.
+var writeCaptions bool
+
+// captionsOf returns the description and the names of the people -captions writes for the
+// item, both empty without -captions.
+func captionsOf(meta *takeout.Takeout) (description string, names []string) {
+	if !writeCaptions {
+		return "", nil
+	}
+	return strings.TrimSpace(meta.Description), meta.PeopleNames()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errFoundSidecar stops the sidecar search at the first match.
+var errFoundSidecar = errors.New("found sidecar")
+
+// processedSigns returns the reasons root doesn't look like a raw Takeout: none of the
+// folders contain a sidecar, or root holds the after snapshot or summary of an earlier run.
+// An empty result means the tree looks untouched.
+func processedSigns(root string, folders []string) []string {
+	var signs []string
+	// With -sidecar-root the sidecars are in the mirrored tree, not the media folders.
+	sidecars := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		sidecars = append(sidecars, sidecarFolder(root, folder))
+	}
+	if !hasSidecars(sidecars) {
+		signs = append(signs, "no .json sidecars were found in the selected folders")
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return signs
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(root, entry.Name())
+		name := strings.ToLower(entry.Name())
+		switch {
+		case strings.HasSuffix(name, ".after.json"):
+			if snapshot, err := readSnapshot(path); err == nil && strings.EqualFold(snapshot.Root, root) {
+				signs = append(signs, fmt.Sprintf("%s is the snapshot of a finished run", entry.Name()))
+			}
+		case strings.HasSuffix(name, ".json"):
+			if report, err := readReport(path); err == nil && strings.EqualFold(report.Root, root) {
+				signs = append(signs, fmt.Sprintf("%s is the summary of an earlier run", entry.Name()))
+			}
+		case strings.HasSuffix(name, ".md"), strings.HasSuffix(name, ".html"), strings.HasSuffix(name, ".htm"):
+			if isSummary(path) {
+				signs = append(signs, fmt.Sprintf("%s is the summary of an earlier run", entry.Name()))
+			}
+		}
+	}
+	return signs
+}
+
+// hasSidecars reports whether any of the folders contain a media sidecar.
+func hasSidecars(folders []string) bool {
+	for _, folder := range folders {
+		err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ".json") && d.Name() != "metadata.json" {
+				return errFoundSidecar
+			}
+			return nil
+		})
+		if errors.Is(err, errFoundSidecar) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSummary reports whether the file at path was written by -summary-out.
+func isSummary(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return strings.Contains(string(head[:n]), "Google Takeout migration summary")
+}
@@ -0,0 +1,1292 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/huh/spinner"
+	"github.com/dustin/go-humanize"
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// since indexes the snapshot given with -since. Media it records as unchanged is skipped.
+var since *inventory
+
+// skipPhotos and skipVideos are set by -skip-photos and -skip-videos to leave those kinds of media untouched.
+var skipPhotos, skipVideos bool
+
+// excludeStates holds the item states given with -exclude-state, e.g. "archived" or "locked".
+var excludeStates = make(map[string]bool)
+
+// labels are the key:value provenance labels given with -label, e.g. "account:alice".
+// They are carried into snapshots and the run summary.
+var labels []string
+
+// readTakeout reads and parses the metadata JSON file, rejecting unknown fields with -strict.
+func readTakeout(jsonPath string) (*takeout.Takeout, error) {
+	return takeout.Read(jsonPath, strict)
+}
+
+// processJSON reads the metadata JSON file, extracts the photoTakenTime,
+// and updates the corresponding image file's modification, access, and creation times.
+func processJSON(jsonPath string) {
+	meta, err := readTakeout(jsonPath)
+	tracef(jsonPath, "read sidecar: %v", result(err))
+	if err != nil {
+		color.Red("Error reading JSON file %s: %v\n", jsonPath, err)
+		stats.fail(jsonPath, outcomeUnreadable, "Reading JSON file", err)
+		unexpected(jsonPath, err)
+		return
+	}
+
+	imagePath, how := resolveMedia(jsonPath, meta)
+	if how != "" {
+		tracef(jsonPath, "media %s resolved from title %q, %s", imagePath, meta.Title, how)
+	} else {
+		tracef(jsonPath, "media %s resolved from title %q", imagePath, meta.Title)
+	}
+	if hint := meta.PathHint(); hint != "" {
+		stats.pathHint(imagePath, hint)
+	}
+	if mappingOut != "" {
+		recordMapping(jsonPath, imagePath)
+	}
+	processMedia(jsonPath, imagePath, meta)
+}
+
+// takenTimeOf returns the time to give the media at imagePath from its parsed sidecar,
+// following the rules, or false if the sidecar's time is invalid or the media is to be left
+// alone, in which case its outcome is recorded.
+func takenTimeOf(jsonPath, imagePath string, meta *takeout.Takeout) (time.Time, bool) {
+	takenTime, err := meta.PhotoTakenTime.Time()
+	if err != nil {
+		color.Red("Error parsing timestamp in %s: %v\n", jsonPath, err)
+		stats.fail(jsonPath, outcomeUnreadable, "Parsing timestamp", err)
+		unexpected(jsonPath, err)
+		return time.Time{}, false
+	}
+	tracef(jsonPath, "photoTakenTime %s (%q) is %s, %s local", meta.PhotoTakenTime.Timestamp, meta.PhotoTakenTime.Formatted,
+		takenTime.UTC().Format(time.RFC3339), takenTime.Format(time.RFC3339))
+	takenTime = checkTakenTime(jsonPath, meta, takenTime)
+	if g, ok := meta.Location(); ok {
+		tracef(jsonPath, "taken at %.5f, %.5f", g.Latitude, g.Longitude)
+	}
+	tracef(jsonPath, "local dates will read %s", exifLocalTime(meta, takenTime).Format(time.RFC3339))
+
+	// The first matching rule from the rules file can skip the item or pick another sidecar time.
+	if r := matchRule(meta, imagePath, takenTime); r != nil {
+		tracef(jsonPath, "rule on line %d matched: %s", r.line, r.source)
+		if r.skip {
+			stats.record(jsonPath, outcomeRuled)
+			return time.Time{}, false
+		}
+		if r.timeSource != "" {
+			takenTime, err = r.sourceTime(meta)
+			if err != nil {
+				color.Red("Error parsing %s time in %s: %v\n", r.timeSource, jsonPath, err)
+				stats.fail(jsonPath, outcomeUnreadable, "Parsing timestamp", err)
+				unexpected(jsonPath, err)
+				return time.Time{}, false
+			}
+			tracef(jsonPath, "using the %s time %s instead", r.timeSource, takenTime.Format(time.RFC3339))
+		}
+	}
+
+	// Items dated in the future are skipped, clamped or stamped as -future says.
+	takenTime, ok := checkFutureTime(jsonPath, takenTime)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// Keep items in excluded states, such as the Locked Folder, out of the run.
+	for _, state := range meta.States() {
+		if excludeStates[state] {
+			tracef(jsonPath, "excluded: item is %s", state)
+			stats.record(jsonPath, outcomeExcluded)
+			return time.Time{}, false
+		}
+	}
+
+	// Leave out the items outside the dates and types of -after, -before and -types.
+	if reason := filteredOut(meta, imagePath, takenTime); reason != "" {
+		tracef(jsonPath, "skipped: %s", reason)
+		stats.record(jsonPath, outcomeFiltered)
+		return time.Time{}, false
+	}
+
+	// Leave out the kinds of media excluded with -skip-photos and -skip-videos, and the
+	// unknown types -unknown-types doesn't want touched.
+	switch kind := kindOf(imagePath); {
+	case kind == kindPhoto && skipPhotos:
+		tracef(jsonPath, "skipped: photo with -skip-photos")
+		stats.record(jsonPath, outcomePhotos)
+		return time.Time{}, false
+	case kind == kindVideo && skipVideos:
+		tracef(jsonPath, "skipped: video with -skip-videos")
+		stats.record(jsonPath, outcomeVideos)
+		return time.Time{}, false
+	case kind == kindOther && unknownPolicyOf(imagePath) == unknownSkip:
+		tracef(jsonPath, "skipped: unknown media type with -unknown-types")
+		stats.record(jsonPath, outcomeUnknownType)
+		return time.Time{}, false
+	case kind == kindOther && unknownPolicyOf(imagePath) == unknownReport:
+		err := fmt.Errorf("%s is not a known media type", strings.ToLower(filepath.Ext(imagePath)))
+		tracef(jsonPath, "skipped: %v", err)
+		color.Yellow("Not updating %s: %v\n", imagePath, err)
+		stats.fail(jsonPath, outcomeUnsupported, "Checking media type", err)
+		return time.Time{}, false
+	}
+	return takenTime, true
+}
+
+// processMedia updates the times of the media file at imagePath from its parsed sidecar.
+func processMedia(jsonPath, imagePath string, meta *takeout.Takeout) {
+	stats.claimMedia(jsonPath, imagePath)
+	takenTime, ok := takenTimeOf(jsonPath, imagePath, meta)
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(imagePath)
+	if os.IsNotExist(err) && recoverRenamed {
+		if renamed, copies := renamedMedia(jsonPath, imagePath, takenTime); renamed != "" {
+			tracef(jsonPath, "media renamed to %s: unnamed by any sidecar, EXIF date matches, %d identical copies", renamed, copies)
+			color.Yellow("Recovered renamed media %s for %s\n", renamed, jsonPath)
+			imagePath = renamed
+			stats.claimMedia(jsonPath, imagePath)
+			info, err = os.Stat(imagePath)
+		}
+	}
+	if os.IsNotExist(err) {
+		if !exportedElsewhere(imagePath) {
+			color.Red("Image file %s was never exported: no part of the export holds it, re-request the export to get it\n", imagePath)
+			stats.record(jsonPath, outcomeNeverExported)
+			unexpected(jsonPath, fmt.Errorf("media %s was never exported", imagePath))
+			return
+		}
+		color.Red("Image file %s does not exist for metadata %s\n", imagePath, jsonPath)
+		stats.record(jsonPath, outcomeMissing)
+		unexpected(jsonPath, fmt.Errorf("media %s does not exist", imagePath))
+		return
+	}
+	if err == nil {
+		tracef(jsonPath, "media is %d bytes, modified %s, %s", info.Size(), info.ModTime().Format(time.RFC3339), capability(imagePath))
+		stats.format(imagePath)
+	}
+
+	// Leave media alone that hasn't changed since the previous run.
+	if since != nil && err == nil && since.unchanged(imagePath, info) {
+		tracef(jsonPath, "skipped: unchanged since the -since snapshot")
+		stats.record(jsonPath, outcomeUnchanged)
+		return
+	}
+
+	// Don't stamp dates onto failed or partial downloads.
+	if err := takeout.CheckMedia(imagePath); err != nil {
+		tracef(jsonPath, "skipped: %v", err)
+		color.Yellow("Skipping broken media %s: %v\n", imagePath, err)
+		stats.fail(jsonPath, outcomeBroken, "Broken media", err)
+		unexpected(jsonPath, err)
+		return
+	}
+	if auditPath != "" {
+		size, err := takeout.Probe(imagePath)
+		tracef(jsonPath, "media is %dx%d, %s long: %v", size.Width, size.Height, size.Duration, result(err))
+		stats.measured(jsonPath, size)
+	}
+
+	// With -dedupe only the first copy of identical media gets the times.
+	if dedupe != "" && info != nil {
+		original, err := contents.claim(jsonPath, imagePath, info.Size())
+		if err != nil {
+			color.Red("Error hashing %s: %v\n", imagePath, err)
+			stats.fail(jsonPath, writeFailure(err), "Hashing media", err)
+			unexpected(jsonPath, err)
+			return
+		}
+		if original != "" {
+			tracef(jsonPath, "skipped: same content as %s", original)
+			color.Yellow("Skipping %s, a duplicate of %s\n", imagePath, original)
+			stats.duplicate(jsonPath, relativeTo(exportRoot, original))
+			return
+		}
+	}
+
+	// With -dry-run only report what would change.
+	if dryRun {
+		var from time.Time
+		if info != nil {
+			from = info.ModTime()
+		}
+		tracef(jsonPath, "dry run: would set times to %s", takenTime.Format(time.RFC3339))
+		if from.IsZero() {
+			color.Cyan("Would set the times of %s to %s\n", imagePath, takenTime.Format(time.RFC3339))
+		} else {
+			color.Cyan("Would set the times of %s from %s to %s\n", imagePath, from.Format(time.RFC3339), takenTime.Format(time.RFC3339))
+		}
+		stats.plan(jsonPath, from, takenTime)
+		placeLater(jsonPath, imagePath, meta, takenTime)
+		processEdited(jsonPath, imagePath, meta, takenTime)
+		processCompanions(jsonPath, imagePath, meta, takenTime)
+		if icsPath != "" {
+			recordActivity(meta, imagePath, takenTime)
+		}
+		return
+	}
+
+	// With -output-tar the corrected media goes into the archive and the originals stay as they are.
+	if archive != nil {
+		err := archive.addMedia(imagePath, meta, takenTime)
+		tracef(jsonPath, "added to the archive: %v", result(err))
+		if err != nil {
+			color.Red("Error adding %s to the archive: %v\n", imagePath, err)
+			stats.fail(jsonPath, outcomeFailed, "Writing archive", err)
+			unexpected(jsonPath, err)
+			return
+		}
+		color.Green("✓ Added %s to the archive with times %s\n", imagePath, takenTime.Format(time.RFC3339))
+		stats.updated(jsonPath, takenTime)
+		processEdited(jsonPath, imagePath, meta, takenTime)
+		processCompanions(jsonPath, imagePath, meta, takenTime)
+		if icsPath != "" {
+			recordActivity(meta, imagePath, takenTime)
+		}
+		return
+	}
+
+	// Write the taken time and location into the EXIF and IPTC metadata first, since rewriting the file resets its times.
+	// Media of unknown types only gets its file times.
+	// The handler registered for the format writes it, reporting whether the file now holds
+	// all of it; MP4 style files only take the dates, so their location still needs a sidecar.
+	embedded := false
+	if edit, ok := requestedEdit(meta, takenTime); ok && !unknownType(imagePath) {
+		complete, err := takeout.HandlerFor(imagePath).Edit(imagePath, edit)
+		tracef(jsonPath, "set embedded metadata: %v", result(err))
+		switch {
+		case errors.Is(err, takeout.ErrUnsupported):
+		case err != nil:
+			color.Red("Error writing metadata to %s: %v\n", imagePath, err)
+			stats.fail(jsonPath, writeFailure(err), "Writing EXIF", err)
+			unexpected(jsonPath, err)
+			return
+		default:
+			embedded = complete
+		}
+	}
+	if packet := xmpFor(meta, takenTime, embedded); packet != "" && !unknownType(imagePath) {
+		xmp, err := takeout.WriteXMP(imagePath, packet)
+		tracef(jsonPath, "wrote %s: %v", xmp, result(err))
+		if err != nil && !errors.Is(err, takeout.ErrXMPExists) {
+			color.Red("Error writing %s: %v\n", xmp, err)
+			stats.fail(jsonPath, writeFailure(err), "Writing XMP", err)
+			unexpected(jsonPath, err)
+			return
+		}
+	}
+
+	// Update modification and access times.
+	err = os.Chtimes(imagePath, takenTime, takenTime)
+	tracef(jsonPath, "set modified and accessed times: %v", result(err))
+	if err != nil {
+		color.Red("Error updating file times for %s: %v\n", imagePath, err)
+		stats.fail(jsonPath, writeFailure(err), "Updating file times", err)
+		unexpected(jsonPath, err)
+		return
+	}
+
+	// Update creation time where the platform can, unless the volume turned out not to support it.
+	vol := volumeOf(imagePath)
+	if vol.creationSupported() {
+		err = timestamps.SetCreated(imagePath, takenTime)
+		tracef(jsonPath, "set creation time on %s (%s): %v", vol.Root, vol.FileSystem, result(err))
+		if err != nil && !vol.creationUnsupported(err) {
+			color.Red("Error updating creation time for %s: %v\n", imagePath, err)
+			stats.fail(jsonPath, writeFailure(err), "Updating creation time", err)
+			unexpected(jsonPath, err)
+			return
+		}
+	} else {
+		tracef(jsonPath, "skipped creation time: %s (%s) doesn't support it", vol.Root, vol.FileSystem)
+	}
+
+	color.Green("✓ Updated file times of %s to %s\n", imagePath, takenTime.Format(time.RFC3339))
+	stats.updated(jsonPath, takenTime)
+	placeLater(jsonPath, imagePath, meta, takenTime)
+	processEdited(jsonPath, imagePath, meta, takenTime)
+	processCompanions(jsonPath, imagePath, meta, takenTime)
+	if icsPath != "" {
+		recordActivity(meta, imagePath, takenTime)
+	}
+
+	if extractMotion && kindOf(imagePath) == kindPhoto {
+		video, err := extractMotionVideo(imagePath, takenTime)
+		switch {
+		case errors.Is(err, takeout.ErrNoMotion), errors.Is(err, errMotionExists):
+		case err != nil:
+			color.Red("Error extracting motion video from %s: %v\n", imagePath, err)
+		default:
+			tracef(jsonPath, "extracted motion video to %s", video)
+			color.Green("✓ Extracted motion video %s\n", video)
+		}
+	}
+}
+
+// dryRun is set by -dry-run to only report the times each file would get.
+var dryRun bool
+
+// streamBatch is the number of directory entries read at a time in -stream mode.
+const streamBatch = 1024
+
+// stream is set by -stream to process directory entries as they are listed instead of
+// reading and sorting the whole directory first, bounding memory on 50k+ file folders.
+var stream bool
+
+// runCtx is cancelled when the time budget set by -max-duration or -pause-at runs out,
+// or when a -strict run hits an unexpected condition. No new sidecars are started after that.
+var runCtx = context.Background()
+
+// stopRun cancels runCtx with a cause. -strict calls it with the first unexpected condition.
+var stopRun context.CancelCauseFunc = func(error) {}
+
+// strict is set by -strict to abort the run on the first schema surprise, unmatched
+// sidecar or write failure.
+var strict bool
+
+// unexpected aborts a -strict run because of err while handling jsonPath.
+// Sidecars already in progress finish, but no new ones are started.
+func unexpected(jsonPath string, err error) {
+	if strict {
+		stopRun(fmt.Errorf("%s: %w", jsonPath, err))
+	}
+}
+
+// progress is the checkpoint of the run, nil for dry runs and runs over SFTP.
+var progress *checkpoint
+
+// handleSidecar processes a sidecar unless the time budget ran out or the run being
+// resumed already handled it, and records it in the checkpoint afterwards.
+func handleSidecar(jsonPath string) {
+	if runCtx.Err() != nil {
+		return
+	}
+	if progress != nil {
+		if h, ok := progress.handled(jsonPath); ok {
+			tracef(jsonPath, "skipped: already handled by the run being resumed")
+			resumeSidecar(jsonPath, h)
+			stats.finished()
+			return
+		}
+	}
+	started := time.Now()
+	processJSON(jsonPath)
+	stats.timed(jsonPath, time.Since(started))
+	stats.finished()
+	if progress != nil {
+		progress.record(jsonPath, stats.handled(jsonPath))
+	}
+}
+
+// workers is the number of sidecars processed at the same time, set by -workers unless
+// it is auto.
+var workers = runtime.NumCPU()
+
+// processSidecars processes the sidecars below the folders, followed by the listed
+// sidecars, with a pool of workers. The folders are walked one at a time, feeding the
+// workers as sidecars are found, so the number of open directories and files stays bounded.
+func processSidecars(root string, folders, sidecars []string) {
+	queue := make(chan string, workers)
+	wait := startWorkers(queue, handleSidecar)
+
+	for _, folder := range folders {
+		// With -sidecar-root the sidecars, and the .takeoutignore files, are in the mirrored tree.
+		dir := sidecarFolder(root, folder)
+		ignores := ignoresAbove(cmp.Or(sidecarRoot, root), dir)
+		if ignores.ignored(dir, true) {
+			continue
+		}
+		processDir(dir, ignores, queue)
+		if sidecarRoot != "" {
+			sawMediaIn(root, folder, ignores)
+		}
+	}
+	for _, sidecar := range sidecars {
+		if runCtx.Err() != nil {
+			break
+		}
+		queue <- sidecar
+	}
+	close(queue)
+	wait()
+}
+
+// processDir walks through the directory specified by dirPath, descending into its subdirectories
+// and queueing each JSON file for the workers to update the corresponding image file.
+// parent holds the .takeoutignore rules of the folders above dirPath. Folders holding nothing
+// to process are recorded for the summary.
+func processDir(dirPath string, parent *ignoreList, queue chan<- string) {
+	ignores := parent.load(dirPath)
+	var found bool
+	var sidecars []string
+
+	if !stream {
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			log.Printf("Error reading directory %s: %v\n", dirPath, err)
+			return
+		}
+		for _, entry := range entries {
+			found = processEntry(dirPath, entry, ignores, queue, &sidecars) || found
+		}
+		queueLargestFirst(dirPath, sidecars, queue)
+		if !found && runCtx.Err() == nil {
+			stats.emptyFolder(dirPath)
+		}
+		return
+	}
+
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		log.Printf("Error reading directory %s: %v\n", dirPath, err)
+		return
+	}
+	defer dir.Close()
+
+	for {
+		entries, err := dir.ReadDir(streamBatch)
+		for _, entry := range entries {
+			found = processEntry(dirPath, entry, ignores, queue, &sidecars) || found
+		}
+		queueLargestFirst(dirPath, sidecars, queue)
+		sidecars = sidecars[:0]
+		if errors.Is(err, io.EOF) {
+			if !found && runCtx.Err() == nil {
+				stats.emptyFolder(dirPath)
+			}
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading directory %s: %v\n", dirPath, err)
+			return
+		}
+	}
+}
+
+// processEntry walks a subdirectory or adds a sidecar found in dirPath to sidecars, and
+// reports whether the entry was a folder, sidecar or media file. Entries excluded by a
+// .takeoutignore are skipped.
+func processEntry(dirPath string, entry os.DirEntry, ignores *ignoreList, queue chan<- string, sidecars *[]string) bool {
+	if runCtx.Err() != nil {
+		return false
+	}
+	fullPath := filepath.Join(dirPath, entry.Name())
+	if entry.IsDir() {
+		if ignores.ignored(fullPath, true) {
+			return false
+		}
+		processDir(fullPath, ignores, queue)
+		return true
+	}
+	if ignores.ignoredSidecar(fullPath) {
+		tracef(fullPath, "skipped: excluded by %s", ignoreName)
+		return false
+	}
+	if entry.Name() == failuresName {
+		return false // written by an earlier run
+	}
+	if entry.Name() == "metadata.json" {
+		// An album's metadata alone doesn't make its folder hold anything.
+		processAlbum(fullPath)
+		return false
+	}
+	// Only process files ending with .json (assumed to be Google Takeout metadata)
+	if strings.HasSuffix(entry.Name(), ".json") {
+		*sidecars = append(*sidecars, fullPath)
+		return true
+	}
+	if kindOf(fullPath) != kindOther {
+		stats.sawMedia(fullPath)
+		return true
+	}
+	return false
+}
+
+// queueLargestFirst queues the sidecars found in dir for the workers, those of the largest
+// media first. Big videos, whose edits and hashes take longest, then start early and spread
+// across the workers, instead of one of them finishing a folder alone at the end.
+func queueLargestFirst(dir string, sidecars []string, queue chan<- string) {
+	sizes := make(map[string]int64, len(sidecars))
+	for _, jsonPath := range sidecars {
+		if media, ok := takeout.SidecarMedia(filepath.Base(jsonPath)); ok {
+			if info, err := os.Stat(filepath.Join(mediaFolder(dir), media)); err == nil {
+				sizes[jsonPath] = info.Size()
+			}
+		}
+	}
+	sort.SliceStable(sidecars, func(i, j int) bool { return sizes[sidecars[i]] > sizes[sidecars[j]] })
+	for _, jsonPath := range sidecars {
+		if runCtx.Err() != nil {
+			return
+		}
+		queue <- jsonPath
+	}
+}
+
+// exitNothingDone is the exit status of runs that found nothing to process, such as an
+// empty selection or folders without sidecars, so scripts can tell them from a real run.
+const exitNothingDone = 3
+
+func main() {
+	takeout.Temps = tempMarkers{}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "clean-temp":
+			runCleanTemp(os.Args[2:])
+			return
+		case "repair":
+			runRepair(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "match":
+			runMatch(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "fix-one":
+			runFixOne(os.Args[2:])
+			return
+		case "install-shell":
+			runInstallShell(os.Args[2:])
+			return
+		case "uninstall-shell":
+			runUninstallShell(os.Args[2:])
+			return
+		case "install-schedule":
+			runInstallSchedule(os.Args[2:])
+			return
+		case "uninstall-schedule":
+			runUninstallSchedule(os.Args[2:])
+			return
+		}
+	}
+
+	// Remove temporary files left behind by runs that crashed.
+	if removed, err := cleanOrphanedTemp(); err != nil {
+		color.Yellow("Could not clean up temporary files from previous runs: %v\n", err)
+	} else if len(removed) > 0 {
+		color.Yellow("Removed %d temporary files left behind by a previous run\n", len(removed))
+	}
+
+	// Optionally allow a different starting directory via command-line flag.
+	startDir := flag.String("dir", ".", "Directory to start the recursive walk")
+	snapshot := flag.String("snapshot", "", "Record a manifest of all media to <name>.before.json and <name>.after.json around the run")
+	stdin := flag.Bool("stdin", false, "Read the sidecar or media paths to process from stdin, one per line, instead of walking -dir")
+	sincePath := flag.String("since", "", "Only process media that is new or changed (by path, size and modification time) since this snapshot")
+	summaryOut := flag.String("summary-out", "", "Write a shareable summary of the run to this file (.md for Markdown, .html for HTML, .json for report diff)")
+	flag.StringVar(&icsPath, "ics", "", "Write a calendar to this .ics file with an all-day event per day summarizing the photos taken")
+	flag.BoolVar(&skipPhotos, "skip-photos", false, "Leave photos untouched")
+	flag.BoolVar(&skipVideos, "skip-videos", false, "Leave videos untouched")
+	flag.Func("after", "Only process items taken on or after this `date`, a year, month or day like 2019 or 2019-06-15 in their local time, or an RFC 3339 time", setTakenAfter)
+	flag.Func("before", "Only process items taken before this `date`, in the forms of -after; -after 2019 -before 2022 keeps 2019 through 2021", setTakenBefore)
+	flag.Func("types", "Only process media with these comma-separated `extensions`, e.g. jpg,png,heic", setMediaTypes)
+	flag.Func("exclude-state", "Leave items in these comma-separated `states` untouched: archived, trashed, locked", func(value string) error {
+		for _, state := range strings.Split(value, ",") {
+			state = strings.TrimSpace(state)
+			switch state {
+			case "archived", "trashed", "locked":
+				excludeStates[state] = true
+			default:
+				return fmt.Errorf("unknown state %q", state)
+			}
+		}
+		return nil
+	})
+	flag.Func("label", "Tag this source with a `key:value` label such as account:alice, kept in snapshots and the summary (repeatable)", func(value string) error {
+		key, val, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(val) == "" {
+			return fmt.Errorf("expected key:value, got %q", value)
+		}
+		labels = append(labels, strings.TrimSpace(key)+":"+strings.TrimSpace(val))
+		return nil
+	})
+	flag.Func("run-id", "Identify this run with `id` in its artifacts and log lines instead of a generated one", setRunID)
+	elevate := flag.Bool("elevate", false, "Relaunch as administrator (root elsewhere) first if not already elevated")
+	maxDuration := flag.Duration("max-duration", 0, "Stop starting new files after this long, e.g. 2h, keeping a checkpoint for -resume")
+	pauseAt := flag.String("pause-at", "", "Stop starting new files at this local time, e.g. 23:00, keeping a checkpoint for -resume")
+	resume := flag.Bool("resume", false, "Skip the files an interrupted run, or one stopped by -max-duration or -pause-at, already handled")
+	force := flag.Bool("force", false, "Run even if the folder doesn't look like a raw Takeout")
+	selectAll := flag.Bool("select-all", false, "Process every folder without showing the folder selection")
+	flag.BoolVar(&noUI, "yes", false, "Run unattended: use -dir as is, process every folder and never show a dialog or prompt")
+	flag.BoolVar(&noUI, "no-ui", false, "Same as -yes")
+	flag.Func("workers", fmt.Sprintf("Number of sidecars to process at the same time, or auto to tune it by the throughput (default %d)", workers), setWorkers)
+	flag.BoolVar(&verbose, "verbose", false, "Print a line for every file instead of the progress view")
+	flag.BoolVar(&stream, "stream", false, "Process directory entries as they are listed, for folders with tens of thousands of files")
+	flag.BoolVar(&writeExif, "exif", false, "Also write the taken time into the EXIF DateTimeOriginal, CreateDate and ModifyDate of JPEG, TIFF and HEIC files, and the movie headers of MP4 and MOV videos")
+	flag.BoolVar(&writeGPS, "gps", false, "Write the sidecar's location into the EXIF GPS fields of JPEG and TIFF files, or an .xmp sidecar for other formats")
+	flag.BoolVar(&writeIPTC, "iptc", false, "Also write the taken time into the IPTC DateCreated and TimeCreated of JPEG and TIFF files")
+	flag.BoolVar(&writeCaptions, "captions", false, "Also write the sidecar's description as the IPTC caption and the people's names as keywords of JPEG and TIFF files, and into the .xmp sidecar with -xmp")
+	flag.BoolVar(&writeXMP, "xmp", false, "Also write the taken time, favorite, archived and trashed flags, the location with -gps and the captions with -captions into an .xmp sidecar next to every media file")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the old and new times of every file without changing anything; -summary-out lists them too")
+	flag.StringVar(&tarPath, "output-tar", "", "Write the corrected media into this tar `file` instead of changing them in place, - for stdout")
+	flag.StringVar(&packageDir, "package-by-year", "", "Write the corrected media into one verified zip per year taken in this `folder`, e.g. 2017.zip, instead of changing them in place")
+	flag.StringVar(&reorganizeDir, "reorganize", "", "After the run, also copy every updated media file into a folder below this `folder` laid out by its taken date, so one pass fixes the export in place and builds the organized copy, see -reorganize-layout")
+	flag.Func("reorganize-layout", "The `layout` of the -reorganize folders, from {year}, {month}, {day} and {album} (default {year}/{month})", setReorganizeLayout)
+	flag.Func("tz", "The time `zone` taken dates are written in for EXIF, XMP, -reorganize, -package-by-year and -ics: local for this machine's, auto for the zone of the item's location or else this machine's, guessed from the longitude and often an hour or more off, or a name like Europe/Berlin (default local)", setTimeZone)
+	flag.BoolVar(&reorganizeMove, "reorganize-move", false, "Move the media into the -reorganize folders instead of copying them")
+	mappingFile := flag.String("mapping", "", "Pair media and sidecars as listed in this CSV `file` of media,sidecar paths instead of matching them")
+	flag.StringVar(&mappingOut, "write-mapping", "", "Write how the run paired media and sidecars to this CSV `file`, in the format -mapping reads")
+	flag.Func("sidecar-root", "Read the sidecars from this `folder` mirroring the media tree of -dir, for exports that keep them apart", func(value string) error {
+		abs, err := filepath.Abs(value)
+		sidecarRoot = abs
+		return err
+	})
+	flag.BoolVar(&recoverRenamed, "recover-renamed", false, "Pair sidecars whose media is missing with an unpaired file in the folder whose EXIF date matches, for media renamed after the export")
+	flag.Func("from-archives", "Extract the Takeout archives matching this `glob`, e.g. takeout-*.zip, into -dir and process them in the same run", addSourceArchives)
+	flag.BoolVar(&withEdited, "edited", false, "Also set the times of edited copies like IMG_1234-edited.jpg, which share the original's sidecar")
+	flag.BoolVar(&withCompanions, "companions", true, "Also give the videos of motion and Live Photos without a sidecar, like IMG_1234.MP or IMG_1234.MOV, the photo's times and location")
+	suffixesPath := flag.String("edited-suffixes", "", "Also treat the suffixes in this `file`, one per line, as marking edited copies (default edited.txt in the takeout config folder, if present)")
+	flag.Func("unknown-types", "What to do with media of unknown types like PDFs, as comma-separated `ext=times|skip|report` pairs with * for the rest: set only their file times, leave them or leave and report them (default *=times)", setUnknownTypes)
+	flag.Func("dedupe", "Set the times of only the first copy of identical media and `skip|link|move` the others: leave them, replace them with hard links or move them into a duplicates folder", setDedupe)
+	flag.BoolVar(&extractMotion, "extract-motion", false, "Save the video embedded in Motion Photos next to them as .mp4 with the same times")
+	flag.DurationVar(&retryDelay, "retry-delay", retryDelay, "Wait this long after the run, then retry the files that were locked or busy one at a time, doubling the wait for every further pass; 0 disables the retry")
+	flag.IntVar(&retryAttempts, "retry-attempts", retryAttempts, "Retry the files that were locked or busy at most this many times")
+	retryFile := flag.String("retry", "", "Process only the sidecars listed in this failures `file`, the "+failuresName+" an earlier run left in its folder")
+	flag.Func("future", "What to do with items dated in the future: `skip|clamp|apply` to leave them, give them the current time or stamp them anyway; they are listed in the summary (default skip)", setFuture)
+	flag.Func("trust", "Which photoTakenTime to use when its `timestamp|formatted` time disagree; conflicts are listed in the summary", setTrust)
+	flag.BoolVar(&strict, "strict", false, "Abort on the first unknown sidecar field, sidecar without media or write failure")
+	flag.Func("trace", "Print every decision made for sidecars or media matching this `glob`, e.g. IMG_1234*", func(value string) error {
+		if _, err := filepath.Match(value, ""); err != nil {
+			return err
+		}
+		traceGlob = value
+		return nil
+	})
+	flag.Func("theme", "The `look` of the dialogs: auto to follow the terminal's background, dark, light, or plain for no colors (default auto)", setTheme)
+	keysPath := flag.String("keys", "", "Rebind the keys of the dialogs with the `file` of \"action = keys\" lines, e.g. \"down = n, down\" (default keys.txt in the takeout config folder, if present)")
+	rulesPath := flag.String("rules", "", "Apply the `file` of \"when: ... then: ...\" rules (default rules.txt in the takeout config folder, if present)")
+	flag.StringVar(&auditPath, "report", "", "Write every sidecar and media `file` of the run with its outcome and media size to this file, as CSV for .csv and JSON otherwise")
+	flag.IntVar(&slowestLimit, "slowest", slowestLimit, "Number of slowest files to list in the -summary-out report")
+	memoryLimit := flag.String("memory-limit", "", "Soft memory ceiling for the run, e.g. 512MiB (default no limit)")
+	if err := setFlagsFromEnv(flag.CommandLine, "TAKEOUT_"); err != nil {
+		log.Fatalf("Error reading flags from the environment: %v\n", err)
+	}
+	flag.Parse()
+
+	if *memoryLimit != "" {
+		limit, err := humanize.ParseBytes(*memoryLimit)
+		if err != nil {
+			log.Fatalf("Error parsing -memory-limit: %v\n", err)
+		}
+		debug.SetMemoryLimit(int64(limit))
+	}
+
+	log.SetPrefix(runID + " ")
+
+	// The archive owns stdout, so messages move to stderr and prompts can't be shown.
+	if tarPath == "-" {
+		color.Output = os.Stderr
+		terminal = false
+	}
+	if noUI {
+		*selectAll = true
+		terminal = false
+	}
+	if tarPath != "" && packageDir != "" {
+		log.Fatalf("-package-by-year can't be combined with -output-tar\n")
+	}
+	if tarPath != "" && (dedupe == "link" || dedupe == "move") {
+		log.Fatalf("-dedupe %s can't be combined with -output-tar, which leaves out duplicates with -dedupe skip\n", dedupe)
+	}
+	if packageDir != "" && (dedupe == "link" || dedupe == "move") {
+		log.Fatalf("-dedupe %s can't be combined with -package-by-year, which leaves out duplicates with -dedupe skip\n", dedupe)
+	}
+	if (tarPath != "" || packageDir != "") && reorganizeDir != "" {
+		log.Fatalf("-reorganize can't be combined with -output-tar or -package-by-year\n")
+	}
+	if (tarPath != "" || packageDir != "") && extractMotion {
+		log.Fatalf("-extract-motion can't be combined with -output-tar or -package-by-year\n")
+	}
+	if len(sourceArchives) > 0 && (dryRun || *stdin) {
+		log.Fatalf("-from-archives can't be combined with -dry-run or -stdin\n")
+	}
+
+	if *elevate && !isElevated() {
+		if err := relaunchElevated(); err != nil {
+			log.Fatalf("Error elevating: %v\n", err)
+		}
+		return
+	}
+
+	// Without a terminal or display the prompts can't be shown, so ask for their flags
+	// up front rather than hanging on a dialog nobody can see.
+	if isRemote(*startDir) {
+		if unsupported := unsupportedRemoteFlags(); len(unsupported) > 0 {
+			log.Fatalf("%s can't be used with an sftp:// -dir\n", strings.Join(unsupported, ", "))
+		}
+	}
+	if missing := headlessMissing(*startDir, *selectAll, *stdin || *retryFile != "" || len(sourceArchives) > 0 || isRemote(*startDir)); len(missing) > 0 {
+		color.Red("Running without a terminal or display requires:\n")
+		for _, need := range missing {
+			color.Red("  %s\n", need)
+		}
+		os.Exit(2)
+	}
+
+	rulesFile, required := *rulesPath, *rulesPath != ""
+	if !required {
+		rulesFile, _ = defaultRulesPath()
+	}
+	if rulesFile != "" {
+		var err error
+		rules, err = loadRules(rulesFile, required)
+		if err != nil {
+			log.Fatalf("Error loading rules: %v\n", err)
+		}
+	}
+
+	keysFile, required := *keysPath, *keysPath != ""
+	if !required {
+		keysFile, _ = defaultKeysPath()
+	}
+	if keysFile != "" {
+		if err := loadKeys(keysFile, required); err != nil {
+			log.Fatalf("Error loading key bindings: %v\n", err)
+		}
+	}
+
+	suffixesFile, required := *suffixesPath, *suffixesPath != ""
+	if !required {
+		suffixesFile, _ = defaultEditedSuffixesPath()
+	}
+	if suffixesFile != "" {
+		if err := loadEditedSuffixes(suffixesFile, required); err != nil {
+			log.Fatalf("Error loading edited suffixes: %v\n", err)
+		}
+	}
+
+	// A run that picks its folders in the wizard first asks what it is for, unless the flags
+	// given already say so.
+	mode := modeInPlace
+	if terminal && !*selectAll && !*stdin && *retryFile == "" && len(sourceArchives) == 0 && !isRemote(*startDir) &&
+		!dryRun && tarPath == "" && packageDir == "" && reorganizeDir == "" {
+		var err error
+		mode, err = chooseMode(startDir)
+		if err != nil {
+			log.Fatalf("Error running form: %v", err)
+		}
+	}
+
+	if *mappingFile != "" {
+		var err error
+		mapping, err = loadMapping(*mappingFile)
+		if err != nil {
+			log.Fatalf("Error loading mapping: %v\n", err)
+		}
+	}
+
+	if *sincePath != "" {
+		var err error
+		since, err = loadInventory(*sincePath)
+		if err != nil {
+			log.Fatalf("Error loading snapshot: %v\n", err)
+		}
+	}
+
+	var (
+		absStartDir     string
+		selectedFolders []string
+		sidecars        []string
+		snapshotTargets []string
+	)
+	if isRemote(*startDir) {
+		var err error
+		absStartDir, err = dialRemote(*startDir)
+		if err != nil {
+			log.Fatalf("Error connecting to %s: %v\n", *startDir, err)
+		}
+		defer remote.Close()
+		if mode == modeServer {
+			confirmRemotePlan(absStartDir)
+		}
+	} else if *stdin {
+		var err error
+		absStartDir, err = filepath.Abs(*startDir)
+		if err != nil {
+			log.Fatalf("Error determining absolute path: %v\n", err)
+		}
+		sidecars, err = readPathList(os.Stdin)
+		if err != nil {
+			log.Fatalf("Error reading paths from stdin: %v\n", err)
+		}
+		if *snapshot != "" {
+			snapshotTargets = listedMedia(sidecars)
+		}
+	} else if *retryFile != "" {
+		var err error
+		absStartDir, sidecars, err = readFailures(*retryFile)
+		if err != nil {
+			log.Fatalf("Error reading failures to retry: %v\n", err)
+		}
+		if *snapshot != "" {
+			snapshotTargets = listedMedia(sidecars)
+		}
+	} else if len(sourceArchives) > 0 {
+		// The archives are extracted into -dir, so there is nothing to select yet.
+		var err error
+		absStartDir, err = filepath.Abs(*startDir)
+		if err == nil {
+			err = os.MkdirAll(absStartDir, 0o755)
+		}
+		if err != nil {
+			log.Fatalf("Error preparing %s for the archives: %v\n", *startDir, err)
+		}
+	} else {
+		absStartDir, selectedFolders = selectFolders(*startDir, snapshot, *selectAll)
+		snapshotTargets = selectedFolders
+		// Incremental and resumed runs are expected to find traces of the earlier run.
+		if !*force && *sincePath == "" && !*resume {
+			confirmRawTakeout(absStartDir, selectedFolders, *selectAll)
+		}
+	}
+
+	exportRoot = absStartDir
+	if tarPath != "" && !dryRun {
+		tarArchive, err := openArchive(tarPath, absStartDir)
+		if err != nil {
+			log.Fatalf("Error creating archive: %v\n", err)
+		}
+		archive = tarArchive
+	} else if packageDir != "" && !dryRun {
+		years, err := openYearArchives(packageDir, absStartDir)
+		if err != nil {
+			log.Fatalf("Error preparing %s for the yearly archives: %v\n", packageDir, err)
+		}
+		archive = years
+	}
+
+	var snapshotBefore, snapshotAfter string
+	if *snapshot != "" {
+		snapshotBefore, snapshotAfter = snapshotPaths(*snapshot)
+		if err := writeSnapshot(snapshotBefore, absStartDir, snapshotTargets); err != nil {
+			log.Fatalf("Error recording snapshot: %v\n", err)
+		}
+	}
+
+	budget, cancel, err := budgetContext(*maxDuration, *pauseAt)
+	if err != nil {
+		log.Fatalf("Error parsing -pause-at: %v\n", err)
+	}
+	defer cancel()
+	runCtx, stopRun = context.WithCancelCause(budget)
+	// A dry run changes nothing, so it must not mark files as done for a later -resume. Runs
+	// writing an archive only keep a checkpoint when asked to, since a stopped run's archive
+	// is discarded.
+	if !*resume && !dryRun && remote == nil {
+		*resume = offerResume(absStartDir)
+	}
+	switch {
+	case dryRun || remote != nil:
+	case *maxDuration > 0 || *pauseAt != "" || *resume:
+		progress, err = openCheckpoint(absStartDir, *resume)
+		if err != nil {
+			log.Fatalf("Error opening checkpoint: %v\n", err)
+		}
+	case archive == nil:
+		if progress, err = openCheckpoint(absStartDir, false); err != nil {
+			color.Yellow("Could not keep a checkpoint for -resume: %v\n", err)
+			progress = nil
+		}
+	}
+	if progress != nil && *resume {
+		if n := progress.resumed(); n > 0 {
+			color.Cyan("Resuming: %d files were already handled\n", n)
+		}
+	}
+
+	ctx, done := context.WithCancel(context.Background())
+
+	now := time.Now()
+	run := func() {
+		defer done()
+		if len(sourceArchives) > 0 {
+			extraction, err := extractArchives(sourceArchives, absStartDir)
+			if err != nil {
+				// Reported as the cause the run stopped for; a partial extraction isn't processed.
+				stopRun(fmt.Errorf("extracting archives: %w", err))
+				return
+			}
+			color.Green("✓ Extracted %d files into %s, %d were already there\n", extraction.extracted, absStartDir, extraction.existing)
+			sidecars = extraction.sidecars
+		}
+		if remote != nil {
+			processRemote(absStartDir)
+		} else {
+			processSidecars(absStartDir, selectedFolders, sidecars)
+			retryTransient()
+			resolveDuplicates(absStartDir)
+			reorganize()
+		}
+	}
+	// The spinner would draw over an archive written to stdout.
+	switch {
+	case tarPath == "-":
+		run()
+	case showProgress():
+		var count func() int
+		if remote == nil && len(sourceArchives) == 0 {
+			count = func() int { return countSidecars(absStartDir, selectedFolders, len(sidecars)) }
+		}
+		runWithProgress(run, count)
+	default:
+		// The spinner runs until run is done. Ctrl+C only stops the spinner, so the run is
+		// stopped like a time budget running out and waited for: sidecars in progress finish
+		// and the checkpoint is kept for -resume.
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			run()
+		}()
+		err := spinner.New().
+			Type(spinner.Points).
+			Title(" Processing folders...").
+			Context(ctx).
+			Accessible(!terminal).
+			Run()
+		switch {
+		case errors.Is(err, tea.ErrInterrupted):
+			stopRun(errInterrupted)
+		case err != nil && ctx.Err() == nil:
+			log.Printf("Error showing progress: %v\n", err)
+		}
+		<-finished
+	}
+
+	cause := context.Cause(runCtx)
+	aborted := cause != nil && !errors.Is(cause, context.DeadlineExceeded)
+	paused := cause != nil && !aborted
+	if progress != nil {
+		if err := progress.close(cause == nil); err != nil {
+			color.Red("Error closing checkpoint: %v\n", err)
+		}
+	}
+	if aborted {
+		color.Red("✗ Aborted after %s: %v\n", time.Since(now).Round(time.Second), cause)
+		if progress != nil {
+			color.Yellow("Run again with -resume to continue where it stopped\n")
+		}
+	} else if paused {
+		color.Yellow("⏸ Time budget reached after %s, run again with -resume to continue\n", time.Since(now).Round(time.Second))
+	} else {
+		color.Green("✓ Completed in %s\n", time.Since(now).Round(time.Second))
+	}
+	stats.printSummary(time.Since(now))
+	if archive != nil {
+		if err := archive.close(!aborted); err != nil {
+			color.Red("Error finishing archive: %v\n", err)
+		} else if years, ok := archive.(*yearArchives); ok && !aborted {
+			years.report()
+		} else if tarPath != "-" && !aborted {
+			color.Green("✓ Wrote archive to %s\n", tarPath)
+		}
+	}
+	if since != nil {
+		color.Cyan("Skipped %d files unchanged since %s\n", stats.counts[outcomeUnchanged], *sincePath)
+	}
+	warnSharedAlbums(stats.sharedAlbums())
+	stats.warnEmptyFolders(absStartDir)
+	if !dryRun && remote == nil {
+		retried := ""
+		if *retryFile != "" {
+			retried, _ = filepath.Abs(*retryFile)
+		}
+		if path, err := writeFailures(absStartDir, retried); err != nil {
+			color.Red("Error writing the failures: %v\n", err)
+		} else if path != "" {
+			color.Yellow("Run again with -retry %s to process only the files that failed\n", path)
+		}
+	}
+	if *summaryOut != "" {
+		if err := stats.writeSummary(*summaryOut, absStartDir); err != nil {
+			log.Fatalf("Error writing summary: %v\n", err)
+		}
+		color.Green("✓ Wrote summary to %s\n", *summaryOut)
+	}
+	if auditPath != "" {
+		if err := stats.writeAudit(auditPath, absStartDir); err != nil {
+			log.Fatalf("Error writing report: %v\n", err)
+		}
+		color.Green("✓ Wrote report to %s\n", auditPath)
+	}
+	if mappingOut != "" {
+		if err := writeMapping(mappingOut); err != nil {
+			log.Fatalf("Error writing mapping: %v\n", err)
+		}
+		color.Green("✓ Wrote mapping to %s\n", mappingOut)
+	}
+	if icsPath != "" {
+		if err := writeICS(icsPath); err != nil {
+			log.Fatalf("Error writing calendar: %v\n", err)
+		}
+		color.Green("✓ Wrote photo calendar to %s\n", icsPath)
+	}
+
+	if *snapshot != "" {
+		if err := writeSnapshot(snapshotAfter, absStartDir, snapshotTargets); err != nil {
+			log.Fatalf("Error recording snapshot: %v\n", err)
+		}
+		color.Cyan("Run `takeout diff %s %s` to review what changed\n", snapshotBefore, snapshotAfter)
+	}
+
+	if denied := stats.counts[outcomeDenied]; denied > 0 && !isElevated() {
+		color.Yellow("%d files could not be updated because access was denied.\n", denied)
+		color.Yellow("Their permissions may only allow administrators to change them; re-run as administrator or with -elevate.\n")
+		offerElevation(*stdin)
+	}
+
+	if aborted {
+		os.Exit(1)
+	}
+	if stats.finishedCount == 0 && !paused {
+		color.Yellow("No sidecars were found, so nothing was done\n")
+		os.Exit(exitNothingDone)
+	}
+}
+
+// offerElevation asks whether to relaunch the run as administrator after permission failures.
+// Runs fed from stdin can't be relaunched since the path list has already been consumed,
+// and runs without a terminal have nobody to ask.
+func offerElevation(stdin bool) {
+	if stdin || !terminal {
+		return
+	}
+
+	var relaunch bool
+	err := runField(huh.NewConfirm().
+		Title("Relaunch as administrator and run again?").
+		Value(&relaunch),
+	)
+	if err != nil || !relaunch {
+		return
+	}
+	if err := relaunchElevated(); err != nil {
+		color.Red("%v\n", err)
+	}
+}
+
+// confirmRawTakeout guards against running over a library that was already migrated.
+// It warns about every sign of an earlier run and asks whether to go ahead anyway;
+// unattended -select-all runs stop instead, since nobody is there to answer, while -yes
+// goes ahead.
+func confirmRawTakeout(root string, folders []string, selectAll bool) {
+	signs := processedSigns(root, folders)
+	if len(signs) == 0 {
+		return
+	}
+
+	color.Yellow("%s doesn't look like a raw Google Takeout:\n", root)
+	for _, sign := range signs {
+		color.Yellow("  - %s\n", sign)
+	}
+	if noUI {
+		color.Yellow("Running anyway because of -yes\n")
+		return
+	}
+	if selectAll {
+		log.Fatalf("Refusing to run; pass -force to run anyway\n")
+	}
+
+	var proceed bool
+	err := runField(huh.NewConfirm().
+		Title("Run anyway?").
+		Value(&proceed),
+	)
+	if err != nil || !proceed {
+		os.Exit(0)
+	}
+}
+
+// selectFolders asks for the root "Google Photos" folder unless one was given with -dir, or -yes uses it as is,
+// then walks the user through choosing folders and options and confirming the plan.
+// Choosing to take a snapshot fills in snapshot if it wasn't given with -snapshot.
+// With selectAll every folder is processed and the wizard is skipped entirely.
+func selectFolders(startDir string, snapshot *string, selectAll bool) (string, []string) {
+	var absStartDir string
+	if startDir != "." || noUI {
+		var err error
+		absStartDir, err = filepath.Abs(startDir)
+		if err != nil {
+			log.Fatalf("Error determining absolute path: %v\n", err)
+		}
+	} else {
+		startDir, err := filepath.Abs(".")
+		if err != nil {
+			log.Fatalf("Error determining absolute path: %v\n", err)
+		}
+		absStartDir, err = pickRoot(startDir)
+		if err != nil {
+			if errors.Is(err, errPickCancelled) {
+				absStartDir = startDir
+				color.Yellow(`Using current "%s" directory\n`, absStartDir)
+			} else {
+				log.Fatalf("Error selecting directory: %v\n", err)
+			}
+		}
+	}
+	// Known up front so that reviewing the plan finds the media of a separate sidecar tree.
+	exportRoot = absStartDir
+
+	if selectAll {
+		albums, err := albumFolders(absStartDir)
+		if err != nil {
+			log.Fatalf("Error reading directory %s: %v\n", absStartDir, err)
+		}
+		var selectedFolders []string
+		for _, folders := range albums {
+			selectedFolders = append(selectedFolders, folders...)
+		}
+		if len(selectedFolders) == 0 {
+			color.Yellow("%s holds no folders to process, nothing was changed\n", absStartDir)
+			os.Exit(exitNothingDone)
+		}
+		return absStartDir, selectedFolders
+	}
+
+	// Start from the selection made the last time this root was processed.
+	selections, err := loadSelections()
+	if err != nil {
+		color.Yellow("Could not load the last folder selection: %v\n", err)
+	}
+	remembered := selections[absStartDir]
+
+	// Prepare the answers the wizard collects.
+	var (
+		selectedAlbums []string
+		recordSnapshot = *snapshot != ""
+		confirmed      bool
+	)
+
+	// Build the wizard: pick folders and choose options. The plan is reviewed before anything runs.
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Select folders to process. Press [enter] to continue (all folders selected by default)").
+				DescriptionFunc(func() string { return fmt.Sprintf("🗁   %v", absStartDir) }, &absStartDir).
+				OptionsFunc(getFolders(absStartDir, remembered), &absStartDir).
+				Value(&selectedAlbums),
+		),
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Record a snapshot before and after the run?").
+				Description("Hashes every media file so `takeout diff` can prove exactly what changed. Slower on large exports.").
+				Value(&recordSnapshot),
+		).WithHideFunc(func() bool { return *snapshot != "" }),
+	)
+
+	// Run the form to let the user choose which folders to process.
+	if err := runForm(form); err != nil {
+		log.Fatalf("Error running form: %v", err)
+	}
+	if len(selectedAlbums) == 0 {
+		color.Yellow("No folders were selected, nothing was changed\n")
+		os.Exit(exitNothingDone)
+	}
+
+	// Review the plan, drilling into albums for their per-file changes, until it is started or cancelled.
+	for {
+		action := "start"
+		options := []huh.Option[string]{huh.NewOption("Start processing", "start"), huh.NewOption("Cancel", "cancel")}
+		for _, album := range selectedAlbums {
+			options = append(options, huh.NewOption("Review the changes in "+album, "review:"+album))
+		}
+		err := runForm(huh.NewForm(huh.NewGroup(
+			huh.NewNote().
+				Title("Plan").
+				Description(planSummary(absStartDir, selectedAlbums, recordSnapshot)),
+			huh.NewSelect[string]().
+				Title("Start processing?").
+				Options(options...).
+				Height(min(len(options)+2, 12)).
+				Value(&action),
+		)))
+		if err != nil {
+			log.Fatalf("Error running form: %v", err)
+		}
+		album, review := strings.CutPrefix(action, "review:")
+		if !review {
+			confirmed = action == "start"
+			break
+		}
+		if err := reviewAlbum(absStartDir, album); err != nil {
+			log.Fatalf("Error running form: %v", err)
+		}
+	}
+	if !confirmed {
+		color.Yellow("Cancelled, nothing was changed\n")
+		os.Exit(0)
+	}
+	if recordSnapshot && *snapshot == "" {
+		*snapshot = filepath.Join(absStartDir, "takeout-snapshot.json")
+	}
+
+	albums, err := albumFolders(absStartDir)
+	if err != nil {
+		log.Fatalf("Error reading directory %s: %v\n", absStartDir, err)
+	}
+	known := make([]string, 0, len(albums))
+	for album := range albums {
+		known = append(known, album)
+	}
+	sort.Strings(known)
+	if err := rememberSelection(absStartDir, selectedAlbums, known); err != nil {
+		color.Yellow("Could not remember the folder selection: %v\n", err)
+	}
+
+	selectedFolders, err := expandAlbums(absStartDir, selectedAlbums)
+	if err != nil {
+		log.Fatalf("Error reading directory %s: %v\n", absStartDir, err)
+	}
+	return absStartDir, selectedFolders
+}
+
+func getFolders(absStartDir string, remembered selection) func() []huh.Option[string] {
+	return func() []huh.Option[string] {
+		// List folders in absStartDir, grouping split albums into one entry.
+		albums, err := albumFolders(absStartDir)
+		if err != nil {
+			log.Fatalf("Error reading directory %s: %v\n", absStartDir, err)
+		}
+
+		// Build MultiSelect options with all albums checked by default,
+		// except those left unchecked the last time.
+		options := make([]huh.Option[string], 0, len(albums))
+		for album, folders := range albums {
+			label := album
+			if len(folders) > 1 {
+				label = fmt.Sprintf("%s (%d folders)", album, len(folders))
+			}
+			options = append(options, huh.NewOption(label, album).Selected(remembered.preselected(album)))
+		}
+		return options
+	}
+}
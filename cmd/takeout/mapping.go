@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ellypaws/takeout"
+)
+
+// mappingHeader is the header row of mapping files.
+var mappingHeader = []string{"media", "sidecar"}
+
+// mapping pairs sidecars with media as loaded by -mapping, by absolute sidecar path.
+// Sidecars it lists skip the matcher entirely.
+var mapping map[string]string
+
+// loadMapping reads a CSV of media and sidecar paths. Relative paths are relative to the
+// folder of the file, so a file written by -write-mapping can be edited and fed back as is.
+func loadMapping(path string) (map[string]string, error) {
+	root, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	pairs := make(map[string]string)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if line == 1 && strings.EqualFold(record[0], mappingHeader[0]) && strings.EqualFold(record[1], mappingHeader[1]) {
+			continue
+		}
+		sidecar := mappingPath(root, record[1])
+		if previous, ok := pairs[sidecar]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is already mapped to %s", path, line, record[1], previous)
+		}
+		pairs[sidecar] = mappingPath(root, record[0])
+	}
+	return pairs, nil
+}
+
+// mappingPath resolves a path of a mapping file against the file's folder.
+func mappingPath(root, path string) string {
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	return filepath.Clean(path)
+}
+
+// mappedMedia returns the media the -mapping file pairs with the sidecar at jsonPath.
+func mappedMedia(jsonPath string) (string, bool) {
+	if mapping == nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(jsonPath)
+	if err != nil {
+		return "", false
+	}
+	media, ok := mapping[abs]
+	return media, ok
+}
+
+// mappingOut is the file -write-mapping writes the pairs of the run to.
+var mappingOut string
+
+// computedMapping collects the pairs of the run for -write-mapping. It is safe for concurrent use.
+var computedMapping = struct {
+	mu    sync.Mutex
+	pairs map[string]string
+}{pairs: make(map[string]string)}
+
+// recordMapping remembers that the sidecar at jsonPath was paired with imagePath.
+func recordMapping(jsonPath, imagePath string) {
+	computedMapping.mu.Lock()
+	defer computedMapping.mu.Unlock()
+	computedMapping.pairs[jsonPath] = imagePath
+}
+
+// writeMapping writes the pairs of the run as a mapping file with paths relative to its
+// folder, sorted by sidecar, in the format -mapping reads.
+func writeMapping(path string) error {
+	root, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	computedMapping.mu.Lock()
+	defer computedMapping.mu.Unlock()
+
+	sidecars := make([]string, 0, len(computedMapping.pairs))
+	for sidecar := range computedMapping.pairs {
+		sidecars = append(sidecars, sidecar)
+	}
+	sort.Strings(sidecars)
+
+	err = takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(mappingHeader); err != nil {
+			return err
+		}
+		for _, sidecar := range sidecars {
+			if err := writer.Write([]string{relativeTo(root, computedMapping.pairs[sidecar]), relativeTo(root, sidecar)}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write mapping %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// runMatch implements the "match" command, explaining which sidecar and media files
+// a run would pair for the given path.
+func runMatch(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: takeout match <media or sidecar>")
+		os.Exit(2)
+	}
+
+	matches, err := takeout.Matcher{Resolve: resolveMedia}.Match(args[0])
+	if err != nil {
+		color.Red("%v\n", err)
+		os.Exit(1)
+	}
+	if len(matches) == 0 || !matches[0].Paired {
+		color.Yellow("No sidecar is paired with %s\n", args[0])
+	}
+	for _, match := range matches {
+		switch {
+		case !match.Paired:
+			color.Yellow("  %s: %s\n", filepath.Base(match.Sidecar), match.Reason)
+		case !match.Exists:
+			color.Red("%s → %s (missing): %s\n", match.Sidecar, match.Media, match.Reason)
+		default:
+			color.Green("%s → %s: %s\n", match.Sidecar, match.Media, match.Reason)
+		}
+	}
+	if len(matches) == 0 || !matches[0].Paired {
+		os.Exit(1)
+	}
+}
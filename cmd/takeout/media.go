@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ellypaws/takeout"
+)
+
+// mediaKind distinguishes photos from videos for filtering and reporting.
+type mediaKind int
+
+const (
+	kindOther mediaKind = iota
+	kindPhoto
+	kindVideo
+)
+
+// mediaKinds maps lowercase extensions of formats Google Photos stores to their kind.
+var mediaKinds = map[string]mediaKind{
+	".jpg": kindPhoto, ".jpeg": kindPhoto, ".jpe": kindPhoto, ".jfif": kindPhoto, ".png": kindPhoto,
+	".gif": kindPhoto, ".bmp": kindPhoto, ".ico": kindPhoto, ".tif": kindPhoto, ".tiff": kindPhoto,
+	".heic": kindPhoto, ".heif": kindPhoto, ".avif": kindPhoto, ".webp": kindPhoto,
+	".dng": kindPhoto, ".cr2": kindPhoto, ".cr3": kindPhoto, ".crw": kindPhoto, ".nef": kindPhoto,
+	".nrw": kindPhoto, ".arw": kindPhoto, ".srf": kindPhoto, ".sr2": kindPhoto, ".orf": kindPhoto,
+	".raf": kindPhoto, ".rw2": kindPhoto, ".pef": kindPhoto, ".srw": kindPhoto, ".raw": kindPhoto,
+	".mp4": kindVideo, ".mp": kindVideo, ".m4v": kindVideo, ".mov": kindVideo, ".3gp": kindVideo, ".3g2": kindVideo,
+	".avi": kindVideo, ".divx": kindVideo, ".mkv": kindVideo, ".webm": kindVideo, ".mts": kindVideo,
+	".m2t": kindVideo, ".m2ts": kindVideo, ".mod": kindVideo, ".tod": kindVideo, ".wmv": kindVideo,
+	".asf": kindVideo, ".mmv": kindVideo, ".mpg": kindVideo, ".mpeg": kindVideo,
+}
+
+// capability describes what can be recorded for the media at path: "embedded metadata" for
+// formats a handler writes into, "times only" for the rest, which only get their file times.
+func capability(path string) string {
+	if takeout.HandlerFor(path) != takeout.TimesOnly {
+		return "embedded metadata"
+	}
+	return "times only"
+}
+
+// kindOf returns the kind of media at path based on its extension.
+func kindOf(path string) mediaKind {
+	return mediaKinds[strings.ToLower(filepath.Ext(path))]
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestCapability(t *testing.T) {
+	for path, want := range map[string]string{
+		"a.JPG":  "embedded metadata",
+		"a.jfif": "embedded metadata",
+		"a.tiff": "embedded metadata",
+		"a.heic": "embedded metadata",
+		"a.mp4":  "embedded metadata",
+		"a.png":  "times only",
+		"a.webp": "times only",
+		"a.dng":  "times only",
+		"a.nef":  "times only",
+		"a.gif":  "times only",
+	} {
+		if got := capability(path); got != want {
+			t.Errorf("capability(%s) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+)
+
+// extractMotion is set by -extract-motion to save the video embedded in Motion Photos
+// next to the photo, for targets that can't play the embedded format.
+var extractMotion bool
+
+// errMotionExists means the video was already extracted by an earlier run.
+var errMotionExists = errors.New("motion video already extracted")
+
+// motionPath returns where the video of a Motion Photo is extracted to,
+// e.g. "PXL_20230101_120000.MP.mp4" for "PXL_20230101_120000.MP.jpg".
+func motionPath(photo string) string {
+	return strings.TrimSuffix(photo, filepath.Ext(photo)) + ".mp4"
+}
+
+// extractMotionVideo saves the video embedded in the Motion Photo at photo as a standalone
+// file with the same times. It returns the video's path, takeout.ErrNoMotion if there is none,
+// or errMotionExists if it was already extracted, in which case it is left alone.
+func extractMotionVideo(photo string, takenTime time.Time) (string, error) {
+	target := motionPath(photo)
+	if _, err := os.Stat(target); err == nil {
+		return target, errMotionExists
+	}
+
+	data, err := os.ReadFile(photo)
+	if err != nil {
+		return "", err
+	}
+	video, err := takeout.MotionVideo(data)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := takeout.CreateTemp(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(video); err != nil {
+		takeout.DiscardTemp(file)
+		return "", fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if err := takeout.CommitTemp(file, target); err != nil {
+		return "", err
+	}
+
+	if err := os.Chtimes(target, takenTime, takenTime); err != nil {
+		return target, err
+	}
+	if volumeOf(target).creationSupported() {
+		if err := timestamps.SetCreated(target, takenTime); err != nil {
+			return target, err
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+)
+
+// errPickCancelled means the folder prompt was left empty.
+var errPickCancelled = errors.New("cancelled")
+
+// canPickRoot reports whether the folder prompt can be shown.
+func canPickRoot() bool {
+	return terminal
+}
+
+// pickRoot asks for the root "Google Photos" folder in the terminal. There is no native
+// folder dialog outside Windows, so the path is typed in instead.
+func pickRoot(startDir string) (string, error) {
+	var dir string
+	err := runField(huh.NewInput().
+		Title(`Path to the root "Google Photos" folder`).
+		Description("Leave empty to use " + startDir).
+		Validate(func(value string) error {
+			if strings.TrimSpace(value) == "" {
+				return nil
+			}
+			info, err := os.Stat(value)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a folder", value)
+			}
+			return nil
+		}).
+		Value(&dir),
+	)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(dir) == "" {
+		return "", errPickCancelled
+	}
+	return filepath.Abs(strings.TrimSpace(dir))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/sqweek/dialog"
+)
+
+// errPickCancelled means the folder picker was closed without choosing a folder.
+var errPickCancelled = errors.New("cancelled")
+
+// canPickRoot reports whether the folder picker can be shown.
+func canPickRoot() bool {
+	return hasDisplay()
+}
+
+// pickRoot asks for the root "Google Photos" folder with the native folder dialog.
+func pickRoot(startDir string) (string, error) {
+	dir, err := dialog.Directory().Title(`Select the root "Google Photos" folder.`).SetStartDir(startDir).Browse()
+	if errors.Is(err, dialog.ErrCancelled) {
+		return "", errPickCancelled
+	}
+	return dir, err
+}
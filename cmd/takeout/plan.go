@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/ellypaws/takeout"
+)
+
+// plannedChange is what a run would do to a single sidecar's media, for reviewing an
+// album before anything is applied.
+type plannedChange struct {
+	media    string
+	from, to time.Time
+	// skipped explains why the media would be left alone, empty if its dates change.
+	skipped string
+}
+
+// planChange works out what a run would do for the sidecar at jsonPath, following the
+// same checks as processMedia without writing anything.
+func planChange(jsonPath string) plannedChange {
+	meta, err := readTakeout(jsonPath)
+	if err != nil {
+		media, _ := takeout.SidecarMedia(filepath.Base(jsonPath))
+		return plannedChange{media: filepath.Join(filepath.Dir(jsonPath), media), skipped: "unreadable sidecar"}
+	}
+	change := plannedChange{media: mediaPath(jsonPath, meta)}
+
+	change.to, err = meta.PhotoTakenTime.Time()
+	if err != nil {
+		change.skipped = "invalid photoTakenTime"
+		return change
+	}
+	if r := matchRule(meta, change.media, change.to); r != nil {
+		if r.skip {
+			change.skipped = fmt.Sprintf("skipped by rule on line %d", r.line)
+			return change
+		}
+		if r.timeSource != "" {
+			if change.to, err = r.sourceTime(meta); err != nil {
+				change.skipped = "invalid " + r.timeSource + " time"
+				return change
+			}
+		}
+	}
+	var ok bool
+	if change.to, ok = futureTime(change.to, time.Now()); !ok {
+		change.skipped = "dated in the future"
+		return change
+	}
+	for _, state := range meta.States() {
+		if excludeStates[state] {
+			change.skipped = "excluded as " + state
+			return change
+		}
+	}
+	if reason := filteredOut(meta, change.media, change.to); reason != "" {
+		change.skipped = reason
+		return change
+	}
+	switch kind := kindOf(change.media); {
+	case kind == kindPhoto && skipPhotos:
+		change.skipped = "photos skipped"
+		return change
+	case kind == kindVideo && skipVideos:
+		change.skipped = "videos skipped"
+		return change
+	case kind == kindOther && unknownPolicyOf(change.media) != unknownTimes:
+		change.skipped = "unknown type skipped"
+		return change
+	}
+
+	info, err := os.Stat(change.media)
+	if err != nil {
+		change.skipped = "media missing"
+		return change
+	}
+	change.from = info.ModTime()
+	return change
+}
+
+// albumChanges plans the changes to every sidecar in the folders of an album, sorted by media path.
+func albumChanges(root string, folders []string) []plannedChange {
+	var changes []plannedChange
+	for _, folder := range folders {
+		folder = sidecarFolder(root, folder)
+		ignores := ignoresAbove(cmp.Or(sidecarRoot, root), folder).load(folder)
+		entries, err := os.ReadDir(folder)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(folder, entry.Name())
+			if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".json") ||
+				entry.Name() == "metadata.json" || entry.Name() == failuresName || ignores.ignoredSidecar(path) {
+				continue
+			}
+			changes = append(changes, planChange(path))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].media < changes[j].media })
+	return changes
+}
+
+// describe formats the change for the album review, e.g. "IMG_1.jpg: 2024-05-01 10:00 → 2019-07-14 02:40".
+func (c plannedChange) describe(root string) string {
+	name := relativeTo(root, c.media)
+	switch {
+	case c.skipped != "":
+		return fmt.Sprintf("%s: %s", name, c.skipped)
+	case c.from.Equal(c.to):
+		return fmt.Sprintf("%s: already %s", name, c.to.Local().Format(time.DateTime))
+	}
+	return fmt.Sprintf("%s: %s → %s", name, c.from.Local().Format(time.DateTime), c.to.Local().Format(time.DateTime))
+}
+
+// reviewAlbum shows the planned per-file changes of an album until it is dismissed.
+func reviewAlbum(root, album string) error {
+	albums, err := albumFolders(root)
+	if err != nil {
+		return err
+	}
+	changes := albumChanges(root, albums[album])
+
+	options := make([]huh.Option[int], 0, len(changes))
+	updated := 0
+	for i, change := range changes {
+		if change.skipped == "" && !change.from.Equal(change.to) {
+			updated++
+		}
+		options = append(options, huh.NewOption(change.describe(root), i))
+	}
+	if len(options) == 0 {
+		options = append(options, huh.NewOption("No sidecars in this album", -1))
+	}
+
+	var picked int
+	return runField(huh.NewSelect[int]().
+		Title(fmt.Sprintf("Planned changes in %s: %d of %d files get new dates, in place", album, updated, len(changes))).
+		Description("Modification time now → taken time. Press [enter] to go back to the plan.").
+		Options(options...).
+		Height(min(len(options)+2, 20)).
+		Value(&picked),
+	)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// recoverRenamed is set by -recover-renamed to look for the media of sidecars whose media
+// was renamed after the export, instead of reporting it missing.
+var recoverRenamed bool
+
+// claimedMedia caches the media the sidecars of each folder name, by sidecar folder.
+var claimedMedia sync.Map // folder → map[string]bool
+
+// recovered holds the renamed media already paired with a sidecar, so no file is given the
+// times of two sidecars.
+var recovered sync.Map // media path → sidecar path
+
+// claimed returns the media that the sidecars in dir name and that exist.
+func claimed(dir string) map[string]bool {
+	if names, ok := claimedMedia.Load(dir); ok {
+		return names.(map[string]bool)
+	}
+	names := make(map[string]bool)
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".json") || entry.Name() == "metadata.json" {
+			continue
+		}
+		sidecar := filepath.Join(dir, entry.Name())
+		meta, err := readTakeout(sidecar)
+		if err != nil {
+			continue
+		}
+		if path := mediaPath(sidecar, meta); fileExists(path) {
+			names[path] = true
+		}
+	}
+	claimedMedia.Store(dir, names)
+	return names
+}
+
+// fileExists reports whether a file is at path.
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// exifDates caches the dates read by exifTakenTime, since every orphaned sidecar of a
+// folder looks at the same candidates.
+var exifDates sync.Map // media path → time.Time, zero if unreadable
+
+// exifTakenTime returns the EXIF DateTimeOriginal of a JPEG or TIFF file, read as UTC since
+// EXIF dates have no zone.
+func exifTakenTime(path string) (time.Time, bool) {
+	if taken, ok := exifDates.Load(path); ok {
+		return taken.(time.Time), !taken.(time.Time).IsZero()
+	}
+	taken, ok := takeout.ExifTakenTime(path)
+	exifDates.Store(path, taken)
+	return taken, ok
+}
+
+// sameMoment reports whether an EXIF date, read as UTC, is takenTime in some time zone:
+// equal up to a whole number of quarter hours, no more than 14 hours apart.
+func sameMoment(exifDate, takenTime time.Time) bool {
+	offset := exifDate.Sub(takenTime.UTC().Truncate(time.Second))
+	if offset < 0 {
+		offset = -offset
+	}
+	return offset <= 14*time.Hour && offset%(15*time.Minute) == 0
+}
+
+// contentKey identifies a file by its size and SHA-256.
+type contentKey struct {
+	size int64
+	hash [sha256.Size]byte
+}
+
+// hashFile returns the content key of the file at path.
+func hashFile(path string, size int64) (contentKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return contentKey{}, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return contentKey{}, err
+	}
+	key := contentKey{size: size}
+	h.Sum(key.hash[:0])
+	return key, nil
+}
+
+// renamedMedia looks for the media at imagePath after it was renamed: a file in the same
+// folder that no sidecar names, of the same type, with an EXIF date matching the taken time.
+// Candidates that are identical by size and hash count as one; if more than one distinct
+// file is left the sidecar is better reported missing than paired wrongly. It returns the
+// path found and how many identical copies of it there are, or an empty path.
+func renamedMedia(jsonPath, imagePath string, takenTime time.Time) (string, int) {
+	dir := filepath.Dir(imagePath)
+	names := claimed(filepath.Dir(jsonPath))
+	ext := takeout.LooseName(filepath.Ext(imagePath))
+
+	var candidates []string
+	for _, candidate := range takeout.MediaNames(dir) {
+		path := filepath.Join(dir, candidate.Name)
+		if names[path] || !strings.HasSuffix(candidate.Key, ext) {
+			continue
+		}
+		if taken, ok := exifTakenTime(path); ok && sameMoment(taken, takenTime) {
+			candidates = append(candidates, path)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", 0
+	}
+	sort.Strings(candidates)
+
+	distinct := make(map[contentKey]bool)
+	for _, path := range candidates {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", 0
+		}
+		// A single candidate needs no hashing.
+		key := contentKey{size: info.Size()}
+		if len(candidates) > 1 {
+			if key, err = hashFile(path, info.Size()); err != nil {
+				return "", 0
+			}
+		}
+		distinct[key] = true
+	}
+	if len(distinct) > 1 {
+		return "", 0
+	}
+	if previous, taken := recovered.LoadOrStore(candidates[0], jsonPath); taken && previous != jsonPath {
+		return "", 0
+	}
+	return candidates[0], len(candidates) - 1
+}
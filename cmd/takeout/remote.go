@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/sftp"
+	"github.com/fatih/color"
+)
+
+// remote is the SFTP session of a run whose -dir is an sftp:// URL, nil otherwise.
+var remote *sftp.Client
+
+// remoteFlags are the flags a run on an sftp:// -dir can use. The others need the media on a
+// local disk, to rewrite it, read it whole or keep files next to it.
+var remoteFlags = map[string]bool{
+	"dir": true, "yes": true, "no-ui": true, "select-all": true, "force": true, "dry-run": true,
+	"strict": true, "skip-photos": true, "skip-videos": true, "exclude-state": true, "rules": true,
+	"trust": true, "report": true, "summary-out": true, "slowest": true, "workers": true,
+	"label": true, "run-id": true, "trace": true, "retry-delay": true, "memory-limit": true,
+}
+
+// isRemote reports whether -dir names an export on an SFTP server.
+func isRemote(dir string) bool {
+	return strings.HasPrefix(strings.ToLower(dir), "sftp://")
+}
+
+// unsupportedRemoteFlags returns the flags given that a run on an sftp:// -dir can't use.
+func unsupportedRemoteFlags() []string {
+	var unsupported []string
+	flag.Visit(func(f *flag.Flag) {
+		if !remoteFlags[f.Name] {
+			unsupported = append(unsupported, "-"+f.Name)
+		}
+	})
+	return unsupported
+}
+
+// dialRemote opens the SFTP session for an sftp://[user@]host[:port]/path -dir and returns
+// the path of the export on the server.
+func dialRemote(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	client, err := sftp.Dial(u)
+	if err != nil {
+		return "", err
+	}
+	root := u.Path
+	if root == "" {
+		root = "." // the login folder
+	}
+	if info, err := client.Lstat(root); err != nil || !info.IsDir() {
+		client.Close()
+		if err == nil {
+			err = fmt.Errorf("%s is not a folder", root)
+		}
+		return "", err
+	}
+	remote = client
+	return root, nil
+}
+
+// processRemote processes every sidecar below root on the SFTP server with a pool of
+// workers, walking the folders one at a time like processSidecars.
+func processRemote(root string) {
+	queue := make(chan string, workers)
+	wait := startWorkers(queue, func(jsonPath string) {
+		if runCtx.Err() != nil {
+			return
+		}
+		started := time.Now()
+		processRemoteJSON(jsonPath)
+		stats.timed(jsonPath, time.Since(started))
+		stats.finished()
+	})
+	processRemoteDir(root, queue)
+	close(queue)
+	wait()
+}
+
+// processRemoteDir queues the sidecars in dir and below on the SFTP server.
+func processRemoteDir(dir string, queue chan<- string) {
+	entries, err := remote.ReadDir(dir)
+	if err != nil {
+		color.Red("Error reading directory %s: %v\n", dir, err)
+		return
+	}
+	var found bool
+	for _, entry := range entries {
+		if runCtx.Err() != nil {
+			return
+		}
+		fullPath := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			processRemoteDir(fullPath, queue)
+		case entry.Name() == "metadata.json":
+			continue
+		case strings.HasSuffix(entry.Name(), ".json"):
+			queue <- fullPath
+		case kindOf(fullPath) != kindOther:
+			stats.sawMedia(fullPath)
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		stats.emptyFolder(dir)
+	}
+}
+
+// processRemoteJSON sets the times of the media of a sidecar on the SFTP server. Only the
+// modification and access times can be set over SFTP.
+func processRemoteJSON(jsonPath string) {
+	data, err := remote.ReadFile(jsonPath)
+	var meta *takeout.Takeout
+	if err == nil {
+		meta, err = takeout.Parse(data, strict)
+	}
+	tracef(jsonPath, "read sidecar: %v", result(err))
+	if err != nil {
+		color.Red("Error reading JSON file %s: %v\n", jsonPath, err)
+		stats.fail(jsonPath, outcomeUnreadable, "Reading JSON file", err)
+		unexpected(jsonPath, err)
+		return
+	}
+
+	imagePath, how := takeout.ResolveIn(remote, filepath.Dir(jsonPath), filepath.Base(jsonPath), meta)
+	if how != "" {
+		tracef(jsonPath, "media %s resolved from title %q, %s", imagePath, meta.Title, how)
+	} else {
+		tracef(jsonPath, "media %s resolved from title %q", imagePath, meta.Title)
+	}
+	stats.claimMedia(jsonPath, imagePath)
+	takenTime, ok := takenTimeOf(jsonPath, imagePath, meta)
+	if !ok {
+		return
+	}
+
+	info, err := remote.Lstat(imagePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		color.Red("Image file %s does not exist for metadata %s\n", imagePath, jsonPath)
+		stats.record(jsonPath, outcomeMissing)
+		unexpected(jsonPath, fmt.Errorf("media %s does not exist", imagePath))
+		return
+	}
+	if err == nil {
+		stats.format(imagePath)
+	}
+
+	if dryRun {
+		var from time.Time
+		if info != nil {
+			from = info.ModTime()
+			color.Cyan("Would set the times of %s from %s to %s\n", imagePath, from.Format(time.RFC3339), takenTime.Format(time.RFC3339))
+		} else {
+			color.Cyan("Would set the times of %s to %s\n", imagePath, takenTime.Format(time.RFC3339))
+		}
+		stats.plan(jsonPath, from, takenTime)
+		return
+	}
+
+	err = remote.Chtimes(imagePath, takenTime, takenTime)
+	tracef(jsonPath, "set modified and accessed times over SFTP: %v", result(err))
+	if err != nil {
+		color.Red("Error updating file times for %s: %v\n", imagePath, err)
+		stats.fail(jsonPath, writeFailure(err), "Updating file times", err)
+		unexpected(jsonPath, err)
+		return
+	}
+	color.Green("✓ Updated file times of %s to %s\n", imagePath, takenTime.Format(time.RFC3339))
+	stats.updated(jsonPath, takenTime)
+}
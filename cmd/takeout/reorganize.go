@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// reorganizeDir is set by -reorganize to copy, or with -reorganize-move move, every media
+// file the run updated into a folder below it laid out by reorganizeLayout from its taken
+// time, instead of the export's "Photos from 2017" folders.
+var reorganizeDir string
+
+// reorganizeMove is set by -reorganize-move to move the media instead of copying them.
+var reorganizeMove bool
+
+// reorganizeLayout is the folder below reorganizeDir each media file goes into, set by
+// -reorganize-layout. {year}, {month} and {day} are the taken date in the zone of the item's
+// location, like EXIF dates; {album} is the folder the media was in.
+var reorganizeLayout = "{year}/{month}"
+
+// layoutPlaceholder matches the placeholders of a layout.
+var layoutPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// setReorganizeLayout parses -reorganize-layout.
+func setReorganizeLayout(value string) error {
+	for _, placeholder := range layoutPlaceholder.FindAllString(value, -1) {
+		switch placeholder {
+		case "{year}", "{month}", "{day}", "{album}":
+		default:
+			return fmt.Errorf("unknown placeholder %s, expected {year}, {month}, {day} or {album}", placeholder)
+		}
+	}
+	clean := filepath.Clean(filepath.FromSlash(value))
+	if value == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return errors.New("expected a relative layout like {year}/{month}")
+	}
+	reorganizeLayout = value
+	return nil
+}
+
+// placement is a media file to put into the reorganized folders at the end of the run.
+type placement struct {
+	sidecar, media string
+	taken          time.Time // in the zone the layout's dates are taken from
+}
+
+// placements collects the media to reorganize. It is safe for concurrent use.
+var placements struct {
+	mu   sync.Mutex
+	list []placement
+}
+
+// placeLater queues the media at path for -reorganize with its taken time. A failure to
+// place it fails the sidecar at jsonPath.
+func placeLater(jsonPath, path string, meta *takeout.Takeout, takenTime time.Time) {
+	if reorganizeDir == "" {
+		return
+	}
+	placements.mu.Lock()
+	defer placements.mu.Unlock()
+	placements.list = append(placements.list, placement{sidecar: jsonPath, media: path, taken: exifLocalTime(meta, takenTime)})
+}
+
+// placeResumed queues the media an interrupted run updated for -reorganize, along with
+// its edited copies and motion videos, since that run stopped before reorganizing them.
+// Their times were set to the taken time, which they are placed by.
+func placeResumed(jsonPath, media string) {
+	if reorganizeDir == "" {
+		return
+	}
+	meta, err := takeout.Read(jsonPath, false)
+	if err != nil {
+		color.Red("Error reading %s to reorganize %s: %v\n", jsonPath, media, err)
+		stats.fail(jsonPath, outcomeUnreadable, "Reading JSON file", err)
+		return
+	}
+	paths := []string{media}
+	if withEdited {
+		paths = append(paths, editedVariants(media)...)
+	}
+	if withCompanions && !skipVideos {
+		paths = append(paths, companionVideos(jsonPath, media)...)
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // moved by -reorganize-move before the run stopped
+		}
+		if err != nil {
+			color.Red("Error reorganizing %s: %v\n", path, err)
+			stats.fail(jsonPath, writeFailure(err), "Reorganizing", err)
+			continue
+		}
+		placeLater(jsonPath, path, meta, info.ModTime())
+	}
+}
+
+// layoutFolder returns the folder below reorganizeDir the layout puts p in.
+func layoutFolder(p placement) string {
+	folder := layoutPlaceholder.ReplaceAllStringFunc(reorganizeLayout, func(placeholder string) string {
+		switch placeholder {
+		case "{year}":
+			return strconv.Itoa(p.taken.Year())
+		case "{month}":
+			return fmt.Sprintf("%02d", int(p.taken.Month()))
+		case "{day}":
+			return fmt.Sprintf("%02d", p.taken.Day())
+		}
+		return filepath.Base(filepath.Dir(p.media))
+	})
+	return filepath.Join(reorganizeDir, filepath.FromSlash(folder))
+}
+
+// reorganize copies or moves the media the run updated into the reorganized folders, with
+// the XMP sidecars written next to them. It runs after every sidecar was handled, so edited
+// copies and sidecars naming the same media all found it where the export put it. Media
+// that can't be placed fail their sidecar, so the summary and -retry pick them up.
+func reorganize() {
+	if reorganizeDir == "" {
+		return
+	}
+	placements.mu.Lock()
+	list := placements.list
+	placements.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].media < list[j].media })
+
+	verb := "copy"
+	if reorganizeMove {
+		verb = "move"
+	}
+	done := make(map[string]bool)
+	for _, p := range list {
+		if runCtx.Err() != nil {
+			return
+		}
+		if done[p.media] {
+			continue // named by more than one sidecar
+		}
+		done[p.media] = true
+		folder := layoutFolder(p)
+		if dryRun {
+			color.Cyan("Would %s %s into %s\n", verb, p.media, folder)
+			continue
+		}
+		target, err := place(p.media, folder)
+		if err != nil {
+			color.Red("Error reorganizing %s: %v\n", p.media, err)
+			stats.fail(p.sidecar, writeFailure(err), "Reorganizing", err)
+			continue
+		}
+		if target == "" {
+			continue // already there from an earlier run
+		}
+		color.Green("✓ Reorganized %s to %s\n", p.media, target)
+	}
+}
+
+// place copies or moves the media at path into folder, with the XMP sidecar written next
+// to it, and returns where it went. A file of the same name, size and modification time
+// already there is taken to be an earlier copy and leaves nothing to do, returning an
+// empty path; a different one makes the new file "name (1).ext".
+func place(path, folder string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		return "", err
+	}
+	target, err := freeName(folder, filepath.Base(path), info)
+	if target == "" || err != nil {
+		return "", err
+	}
+	if err := transfer(path, target, info); err != nil {
+		return "", err
+	}
+	if xmp := takeout.XMPPath(path); fileExists(xmp) {
+		xmpInfo, err := os.Stat(xmp)
+		if err == nil {
+			err = transfer(xmp, takeout.XMPPath(target), xmpInfo)
+		}
+		if err != nil {
+			return target, err
+		}
+	}
+	return target, nil
+}
+
+// transfer copies or, with -reorganize-move, moves the file at path to target, keeping
+// its times.
+func transfer(path, target string, info os.FileInfo) error {
+	if reorganizeMove && os.Rename(path, target) == nil {
+		takeout.RemoveMediaName(filepath.Dir(path), filepath.Base(path))
+		takeout.AddMediaName(filepath.Dir(target), filepath.Base(target))
+		return nil
+	}
+	// Renaming fails across volumes, so the file is copied and then removed.
+	if err := copyFile(path, target); err != nil {
+		return err
+	}
+	if err := timestamps.Set(target, info.ModTime()); err != nil {
+		return err
+	}
+	if reorganizeMove {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		takeout.RemoveMediaName(filepath.Dir(path), filepath.Base(path))
+	}
+	return nil
+}
+
+// freeName returns the path in folder to give a file called name, or an empty path if a
+// file of that name, size and modification time is already there.
+func freeName(folder, name string, info os.FileInfo) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 0; n < 1000; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		}
+		target := filepath.Join(folder, candidate)
+		existing, err := os.Stat(target)
+		if errors.Is(err, os.ErrNotExist) {
+			return target, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if existing.Size() == info.Size() && existing.ModTime().Equal(info.ModTime()) {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("too many files called %s in %s", name, folder)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// listTree returns every file below root keyed by its slash-separated relative path.
+func listTree(root string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// copyFile copies src to dst through a registered temporary file, creating parent
+// folders as needed and keeping the source's modification time.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := takeout.CreateTemp(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		takeout.DiscardTemp(out)
+		return err
+	}
+	if err := takeout.CommitTemp(out, dst); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// repairPlan is a file to copy from one extraction to the other.
+type repairPlan struct {
+	rel      string
+	from, to string
+	reason   string
+}
+
+// planRepair compares two extractions and decides which files to copy in each direction:
+// files present in only one of them, and media that is broken in one but intact in the other.
+func planRepair(a, b string) ([]repairPlan, error) {
+	filesA, err := listTree(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", a, err)
+	}
+	filesB, err := listTree(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", b, err)
+	}
+
+	var plans []repairPlan
+	for rel := range filesA {
+		if _, ok := filesB[rel]; !ok {
+			plans = append(plans, repairPlan{rel: rel, from: a, to: b, reason: "missing"})
+		}
+	}
+	for rel := range filesB {
+		if _, ok := filesA[rel]; !ok {
+			plans = append(plans, repairPlan{rel: rel, from: b, to: a, reason: "missing"})
+		}
+	}
+
+	// Files present in both copies are compared only when one of them is obviously broken.
+	for rel := range filesA {
+		if _, ok := filesB[rel]; !ok {
+			continue
+		}
+		pathA := filepath.Join(a, filepath.FromSlash(rel))
+		pathB := filepath.Join(b, filepath.FromSlash(rel))
+		errA, errB := takeout.CheckMedia(pathA), takeout.CheckMedia(pathB)
+		switch {
+		case errA != nil && errB == nil:
+			plans = append(plans, repairPlan{rel: rel, from: b, to: a, reason: errA.Error()})
+		case errB != nil && errA == nil:
+			plans = append(plans, repairPlan{rel: rel, from: a, to: b, reason: errB.Error()})
+		}
+	}
+
+	sort.Slice(plans, func(i, j int) bool { return plans[i].rel < plans[j].rel })
+	return plans, nil
+}
+
+// runRepair implements the "repair" command. Given two extractions of the same Takeout,
+// it copies sidecars and media missing or broken in one of them from the other.
+func runRepair(args []string) {
+	flags := flag.NewFlagSet("repair", flag.ExitOnError)
+	reportOnly := flags.Bool("report-only", false, "Only list the differences without copying anything")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: takeout repair [-report-only] <extraction A> <extraction B>")
+		flags.PrintDefaults()
+	}
+	if err := setFlagsFromEnv(flags, "TAKEOUT_REPAIR_"); err != nil {
+		color.Red("%v\n", err)
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	a, b := flags.Arg(0), flags.Arg(1)
+
+	plans, err := planRepair(a, b)
+	if err != nil {
+		color.Red("%v\n", err)
+		os.Exit(1)
+	}
+	if len(plans) == 0 {
+		color.Green("✓ %s and %s contain the same files\n", a, b)
+		return
+	}
+
+	var copied, failed int
+	for _, plan := range plans {
+		from := filepath.Join(plan.from, filepath.FromSlash(plan.rel))
+		to := filepath.Join(plan.to, filepath.FromSlash(plan.rel))
+		if *reportOnly {
+			color.Yellow("%s: only usable in %s (%s in %s)\n", plan.rel, plan.from, plan.reason, plan.to)
+			continue
+		}
+		if err := copyFile(from, to); err != nil {
+			color.Red("Error copying %s to %s: %v\n", from, to, err)
+			failed++
+			continue
+		}
+		color.Green("✓ Copied %s to %s (%s)\n", plan.rel, plan.to, plan.reason)
+		copied++
+	}
+
+	if *reportOnly {
+		fmt.Printf("%d files differ between %s and %s\n", len(plans), a, b)
+		return
+	}
+	fmt.Printf("Copied %d files, %d failed\n", copied, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Report is the machine-readable summary written by -summary-out with a .json extension.
+// Files maps each sidecar, relative to Root and slash-separated, to its outcome.
+type Report struct {
+	RunID   string             `json:"runId,omitempty"`
+	Root    string             `json:"root"`
+	Started time.Time          `json:"started"`
+	Labels  []string           `json:"labels,omitempty"`
+	Counts  map[outcome]int    `json:"counts"`
+	Files   map[string]outcome `json:"files"`
+	Slowest []timedFile        `json:"slowest,omitempty"`
+	// Conflicts holds the sidecars whose timestamp and formatted time disagree, by sidecar like Files.
+	Conflicts map[string]timeConflict `json:"conflicts,omitempty"`
+	// Future holds the taken times of the sidecars dated in the future, by sidecar like Files.
+	Future map[string]time.Time `json:"future,omitempty"`
+	// Planned holds the times a -dry-run would have set, by sidecar like Files.
+	Planned map[string]plannedTimes `json:"planned,omitempty"`
+	// EmptyFolders lists the folders that held no sidecar, media or folder, relative to Root.
+	EmptyFolders []string `json:"emptyFolders,omitempty"`
+}
+
+// report builds the Report of the run. The caller must hold s.mu.
+func (s *summary) report(root string) Report {
+	files := make(map[string]outcome, len(s.files))
+	for path, o := range s.files {
+		files[relativeTo(root, path)] = o
+	}
+	counts := make(map[outcome]int, len(s.counts))
+	for o, n := range s.counts {
+		counts[o] = n
+	}
+	slowest := make([]timedFile, len(s.slowest))
+	for i, file := range s.slowest {
+		slowest[i] = timedFile{Path: relativeTo(root, file.Path), Duration: file.Duration}
+	}
+	var planned map[string]plannedTimes
+	if len(s.planned) > 0 {
+		planned = make(map[string]plannedTimes, len(s.planned))
+		for path, times := range s.planned {
+			planned[relativeTo(root, path)] = times
+		}
+	}
+	var conflicts map[string]timeConflict
+	if len(s.conflicts) > 0 {
+		conflicts = make(map[string]timeConflict, len(s.conflicts))
+		for path, c := range s.conflicts {
+			conflicts[relativeTo(root, path)] = c
+		}
+	}
+	var future map[string]time.Time
+	if len(s.future) > 0 {
+		future = make(map[string]time.Time, len(s.future))
+		for path, taken := range s.future {
+			future[relativeTo(root, path)] = taken
+		}
+	}
+	var empty []string
+	for _, folder := range s.emptyFolders() {
+		empty = append(empty, relativeTo(root, folder))
+	}
+	return Report{RunID: runID, Root: root, Started: s.started, Labels: labels, Counts: counts, Files: files, Slowest: slowest, Conflicts: conflicts, Future: future, Planned: planned, EmptyFolders: empty}
+}
+
+// relativeTo returns path relative to root and slash-separated, or path itself if it isn't below root.
+func relativeTo(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// readReport loads a report previously written with -summary-out.
+func readReport(path string) (*Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open report %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var report Report
+	if err := json.NewDecoder(file).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// succeeded reports whether o leaves the media with the right times.
+func succeeded(o outcome) bool {
+	return o == outcomeUpdated || o == outcomeUnchanged
+}
+
+// failed reports whether o needs attention.
+func failed(o outcome) bool {
+	switch o {
+	case outcomeMissing, outcomeNeverExported, outcomeBroken, outcomeUnsupported, outcomeDenied, outcomeUnreadable, outcomeFailed:
+		return true
+	}
+	return false
+}
+
+// reportChanges groups the sidecars whose outcome changed between two reports.
+type reportChanges struct {
+	fixed, failing, resolved, other []string
+}
+
+// diffReports compares the outcome of every sidecar in from and to.
+func diffReports(from, to *Report) reportChanges {
+	paths := make(map[string]bool, len(to.Files))
+	for path := range from.Files {
+		paths[path] = true
+	}
+	for path := range to.Files {
+		paths[path] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var changes reportChanges
+	for _, path := range sorted {
+		before, hadBefore := from.Files[path]
+		after, hasAfter := to.Files[path]
+		switch {
+		case before == after:
+		case (before == outcomeMissing || before == outcomeNeverExported) && hasAfter && !failed(after):
+			changes.resolved = append(changes.resolved, path)
+		case failed(before) && succeeded(after):
+			changes.fixed = append(changes.fixed, path)
+		case failed(after) && (!hadBefore || !failed(before)):
+			changes.failing = append(changes.failing, fmt.Sprintf("%s (%s)", path, after))
+		default:
+			changes.other = append(changes.other, fmt.Sprintf("%s: %s → %s", path, describeOutcome(before, hadBefore), describeOutcome(after, hasAfter)))
+		}
+	}
+	return changes
+}
+
+// describeOutcome names an outcome for the diff, or notes that the sidecar wasn't in the report.
+func describeOutcome(o outcome, ok bool) string {
+	if !ok {
+		return "not in report"
+	}
+	return string(o)
+}
+
+// runReport implements the "report" command. "report diff <old> <new>" compares two
+// JSON reports written with -summary-out.
+func runReport(args []string) {
+	if len(args) != 3 || args[0] != "diff" {
+		fmt.Fprintln(os.Stderr, "usage: takeout report diff <old report.json> <new report.json>")
+		os.Exit(2)
+	}
+
+	from, err := readReport(args[1])
+	if err != nil {
+		color.Red("%v\n", err)
+		os.Exit(1)
+	}
+	to, err := readReport(args[2])
+	if err != nil {
+		color.Red("%v\n", err)
+		os.Exit(1)
+	}
+
+	if from.RunID != "" || to.RunID != "" {
+		fmt.Printf("Comparing run %s with run %s\n\n", cmp.Or(from.RunID, "unknown"), cmp.Or(to.RunID, "unknown"))
+	}
+	changes := diffReports(from, to)
+	groups := []struct {
+		title string
+		paths []string
+		print func(format string, a ...interface{})
+	}{
+		{"Newly fixed", changes.fixed, color.Green},
+		{"Resolved missing files", changes.resolved, color.Green},
+		{"Newly failing", changes.failing, color.Red},
+		{"Otherwise changed", changes.other, color.Yellow},
+	}
+	for _, group := range groups {
+		if len(group.paths) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", group.title, len(group.paths))
+		for _, path := range group.paths {
+			group.print("  %s\n", path)
+		}
+	}
+
+	fmt.Println()
+	for _, o := range outcomes {
+		if from.Counts[o] == 0 && to.Counts[o] == 0 {
+			continue
+		}
+		fmt.Printf("%-26s %6d → %d\n", o, from.Counts[o], to.Counts[o])
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/ellypaws/takeout"
+)
+
+// resolvedMapping is how media listed in the -mapping file is reported by resolveMedia.
+const resolvedMapping = "paired by the -mapping file"
+
+// mediaPath determines the image file by using the Title field (assumed to be the image filename),
+// allowing for the truncation and renaming the media file may have gone through.
+func mediaPath(jsonPath string, meta *takeout.Takeout) string {
+	path, _ := resolveMedia(jsonPath, meta)
+	return path
+}
+
+// resolveMedia finds the media the sidecar at jsonPath describes, as paired by the -mapping
+// file or found by takeout.Resolve in the sidecar's media folder. It returns how the file was
+// found, empty if the title names it exactly.
+func resolveMedia(jsonPath string, meta *takeout.Takeout) (path, how string) {
+	if media, ok := mappedMedia(jsonPath); ok {
+		return media, resolvedMapping
+	}
+	return takeout.Resolve(mediaFolder(filepath.Dir(jsonPath)), filepath.Base(jsonPath), meta)
+}
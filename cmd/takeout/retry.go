@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// retryDelay is the pause before the first retry pass, set by -retry-delay, giving scanners
+// time to let go of the files. Every further pass waits twice as long as the one before, and
+// a fifth of the pause is waited between the retried sidecars. Zero disables the passes.
+var retryDelay = 5 * time.Second
+
+// retryAttempts is the number of retry passes, set by -retry-attempts.
+var retryAttempts = 3
+
+// retryTransient runs the sidecars that failed with a transient error again, one at a time
+// and with pauses, once the rest of the run is done, backing off between passes while some
+// still fail that way. Most files locked by an antivirus scanner or a sync client during
+// the run are free again by then.
+func retryTransient() {
+	delay := retryDelay
+	for attempt := 1; attempt <= retryAttempts; attempt++ {
+		jsonPaths := stats.takeTransient()
+		if len(jsonPaths) == 0 || retryDelay <= 0 || runCtx.Err() != nil {
+			return
+		}
+		color.Yellow("Retrying %d files that were locked or busy in %s (attempt %d of %d)\n", len(jsonPaths), delay, attempt, retryAttempts)
+		time.Sleep(delay)
+
+		var fixed int
+		for i, jsonPath := range jsonPaths {
+			if runCtx.Err() != nil {
+				break
+			}
+			if i > 0 {
+				time.Sleep(delay / 5)
+			}
+			tracef(jsonPath, "retrying after a transient failure, attempt %d", attempt)
+			stats.forget(jsonPath)
+			processJSON(jsonPath)
+			if progress != nil {
+				progress.record(jsonPath, stats.handled(jsonPath))
+			}
+			if !failed(stats.outcomeOf(jsonPath)) {
+				fixed++
+			}
+		}
+		color.Yellow("Retry pass fixed %d of %d files\n", fixed, len(jsonPaths))
+		delay *= 2
+	}
+}
+
+// failuresName is the file in the root folder listing the sidecars that still failed at the
+// end of a run, for -retry to process again later.
+const failuresName = "takeout-failures.json"
+
+// failureList is the contents of the failures file.
+type failureList struct {
+	RunID    string         `json:"runId"`
+	Root     string         `json:"root"`
+	Failures []failureEntry `json:"failures"`
+}
+
+// failureEntry is a sidecar that failed, relative to the root and slash-separated.
+type failureEntry struct {
+	Sidecar string  `json:"sidecar"`
+	Media   string  `json:"media,omitempty"`
+	Outcome outcome `json:"outcome"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// failureList returns the sidecars that ended the run failed, sorted by sidecar.
+func (s *summary) failureList(root string) failureList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := failureList{RunID: runID, Root: root}
+	for path, o := range s.files {
+		if !failed(o) {
+			continue
+		}
+		entry := failureEntry{Sidecar: relativeTo(root, path), Outcome: o, Reason: s.details[path]}
+		if media, ok := s.media[path]; ok {
+			entry.Media = relativeTo(root, media)
+		}
+		list.Failures = append(list.Failures, entry)
+	}
+	sort.Slice(list.Failures, func(i, j int) bool { return list.Failures[i].Sidecar < list.Failures[j].Sidecar })
+	return list
+}
+
+// writeFailures writes the sidecars that still failed into the failures file in root and
+// returns its path. When none did, a -retry run removes the file it retried; other runs may
+// have covered only some of the folders, so they leave it.
+func writeFailures(root, retried string) (string, error) {
+	path := filepath.Join(root, failuresName)
+	list := stats.failureList(root)
+	if len(list.Failures) == 0 {
+		if retried == "" {
+			return "", nil
+		}
+		if err := os.Remove(retried); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		return "", nil
+	}
+	err := takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// readFailures reads a failures file for -retry, returning its root and the absolute paths
+// of its sidecars.
+func readFailures(path string) (string, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	var list failureList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return "", nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if list.Root == "" {
+		return "", nil, fmt.Errorf("%s names no root folder", path)
+	}
+	sidecars := make([]string, 0, len(list.Failures))
+	for _, entry := range list.Failures {
+		sidecar := filepath.FromSlash(entry.Sidecar)
+		if !filepath.IsAbs(sidecar) {
+			sidecar = filepath.Join(list.Root, sidecar)
+		}
+		sidecars = append(sidecars, sidecar)
+	}
+	return list.Root, sidecars, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// rule is one line of the rules file, e.g. "when: origin=partner and year<2015 then: skip".
+// The first rule whose conditions all hold decides what happens to an item.
+type rule struct {
+	line       int
+	source     string
+	conditions []condition
+	skip       bool
+	// timeSource picks the sidecar time to stamp: "taken", "creation" or "modified".
+	timeSource string
+}
+
+// condition compares one fact about an item with a value.
+type condition struct {
+	field, op, value string
+}
+
+// rules are the rules loaded from the rules file, in file order.
+var rules []rule
+
+// ruleOps are the comparison operators, longest first so "<=" isn't read as "<".
+// "~" matches the value as a glob.
+var ruleOps = []string{"!=", "<=", ">=", "=", "<", ">", "~"}
+
+// ruleFields lists the facts a condition can test.
+var ruleFields = map[string]bool{
+	"origin": true, "device": true, "year": true, "month": true, "ext": true, "kind": true,
+	"name": true, "album": true, "favorited": true, "archived": true, "trashed": true, "locked": true,
+	"description": true,
+}
+
+// defaultRulesPath returns the rules file used when -rules isn't given.
+func defaultRulesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "takeout", "rules.txt"), nil
+}
+
+// loadRules reads the rules file at path. Blank lines and lines starting with # are ignored.
+// A missing file is only an error if required is set.
+func loadRules(path string, required bool) ([]rule, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var loaded []rule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r, err := parseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		r.line = line
+		loaded = append(loaded, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return loaded, nil
+}
+
+// parseRule parses a single "when: <conditions> then: <actions>" rule. Conditions are
+// joined with "and"; actions are separated by commas.
+func parseRule(text string) (rule, error) {
+	lower := strings.ToLower(text)
+	if !strings.HasPrefix(lower, "when:") {
+		return rule{}, errors.New(`expected a rule starting with "when:"`)
+	}
+	then := strings.Index(lower, " then:")
+	if then < 0 {
+		return rule{}, errors.New(`expected "then:" after the conditions`)
+	}
+
+	r := rule{source: text}
+	for _, part := range splitWord(text[len("when:"):then], "and") {
+		c, err := parseCondition(part)
+		if err != nil {
+			return rule{}, err
+		}
+		r.conditions = append(r.conditions, c)
+	}
+
+	for _, action := range strings.Split(text[then+len(" then:"):], ",") {
+		action = strings.TrimSpace(action)
+		name, value, _ := strings.Cut(action, "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "skip":
+			r.skip = true
+		case "time":
+			switch value = strings.ToLower(strings.TrimSpace(value)); value {
+			case "taken", "creation", "modified":
+				r.timeSource = value
+			default:
+				return rule{}, fmt.Errorf("unknown time source %q, expected taken, creation or modified", value)
+			}
+		case "route":
+			return rule{}, errors.New("the route action isn't supported: use -reorganize to copy the media into folders by date")
+		case "tag":
+			return rule{}, errors.New("the tag action isn't supported: rules can only skip items or pick the time stamped")
+		default:
+			return rule{}, fmt.Errorf("unknown action %q", action)
+		}
+	}
+	return r, nil
+}
+
+// splitWord splits s around the standalone word sep, case-insensitively.
+func splitWord(s, sep string) []string {
+	var parts, current []string
+	for _, field := range strings.Fields(s) {
+		if strings.EqualFold(field, sep) {
+			parts = append(parts, strings.Join(current, " "))
+			current = nil
+			continue
+		}
+		current = append(current, field)
+	}
+	return append(parts, strings.Join(current, " "))
+}
+
+func parseCondition(text string) (condition, error) {
+	for _, op := range ruleOps {
+		field, value, ok := strings.Cut(text, op)
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ruleFields[field] {
+			return condition{}, fmt.Errorf("unknown field %q", field)
+		}
+		return condition{field: field, op: op, value: strings.TrimSpace(value)}, nil
+	}
+	return condition{}, fmt.Errorf("expected a comparison like year<2015, got %q", text)
+}
+
+// ruleFacts returns the facts conditions are tested against for an item.
+func ruleFacts(meta *takeout.Takeout, imagePath string, takenTime time.Time) map[string]string {
+	kind := ""
+	switch kindOf(imagePath) {
+	case kindPhoto:
+		kind = "photo"
+	case kindVideo:
+		kind = "video"
+	}
+	return map[string]string{
+		"origin":      meta.GooglePhotosOrigin.Kind(),
+		"device":      meta.GooglePhotosOrigin.MobileUpload.DeviceType,
+		"year":        strconv.Itoa(takenTime.Year()),
+		"month":       strconv.Itoa(int(takenTime.Month())),
+		"ext":         strings.TrimPrefix(strings.ToLower(filepath.Ext(imagePath)), "."),
+		"kind":        kind,
+		"name":        filepath.Base(imagePath),
+		"album":       filepath.Base(filepath.Dir(imagePath)),
+		"favorited":   strconv.FormatBool(meta.Favorited),
+		"archived":    strconv.FormatBool(meta.Archived),
+		"trashed":     strconv.FormatBool(meta.Trashed),
+		"locked":      strconv.FormatBool(meta.InLockedFolder),
+		"description": meta.Description,
+	}
+}
+
+// holds reports whether the condition holds for the fact. Values that are both
+// numbers are compared numerically, anything else as case-insensitive text.
+func (c condition) holds(fact string) bool {
+	if c.op == "~" {
+		ok, _ := filepath.Match(strings.ToLower(c.value), strings.ToLower(fact))
+		return ok
+	}
+
+	var cmp int
+	a, errA := strconv.Atoi(fact)
+	b, errB := strconv.Atoi(c.value)
+	if errA == nil && errB == nil {
+		cmp = a - b
+	} else {
+		cmp = strings.Compare(strings.ToLower(fact), strings.ToLower(c.value))
+	}
+
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// matchRule returns the first rule whose conditions all hold for the item, or nil.
+func matchRule(meta *takeout.Takeout, imagePath string, takenTime time.Time) *rule {
+	if len(rules) == 0 {
+		return nil
+	}
+	facts := ruleFacts(meta, imagePath, takenTime)
+	for i := range rules {
+		matched := true
+		for _, c := range rules[i].conditions {
+			if !c.holds(facts[c.field]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// sourceTime returns the sidecar time the rule stamps instead of photoTakenTime.
+func (r *rule) sourceTime(meta *takeout.Takeout) (time.Time, error) {
+	switch r.timeSource {
+	case "creation":
+		return meta.CreationTime.Time()
+	case "modified":
+		return meta.PhotoLastModifiedTime.Time()
+	}
+	return meta.PhotoTakenTime.Time()
+}
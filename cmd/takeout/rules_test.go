@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want rule
+	}{
+		{"when: origin=partner then: skip", rule{conditions: []condition{{"origin", "=", "partner"}}, skip: true}},
+		{"when: year<2015 and ext=mp4 then: time=creation", rule{conditions: []condition{{"year", "<", "2015"}, {"ext", "=", "mp4"}}, timeSource: "creation"}},
+		{"WHEN: Year <= 2015 AND name ~ IMG_* THEN: Time = Modified, skip", rule{conditions: []condition{{"year", "<=", "2015"}, {"name", "~", "IMG_*"}}, skip: true, timeSource: "modified"}},
+		{"when: album!=Trash and month>=6 then: time=taken", rule{conditions: []condition{{"album", "!=", "Trash"}, {"month", ">=", "6"}}, timeSource: "taken"}},
+		// "and" only joins conditions as a word of its own.
+		{"when: description=sandy beach then: skip", rule{conditions: []condition{{"description", "=", "sandy beach"}}, skip: true}},
+	} {
+		got, err := parseRule(test.text)
+		if err != nil {
+			t.Errorf("parseRule(%q): %v", test.text, err)
+			continue
+		}
+		test.want.source = test.text
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseRule(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseRuleRejects(t *testing.T) {
+	for _, test := range []struct {
+		text, err string // part of the error
+	}{
+		{"origin=partner then: skip", `starting with "when:"`},
+		{"when: origin=partner skip", `expected "then:"`},
+		{"when: color=red then: skip", `unknown field "color"`},
+		{"when: year then: skip", "expected a comparison"},
+		{"when: year<2015 and then: skip", "expected a comparison"},
+		{"when: year<2015 then: time=uploaded", `unknown time source "uploaded"`},
+		{"when: year<2015 then: delete", `unknown action "delete"`},
+		{"when: year<2015 then: skip,", `unknown action ""`},
+		{"when: origin=partner then: route=Partner", "use -reorganize"},
+		{"when: origin=partner then: tag=partner", "the tag action isn't supported"},
+	} {
+		_, err := parseRule(test.text)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseRule(%q) returned %v, want an error with %q", test.text, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// runID identifies the current run in its summary, report, snapshot, checkpoint and log
+// lines, so that the artifacts of overlapping runs on the same tree can be told apart.
+// It is generated at startup unless given with -run-id.
+var runID = newRunID(time.Now())
+
+// runIDPattern is what a run ID given with -run-id may contain, keeping it usable in file
+// names and log lines.
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// newRunID returns a run ID made of the start time and a random suffix, e.g.
+// "20190714T024000-3f9a2c".
+func newRunID(now time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// setRunID sets the run ID from -run-id, e.g. to match the ID of a scheduler's own logs.
+func setRunID(value string) error {
+	if !runIDPattern.MatchString(value) {
+		return fmt.Errorf("run IDs may only hold letters, digits, '.', '_' and '-', got %q", value)
+	}
+	runID = value
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// runInstallSchedule is only implemented for Task Scheduler on Windows.
+func runInstallSchedule(args []string) {
+	fmt.Fprintf(os.Stderr, "install-schedule isn't supported on %s yet\n", runtime.GOOS)
+	os.Exit(1)
+}
+
+// runUninstallSchedule is only implemented for Task Scheduler on Windows.
+func runUninstallSchedule(args []string) {
+	fmt.Fprintf(os.Stderr, "uninstall-schedule isn't supported on %s yet\n", runtime.GOOS)
+	os.Exit(1)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// defaultTaskName is the Task Scheduler name used when -name isn't given.
+const defaultTaskName = "Google Takeout timestamps"
+
+// scheduleTypes maps -every to the schtasks schedule type.
+var scheduleTypes = map[string]string{
+	"hourly": "HOURLY",
+	"daily":  "DAILY",
+	"weekly": "WEEKLY",
+}
+
+// taskCommand returns the command line the scheduled task runs: this executable on dir,
+// unattended, followed by any extra flags. Arguments are quoted for the Windows command line.
+func taskCommand(exe, dir string, extra []string) string {
+	args := append([]string{exe, "-dir", dir, "-select-all", "-force"}, extra...)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteArg quotes arg for the Windows command line if it contains spaces or quotes.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"") {
+		return arg
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+}
+
+// schtasks runs schtasks.exe with args, passing its output through.
+func schtasks(args ...string) error {
+	cmd := exec.Command("schtasks", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// runInstallSchedule implements the "install-schedule" command. It registers a scheduled
+// task that periodically processes a watch folder. Flags after -- are passed to each run.
+func runInstallSchedule(args []string) {
+	flags := flag.NewFlagSet("install-schedule", flag.ExitOnError)
+	name := flags.String("name", defaultTaskName, "Name of the scheduled task")
+	dir := flags.String("dir", "", "Watch folder to process on every run")
+	every := flags.String("every", "daily", "How often to run: hourly, daily or weekly")
+	at := flags.String("at", "03:00", "Local time of the first run, e.g. 03:00")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: takeout install-schedule -dir <folder> [-name <task>] [-every daily] [-at 03:00] [-- <flags for each run>]")
+		flags.PrintDefaults()
+	}
+	if err := setFlagsFromEnv(flags, "TAKEOUT_SCHEDULE_"); err != nil {
+		color.Red("%v\n", err)
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if *dir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	schedule, ok := scheduleTypes[strings.ToLower(*every)]
+	if !ok {
+		color.Red("Unknown -every %q, expected hourly, daily or weekly\n", *every)
+		os.Exit(2)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Error locating the executable: %v\n", err)
+	}
+	folder, err := filepath.Abs(*dir)
+	if err != nil {
+		log.Fatalf("Error determining absolute path: %v\n", err)
+	}
+
+	command := taskCommand(exe, folder, flags.Args())
+	if err := schtasks("/Create", "/F", "/TN", *name, "/TR", command, "/SC", schedule, "/ST", *at); err != nil {
+		color.Red("Error registering scheduled task %q: %v\n", *name, err)
+		os.Exit(1)
+	}
+	color.Green("✓ Scheduled %q to run %s: %s\n", *name, strings.ToLower(*every), command)
+}
+
+// runUninstallSchedule implements the "uninstall-schedule" command, removing the task
+// registered by install-schedule.
+func runUninstallSchedule(args []string) {
+	flags := flag.NewFlagSet("uninstall-schedule", flag.ExitOnError)
+	name := flags.String("name", defaultTaskName, "Name of the scheduled task")
+	flags.Parse(args)
+
+	if err := schtasks("/Delete", "/F", "/TN", *name); err != nil {
+		color.Red("Error removing scheduled task %q: %v\n", *name, err)
+		os.Exit(1)
+	}
+	color.Green("✓ Removed scheduled task %q\n", *name)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ellypaws/takeout"
+)
+
+// selection is the album selection last made for a root folder. Known lists every album
+// offered at the time, so albums added to the export since then can default to selected.
+type selection struct {
+	Selected []string `json:"selected"`
+	Known    []string `json:"known"`
+}
+
+// preselected reports whether album should start checked in the folder picker.
+func (s selection) preselected(album string) bool {
+	for _, known := range s.Known {
+		if known == album {
+			for _, selected := range s.Selected {
+				if selected == album {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// selectionsPath returns where the last selection per root is stored.
+func selectionsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "takeout", "selections.json"), nil
+}
+
+// loadSelections reads the remembered selections keyed by absolute root folder.
+// A missing file means nothing has been remembered yet.
+func loadSelections() (map[string]selection, error) {
+	path, err := selectionsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	selections := make(map[string]selection)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return selections, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &selections); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return selections, nil
+}
+
+// rememberSelection stores the albums selected under root for the next run.
+func rememberSelection(root string, selected, known []string) error {
+	selections, err := loadSelections()
+	if err != nil {
+		return err
+	}
+	selections[root] = selection{Selected: selected, Known: known}
+
+	path, err := selectionsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(selections, "", "  ")
+	if err != nil {
+		return err
+	}
+	return takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runInstallShell is only available for the Windows Explorer context menu.
+func runInstallShell(args []string) {
+	fmt.Fprintln(os.Stderr, "install-shell only supports the Windows Explorer context menu")
+	os.Exit(1)
+}
+
+// runUninstallShell is only available for the Windows Explorer context menu.
+func runUninstallShell(args []string) {
+	fmt.Fprintln(os.Stderr, "uninstall-shell only supports the Windows Explorer context menu")
+	os.Exit(1)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"golang.org/x/sys/windows/registry"
+)
+
+// shellVerb is the registry key name of the Explorer context-menu entry.
+const shellVerb = "TakeoutFix"
+
+// shellMenus are the per-user context menus the entry is added to: right-clicking a folder
+// passes it as %1, right-clicking the background of an open folder passes it as %V.
+var shellMenus = map[string]string{
+	`Software\Classes\Directory\shell\` + shellVerb:            "%1",
+	`Software\Classes\Directory\Background\shell\` + shellVerb: "%V",
+}
+
+// shellCommand returns the command the context-menu entry runs for the folder placeholder.
+// It runs unattended in a console that stays open so the results can be read.
+func shellCommand(exe, placeholder string) string {
+	return fmt.Sprintf(`cmd.exe /k ""%s" -dir "%s" -select-all"`, exe, placeholder)
+}
+
+// runInstallShell implements the "install-shell" command, adding a "Fix Google Takeout
+// metadata here" entry to the Explorer context menu of folders for the current user.
+func runInstallShell(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: takeout install-shell")
+		os.Exit(2)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		color.Red("Error locating the executable: %v\n", err)
+		os.Exit(1)
+	}
+
+	for path, placeholder := range shellMenus {
+		if err := installShellVerb(path, exe, placeholder); err != nil {
+			color.Red("Error adding the context-menu entry: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	color.Green("✓ Added \"Fix Google Takeout metadata here\" to the folder context menu\n")
+}
+
+func installShellVerb(path, exe, placeholder string) error {
+	verb, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer verb.Close()
+	if err := verb.SetStringValue("", "Fix Google Takeout metadata here"); err != nil {
+		return err
+	}
+	if err := verb.SetStringValue("Icon", exe); err != nil {
+		return err
+	}
+
+	command, _, err := registry.CreateKey(verb, "command", registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf(`failed to create %s\command: %w`, path, err)
+	}
+	defer command.Close()
+	return command.SetStringValue("", shellCommand(exe, placeholder))
+}
+
+// runUninstallShell implements the "uninstall-shell" command, removing the entry added by install-shell.
+func runUninstallShell(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: takeout uninstall-shell")
+		os.Exit(2)
+	}
+
+	for path := range shellMenus {
+		for _, key := range []string{path + `\command`, path} {
+			if err := registry.DeleteKey(registry.CURRENT_USER, key); err != nil && !errors.Is(err, registry.ErrNotExist) {
+				color.Red("Error removing %s: %v\n", key, err)
+				os.Exit(1)
+			}
+		}
+	}
+	color.Green("✓ Removed the folder context-menu entry\n")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarRoot is set by -sidecar-root for exports whose sidecars were moved into a tree
+// of their own that mirrors the media tree. Empty when sidecars sit next to their media.
+var sidecarRoot string
+
+// sidecarFolder returns the folder holding the sidecars of the media folder below root.
+func sidecarFolder(root, folder string) string {
+	if sidecarRoot == "" {
+		return folder
+	}
+	rel, err := filepath.Rel(root, folder)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return folder
+	}
+	return filepath.Join(sidecarRoot, rel)
+}
+
+// mediaFolder returns the folder holding the media of the sidecars in dir, the same path
+// below exportRoot as dir is below the sidecar root.
+func mediaFolder(dir string) string {
+	if sidecarRoot == "" || exportRoot == "" {
+		return dir
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	rel, err := filepath.Rel(sidecarRoot, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return dir
+	}
+	return filepath.Join(exportRoot, rel)
+}
+
+// sawMediaIn records the media in the media folder dir and below for the summary. With
+// -sidecar-root the walk of the sidecar tree never meets the media, so its folders are walked
+// on their own; parent holds the .takeoutignore rules of the mirrored folders above dir.
+func sawMediaIn(root, dir string, parent *ignoreList) {
+	ignores := parent.load(sidecarFolder(root, dir))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Error reading directory %s: %v\n", dir, err)
+		return
+	}
+	for _, entry := range entries {
+		if runCtx.Err() != nil {
+			return
+		}
+		fullPath := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			if !ignores.ignored(sidecarFolder(root, fullPath), true) {
+				sawMediaIn(root, fullPath, ignores)
+			}
+		case kindOf(fullPath) != kindOther && !ignores.ignored(sidecarFolder(root, fullPath), false):
+			stats.sawMedia(fullPath)
+		}
+	}
+}
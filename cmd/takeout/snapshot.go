@@ -0,0 +1,379 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// Snapshot is a manifest of every media file below Root at a point in time.
+// FileSystem is the filesystem of the volume holding Root, e.g. "NTFS" or "exFAT", and
+// AccessTimes how it updates access times, as in volume.AccessTimes.
+type Snapshot struct {
+	RunID       string          `json:"runId,omitempty"`
+	Root        string          `json:"root"`
+	Taken       time.Time       `json:"taken"`
+	Labels      []string        `json:"labels,omitempty"`
+	FileSystem  string          `json:"fileSystem,omitempty"`
+	AccessTimes string          `json:"accessTimes,omitempty"`
+	Files       []SnapshotEntry `json:"files"`
+}
+
+// SnapshotEntry records the size, content hash and times of a single media file.
+// Path is relative to the snapshot root. PathHint keeps the directories the sidecar
+// title carried from the original upload, once a run has seen the sidecar. Width, Height
+// and Duration, in seconds for videos, are read from the headers of the formats takeout.Probe knows.
+type SnapshotEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+	Modified time.Time `json:"modified"`
+	Accessed time.Time `json:"accessed"`
+	Created  time.Time `json:"created"`
+	PathHint string    `json:"pathHint,omitempty"`
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+	Duration float64   `json:"duration,omitempty"`
+}
+
+// snapshotPaths derives the before and after manifest paths from the --snapshot value,
+// e.g. "snapshot.json" becomes "snapshot.before.json" and "snapshot.after.json".
+func snapshotPaths(path string) (before, after string) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		ext = ".json"
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return base + ".before" + ext, base + ".after" + ext
+}
+
+// takeSnapshot walks the given folders and records every media file (anything that isn't
+// a .json sidecar or excluded by a .takeoutignore) into a Snapshot relative to root. Files are hashed concurrently, largest
+// first, so the run doesn't end with one worker hashing the biggest videos alone.
+func takeSnapshot(root string, folders []string) (*Snapshot, error) {
+	var paths []string
+	sizes := make(map[string]int64)
+	for _, folder := range folders {
+		ignores := map[string]*ignoreList{filepath.Dir(folder): ignoresAbove(root, folder)}
+		err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			parent := ignores[filepath.Dir(path)]
+			if d.IsDir() {
+				if parent.ignored(path, true) {
+					return filepath.SkipDir
+				}
+				ignores[path] = parent.load(path)
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), ".json") || d.Name() == ignoreName || parent.ignored(path, false) {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				sizes[path] = info.Size()
+			}
+			paths = append(paths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", folder, err)
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return sizes[paths[i]] > sizes[paths[j]] })
+
+	entries := make([]SnapshotEntry, len(paths))
+	errs := make([]error, len(paths))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, runtime.NumCPU())
+	for i, path := range paths {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, path string) {
+			defer wg.Done()
+			entries[i], errs[i] = snapshotFile(root, path)
+			<-semaphore
+		}(i, path)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	vol := volumeOf(root)
+	return &Snapshot{RunID: runID, Root: root, Taken: time.Now(), Labels: labels, FileSystem: vol.FileSystem, AccessTimes: vol.AccessTimes, Files: entries}, nil
+}
+
+// snapshotFile stats and hashes a single file. The times are read before hashing,
+// since reading the content may bump the access time.
+func snapshotFile(root, path string) (SnapshotEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return SnapshotEntry{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	accessed, created := timestamps.FileTimes(info)
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return SnapshotEntry{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return SnapshotEntry{}, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	// Media whose headers can't be read is recorded without its size.
+	size, _ := takeout.Probe(path)
+	return SnapshotEntry{
+		Path:     filepath.ToSlash(rel),
+		Size:     info.Size(),
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+		Modified: info.ModTime(),
+		Accessed: accessed,
+		Created:  created,
+		PathHint: stats.hint(path),
+		Width:    size.Width,
+		Height:   size.Height,
+		Duration: size.Duration.Seconds(),
+	}, nil
+}
+
+// writeSnapshot takes a snapshot of the folders and writes it to path.
+func writeSnapshot(path, root string, folders []string) error {
+	snapshot, err := takeSnapshot(root, folders)
+	if err != nil {
+		return err
+	}
+
+	err = takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %w", path, err)
+	}
+
+	color.Green("✓ Recorded %d files to %s\n", len(snapshot.Files), path)
+	return nil
+}
+
+// readSnapshot loads a snapshot previously written by writeSnapshot.
+func readSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(file).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// diffSnapshots prints every file that was added, removed or changed between
+// the from and to snapshots, listing which properties changed.
+// It returns the number of differences found.
+func diffSnapshots(from, to *Snapshot) int {
+	within := fileSystemGranularity(from.FileSystem).coarser(fileSystemGranularity(to.FileSystem))
+	if within != (granularity{}) {
+		fmt.Printf("Treating times as equal within the precision of %s and %s\n", from.FileSystem, to.FileSystem)
+	}
+	// Access times on volumes that don't update them strictly say nothing about the file:
+	// they are either stale or moved by the snapshot's own reads.
+	switch cmp.Or(from.AccessTimes, to.AccessTimes) {
+	case accessDisabled:
+		within.ignoreAccessed = true
+		fmt.Println("Not comparing access times: the volume has last-access updates disabled")
+	case accessRelative:
+		within.ignoreAccessed = true
+		fmt.Println("Not comparing access times: the volume only updates them on some reads (relatime)")
+	}
+
+	oldFiles := make(map[string]SnapshotEntry, len(from.Files))
+	for _, entry := range from.Files {
+		oldFiles[entry.Path] = entry
+	}
+
+	var differences int
+	for _, entry := range to.Files {
+		before, ok := oldFiles[entry.Path]
+		delete(oldFiles, entry.Path)
+		if !ok {
+			color.Green("+ %s\n", entry.Path)
+			differences++
+			continue
+		}
+
+		changes := entryChanges(before, entry, within)
+		if len(changes) == 0 {
+			continue
+		}
+		color.Yellow("~ %s\n", entry.Path)
+		for _, change := range changes {
+			fmt.Printf("    %s\n", change)
+		}
+		differences++
+	}
+
+	removed := make([]string, 0, len(oldFiles))
+	for path := range oldFiles {
+		removed = append(removed, path)
+	}
+	sort.Strings(removed)
+	for _, path := range removed {
+		color.Red("- %s\n", path)
+		differences++
+	}
+
+	return differences
+}
+
+// granularity is how precisely a filesystem keeps each of the file times.
+// With ignoreAccessed set, access times aren't compared at all.
+type granularity struct {
+	modified, accessed, created time.Duration
+	ignoreAccessed              bool
+}
+
+// fileSystemGranularity returns the documented time precision of a filesystem. NTFS and
+// unknown filesystems keep times to 100ns, which snapshots record exactly, so they return zero.
+func fileSystemGranularity(fileSystem string) granularity {
+	switch strings.ToUpper(fileSystem) {
+	case "FAT", "FAT32":
+		return granularity{modified: 2 * time.Second, accessed: 24 * time.Hour, created: 10 * time.Millisecond}
+	case "EXFAT":
+		return granularity{modified: 10 * time.Millisecond, accessed: 2 * time.Second, created: 10 * time.Millisecond}
+	}
+	return granularity{}
+}
+
+// coarser returns the coarser precision of g and o for each time.
+func (g granularity) coarser(o granularity) granularity {
+	return granularity{
+		modified: max(g.modified, o.modified),
+		accessed: max(g.accessed, o.accessed),
+		created:  max(g.created, o.created),
+	}
+}
+
+// sameTime reports whether a and b are equal to within the given precision.
+func sameTime(a, b time.Time, within time.Duration) bool {
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	return a.Equal(b) || d < within
+}
+
+// entryChanges describes each property that differs between two entries of the same file.
+// Times that only differ within the filesystem's precision are considered equal.
+func entryChanges(before, after SnapshotEntry, within granularity) []string {
+	var changes []string
+	if before.Size != after.Size {
+		changes = append(changes, fmt.Sprintf("size:     %d → %d", before.Size, after.Size))
+	}
+	if before.SHA256 != after.SHA256 {
+		changes = append(changes, fmt.Sprintf("sha256:   %s → %s", before.SHA256, after.SHA256))
+	}
+	if !sameTime(before.Modified, after.Modified, within.modified) {
+		changes = append(changes, fmt.Sprintf("modified: %s → %s", before.Modified.Format(time.RFC3339), after.Modified.Format(time.RFC3339)))
+	}
+	if !within.ignoreAccessed && !sameTime(before.Accessed, after.Accessed, within.accessed) {
+		changes = append(changes, fmt.Sprintf("accessed: %s → %s", before.Accessed.Format(time.RFC3339), after.Accessed.Format(time.RFC3339)))
+	}
+	if !sameTime(before.Created, after.Created, within.created) {
+		changes = append(changes, fmt.Sprintf("created:  %s → %s", before.Created.Format(time.RFC3339), after.Created.Format(time.RFC3339)))
+	}
+	return changes
+}
+
+// runDiff implements the "diff" command, comparing two snapshot files.
+func runDiff(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: takeout diff <old snapshot> <new snapshot>")
+		os.Exit(2)
+	}
+
+	from, err := readSnapshot(args[0])
+	if err != nil {
+		color.Red("%v\n", err)
+		os.Exit(1)
+	}
+	to, err := readSnapshot(args[1])
+	if err != nil {
+		color.Red("%v\n", err)
+		os.Exit(1)
+	}
+
+	differences := diffSnapshots(from, to)
+	if differences == 0 {
+		color.Green("✓ No differences between %s and %s\n", args[0], args[1])
+		return
+	}
+	fmt.Printf("%d of %d files differ\n", differences, len(to.Files))
+}
+
+// inventory indexes a previous snapshot so an incremental run can skip
+// media that hasn't changed since it was taken.
+type inventory struct {
+	root  string
+	files map[string]SnapshotEntry
+}
+
+// loadInventory reads the snapshot at path for use with -since.
+func loadInventory(path string) (*inventory, error) {
+	snapshot, err := readSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]SnapshotEntry, len(snapshot.Files))
+	for _, entry := range snapshot.Files {
+		files[entry.Path] = entry
+	}
+	return &inventory{root: snapshot.Root, files: files}, nil
+}
+
+// unchanged reports whether the media at path has the same size and modification time
+// as when the snapshot was taken. Files missing from the snapshot are new and never unchanged.
+func (inv *inventory) unchanged(path string, info os.FileInfo) bool {
+	rel, err := filepath.Rel(inv.root, path)
+	if err != nil {
+		return false
+	}
+	entry, ok := inv.files[filepath.ToSlash(rel)]
+	if !ok {
+		return false
+	}
+	return entry.Size == info.Size() && entry.Modified.Equal(info.ModTime())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ellypaws/takeout"
+)
+
+// readPathList reads one sidecar or media path per line, as produced by `find` or `rg --files`,
+// and returns the sidecar paths to process. Media paths are mapped to their sidecar by sidecarOf.
+// Blank lines are ignored and duplicates are only returned once.
+func readPathList(r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	var sidecars []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		sidecar := line
+		if !strings.HasSuffix(strings.ToLower(line), ".json") {
+			sidecar = sidecarOf(line)
+		}
+		sidecar, err := filepath.Abs(sidecar)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", line, err)
+		}
+
+		if !seen[sidecar] {
+			seen[sidecar] = true
+			sidecars = append(sidecars, sidecar)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read path list: %w", err)
+	}
+	return sidecars, nil
+}
+
+// sidecarNames are the names a media file's sidecar may have, in the order they are looked for.
+var sidecarNames = []string{"%s.json", "%s.supplemental-metadata.json"}
+
+// sidecarOf returns the sidecar of the media at path: "<media>.json", or the
+// "<media>.supplemental-metadata.json" of newer exports if only that exists. Sidecars whose
+// supplemental suffix was cut short, like "<media>.suppl.json", are looked for in the
+// media's folder last.
+func sidecarOf(path string) string {
+	for _, format := range sidecarNames {
+		if sidecar := fmt.Sprintf(format, path); fileExists(sidecar) {
+			return sidecar
+		}
+	}
+	dir, name := filepath.Split(path)
+	if entries, err := os.ReadDir(filepath.Clean(dir)); err == nil {
+		for _, entry := range entries {
+			if media, ok := takeout.SidecarMedia(entry.Name()); ok && !entry.IsDir() && media == name {
+				return filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+	return path + ".json"
+}
+
+// listedMedia resolves the media file of each listed sidecar, skipping sidecars that can't be read
+// and media that doesn't exist. It is used to limit snapshots to the files a --stdin run touches.
+func listedMedia(sidecars []string) []string {
+	media := make([]string, 0, len(sidecars))
+	for _, sidecar := range sidecars {
+		meta, err := readTakeout(sidecar)
+		if err != nil {
+			continue
+		}
+		path := mediaPath(sidecar, meta)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		media = append(media, path)
+	}
+	return media
+}
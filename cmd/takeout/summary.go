@@ -0,0 +1,655 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// outcome is the result of processing a single sidecar.
+type outcome string
+
+const (
+	outcomeUpdated       outcome = "Updated"
+	outcomePlanned       outcome = "Would update"
+	outcomeUnchanged     outcome = "Unchanged since snapshot"
+	outcomeDuplicate     outcome = "Duplicate"
+	outcomePhotos        outcome = "Skipped photos"
+	outcomeVideos        outcome = "Skipped videos"
+	outcomeUnknownType   outcome = "Skipped unknown types"
+	outcomeExcluded      outcome = "Excluded by state"
+	outcomeRuled         outcome = "Skipped by rule"
+	outcomeFiltered      outcome = "Filtered out"
+	outcomeFuture        outcome = "Dated in the future"
+	outcomeMissing       outcome = "Media missing"
+	outcomeNeverExported outcome = "Media never exported"
+	outcomeBroken        outcome = "Broken media"
+	outcomeUnsupported   outcome = "Unknown media type"
+	outcomeDenied        outcome = "Permission denied"
+	outcomeUnreadable    outcome = "Unreadable sidecar"
+	outcomeFailed        outcome = "Failed"
+)
+
+// outcomes lists every outcome in the order they are reported.
+var outcomes = []outcome{outcomeUpdated, outcomePlanned, outcomeUnchanged, outcomeDuplicate, outcomePhotos, outcomeVideos, outcomeUnknownType, outcomeExcluded, outcomeRuled, outcomeFiltered, outcomeFuture, outcomeMissing, outcomeNeverExported, outcomeBroken, outcomeUnsupported, outcomeDenied, outcomeUnreadable, outcomeFailed}
+
+// summary collects the outcome of every processed sidecar for the end-of-run summary.
+// It is safe for concurrent use.
+type summary struct {
+	mu        sync.Mutex
+	started   time.Time
+	counts    map[outcome]int
+	years     map[int]int
+	reasons   map[string]int
+	albums    []sharedAlbum
+	hints     map[string]string
+	files     map[string]outcome
+	formats   map[string]int
+	slowest   []timedFile
+	planned   map[string]plannedTimes
+	media     map[string]string            // media resolved for each sidecar
+	details   map[string]string            // why each failed sidecar failed
+	found     map[string]bool              // media files seen while walking the folders
+	claimed   map[string]bool              // media files some sidecar resolved to
+	conflicts map[string]timeConflict      // sidecars whose timestamp and formatted time disagree
+	future    map[string]time.Time         // sidecars taken in the future, by their taken time
+	empty     []string                     // folders walked that held no sidecar, media or folder
+	sizes     map[string]takeout.MediaSize // size of each sidecar's media, measured for -report
+	// transient lists the sidecars that failed with an error worth retrying at the end.
+	transient []string
+	// finishedCount and failures are what the progress view shows: how many sidecars were
+	// handled so far and the failures of the sidecars still failed, in the order they
+	// happened. noted counts every failure noted, including those a retry fixed since.
+	finishedCount int
+	failures      []failureNote
+	noted         int
+}
+
+// failureNote is a sidecar that failed and why, as the progress view prints it. seq is its
+// place among every failure noted.
+type failureNote struct {
+	path, reason string
+	seq          int
+}
+
+// note adds the failure of the sidecar at jsonPath to the progress view. The caller must
+// hold s.mu.
+func (s *summary) note(jsonPath, reason string) {
+	s.failures = append(s.failures, failureNote{jsonPath, reason, s.noted})
+	s.noted++
+}
+
+// plannedTimes are the times a -dry-run would have changed a sidecar's media from and to.
+// From is zero if the media's current time couldn't be read.
+type plannedTimes struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// timedFile is how long handling a single sidecar took.
+type timedFile struct {
+	Path     string        `json:"path"`
+	Duration time.Duration `json:"duration"`
+}
+
+// slowestLimit is the number of slowest sidecars kept for the summary, set by -slowest.
+var slowestLimit = 10
+
+// stats is the summary of the current run.
+var stats = newSummary()
+
+func newSummary() *summary {
+	return &summary{
+		started:   time.Now(),
+		counts:    make(map[outcome]int),
+		years:     make(map[int]int),
+		reasons:   make(map[string]int),
+		hints:     make(map[string]string),
+		files:     make(map[string]outcome),
+		formats:   make(map[string]int),
+		planned:   make(map[string]plannedTimes),
+		media:     make(map[string]string),
+		details:   make(map[string]string),
+		found:     make(map[string]bool),
+		claimed:   make(map[string]bool),
+		conflicts: make(map[string]timeConflict),
+		future:    make(map[string]time.Time),
+		sizes:     make(map[string]takeout.MediaSize),
+	}
+}
+
+// updated records a sidecar whose media's times were set to takenTime.
+func (s *summary) updated(jsonPath string, takenTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[outcomeUpdated]++
+	s.files[jsonPath] = outcomeUpdated
+	s.years[takenTime.Year()]++
+}
+
+// plan records a sidecar whose media's times a -dry-run would have changed.
+func (s *summary) plan(jsonPath string, from, to time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[outcomePlanned]++
+	s.files[jsonPath] = outcomePlanned
+	s.planned[jsonPath] = plannedTimes{From: from, To: to}
+}
+
+// record counts a sidecar that ended with o.
+func (s *summary) record(jsonPath string, o outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[o]++
+	s.files[jsonPath] = o
+	if failed(o) {
+		s.note(jsonPath, string(o))
+	}
+}
+
+// duplicate counts a sidecar whose media has the same content as original, which -dedupe
+// handled instead.
+func (s *summary) duplicate(jsonPath, original string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[outcomeDuplicate]++
+	s.files[jsonPath] = outcomeDuplicate
+	s.details[jsonPath] = "same content as " + original
+}
+
+// fail counts a sidecar that failed with err. The reason is grouped without
+// the file path so that identical failures across files add up.
+func (s *summary) fail(jsonPath string, o outcome, action string, err error) {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Steps after the sidecar's own, such as -reorganize, fail sidecars that already have an
+	// outcome, which the failure replaces.
+	s.dropOutcome(jsonPath)
+	s.counts[o]++
+	s.files[jsonPath] = o
+	reason := fmt.Sprintf("%s: %v", action, err)
+	s.reasons[reason]++
+	s.details[jsonPath] = reason
+	s.note(jsonPath, reason)
+	if transient(err) {
+		s.transient = append(s.transient, jsonPath)
+	}
+}
+
+// finished counts a sidecar the run is done with, whatever its outcome.
+func (s *summary) finished() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finishedCount++
+}
+
+// progressSince returns how many sidecars were handled and are failed so far, the failures
+// noted since the first since ones that still stand, and how many were noted in all.
+func (s *summary) progressSince(since int) (handled, failures int, recent []failureNote, noted int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := len(s.failures)
+	for first > 0 && s.failures[first-1].seq >= since {
+		first--
+	}
+	recent = append(recent, s.failures[first:]...)
+	return s.finishedCount, len(s.failures), recent, s.noted
+}
+
+// throughput returns how many sidecars were handled so far and how many of them failed with
+// a transient error, for -workers auto.
+func (s *summary) throughput() (handled, transient int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finishedCount, len(s.transient)
+}
+
+// takeTransient returns the sidecars that failed with a transient error so far, sorted,
+// and clears the list.
+func (s *summary) takeTransient() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jsonPaths := s.transient
+	s.transient = nil
+	sort.Strings(jsonPaths)
+	return jsonPaths
+}
+
+// forget drops the outcome recorded for jsonPath before it is processed again.
+func (s *summary) forget(jsonPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropOutcome(jsonPath)
+}
+
+// dropOutcome removes the outcome recorded for jsonPath from the counts, and its failure
+// from the progress view. The caller must hold s.mu.
+func (s *summary) dropOutcome(jsonPath string) {
+	o, ok := s.files[jsonPath]
+	if !ok {
+		return
+	}
+	s.counts[o]--
+	delete(s.files, jsonPath)
+	s.failures = slices.DeleteFunc(s.failures, func(f failureNote) bool { return f.path == jsonPath })
+	if reason, ok := s.details[jsonPath]; ok {
+		if s.reasons[reason]--; s.reasons[reason] <= 0 {
+			delete(s.reasons, reason)
+		}
+		delete(s.details, jsonPath)
+	}
+}
+
+// outcomeOf returns the outcome recorded for jsonPath.
+func (s *summary) outcomeOf(jsonPath string) outcome {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[jsonPath]
+}
+
+// handled returns the outcome and media of the sidecar at jsonPath, for the checkpoint.
+func (s *summary) handled(jsonPath string) handledSidecar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return handledSidecar{outcome: s.files[jsonPath], media: s.media[jsonPath]}
+}
+
+// measured records the size of the sidecar's media.
+func (s *summary) measured(jsonPath string, size takeout.MediaSize) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sizes[jsonPath] = size
+}
+
+// conflict records a sidecar whose timestamp and formatted time disagree.
+func (s *summary) conflict(jsonPath string, c timeConflict) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conflicts[jsonPath] = c
+}
+
+// conflictTable lists the sidecars whose timestamp and formatted time disagree.
+func (s *summary) conflictTable(root string) table {
+	conflicts := table{title: "Timestamp conflicts", header: []string{"Sidecar", "Timestamp", "Formatted", "Used"}}
+	paths := make([]string, 0, len(s.conflicts))
+	for path := range s.conflicts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		c := s.conflicts[path]
+		conflicts.rows = append(conflicts.rows, []string{relativeTo(root, path), c.Timestamp.UTC().Format(time.DateTime), c.Formatted.UTC().Format(time.DateTime), c.used().UTC().Format(time.DateTime)})
+	}
+	return conflicts
+}
+
+// futureDate records a sidecar whose taken time is in the future.
+func (s *summary) futureDate(jsonPath string, taken time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.future[jsonPath] = taken
+}
+
+// futureTable lists the sidecars taken in the future and what -future did with them.
+func (s *summary) futureTable(root string) table {
+	future := table{title: "Future dates", header: []string{"Sidecar", "Taken", "Handled"}}
+	paths := make([]string, 0, len(s.future))
+	for path := range s.future {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		future.rows = append(future.rows, []string{relativeTo(root, path), s.future[path].UTC().Format(time.DateTime), futurePolicy})
+	}
+	return future
+}
+
+// sawMedia records a media file found while walking the folders, to report it if no
+// sidecar resolves to it.
+func (s *summary) sawMedia(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.found[path] = true
+}
+
+// claimMedia records that the sidecar at jsonPath resolved to media. Media claimed
+// along with another sidecar's media, such as edited copies, pass an empty jsonPath.
+func (s *summary) claimMedia(jsonPath, media string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if jsonPath != "" {
+		s.media[jsonPath] = media
+	}
+	s.claimed[media] = true
+}
+
+// emptyFolder records a folder found while walking that held no sidecar, media or folder
+// to walk, such as an album Google exported without its photos.
+func (s *summary) emptyFolder(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.empty = append(s.empty, path)
+}
+
+// emptyFolders returns the empty folders found while walking, sorted. The caller must hold s.mu.
+func (s *summary) emptyFolders() []string {
+	empty := append([]string(nil), s.empty...)
+	sort.Strings(empty)
+	return empty
+}
+
+// orphans returns the media found while walking the folders that no sidecar resolved
+// to, sorted. The caller must hold s.mu.
+func (s *summary) orphans() []string {
+	var orphans []string
+	for path := range s.found {
+		if !s.claimed[path] {
+			orphans = append(orphans, path)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// sharedAlbum records an album that was shared on Google Photos.
+func (s *summary) sharedAlbum(album sharedAlbum) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.albums = append(s.albums, album)
+}
+
+// sharedAlbums returns the shared albums sorted by title.
+func (s *summary) sharedAlbums() []sharedAlbum {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	albums := append([]sharedAlbum(nil), s.albums...)
+	sort.Slice(albums, func(i, j int) bool { return albums[i].Title < albums[j].Title })
+	return albums
+}
+
+// timed records how long handling jsonPath took, keeping only the slowest sidecars.
+func (s *summary) timed(jsonPath string, d time.Duration) {
+	if slowestLimit <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.slowest) >= slowestLimit && d <= s.slowest[len(s.slowest)-1].Duration {
+		return
+	}
+	i := sort.Search(len(s.slowest), func(i int) bool { return s.slowest[i].Duration < d })
+	s.slowest = append(s.slowest, timedFile{})
+	copy(s.slowest[i+1:], s.slowest[i:])
+	s.slowest[i] = timedFile{Path: jsonPath, Duration: d}
+	if len(s.slowest) > slowestLimit {
+		s.slowest = s.slowest[:slowestLimit]
+	}
+}
+
+// format counts a processed media file by its extension.
+func (s *summary) format(media string) {
+	ext := strings.ToLower(filepath.Ext(media))
+	if ext == "" {
+		ext = "(none)"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.formats[ext]++
+}
+
+// pathHint records the directories the sidecar title of media carried from the original upload.
+func (s *summary) pathHint(media, hint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hints[media] = hint
+}
+
+// hint returns the path hint recorded for media, if any.
+func (s *summary) hint(media string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hints[media]
+}
+
+// writeFailure returns the outcome for a failed write: permission problems are
+// reported separately since they need elevation or ACL changes rather than a retry.
+func writeFailure(err error) outcome {
+	if errors.Is(err, fs.ErrPermission) {
+		return outcomeDenied
+	}
+	return outcomeFailed
+}
+
+// yearRows returns the updated counts per year in chronological order.
+func (s *summary) yearRows() [][2]int {
+	rows := make([][2]int, 0, len(s.years))
+	for year, count := range s.years {
+		rows = append(rows, [2]int{year, count})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return rows
+}
+
+// reasonRows returns the most common failure reasons first, at most limit of them.
+func (s *summary) reasonRows(limit int) []string {
+	reasons := make([]string, 0, len(s.reasons))
+	for reason := range s.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if s.reasons[reasons[i]] != s.reasons[reasons[j]] {
+			return s.reasons[reasons[i]] > s.reasons[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	if len(reasons) > limit {
+		reasons = reasons[:limit]
+	}
+	return reasons
+}
+
+// plannedTable lists the changes of a -dry-run by media, in local time.
+func (s *summary) plannedTable(root string) table {
+	planned := table{title: "Planned changes", header: []string{"Sidecar", "Modified now", "Would be"}}
+	paths := make([]string, 0, len(s.planned))
+	for path := range s.planned {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		times := s.planned[path]
+		from := "unknown"
+		if !times.From.IsZero() {
+			from = times.From.Local().Format(time.DateTime)
+		}
+		planned.rows = append(planned.rows, []string{relativeTo(root, path), from, times.To.Local().Format(time.DateTime)})
+	}
+	return planned
+}
+
+// bar renders count as a bar of up to width blocks relative to most.
+func bar(count, most, width int) string {
+	if most == 0 {
+		return ""
+	}
+	n := count * width / most
+	if n == 0 && count > 0 {
+		n = 1
+	}
+	return strings.Repeat("█", n)
+}
+
+// table is a simple header + rows table rendered as Markdown or HTML.
+type table struct {
+	title  string
+	header []string
+	rows   [][]string
+}
+
+// writeSummary writes a summary of the run to path. Paths ending in .html or .htm are
+// written as HTML, .json as a Report that `takeout report diff` can compare, and anything
+// else as Markdown.
+func (s *summary) writeSummary(path, root string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := table{title: "Totals", header: []string{"Outcome", "Files"}}
+	for _, o := range outcomes {
+		totals.rows = append(totals.rows, []string{string(o), fmt.Sprint(s.counts[o])})
+	}
+
+	years := table{title: "Updated by year", header: []string{"Year", "Files", ""}}
+	rows := s.yearRows()
+	var most int
+	for _, row := range rows {
+		most = max(most, row[1])
+	}
+	for _, row := range rows {
+		years.rows = append(years.rows, []string{fmt.Sprint(row[0]), fmt.Sprint(row[1]), bar(row[1], most, 40)})
+	}
+
+	reasons := table{title: "Top error reasons", header: []string{"Reason", "Files"}}
+	for _, reason := range s.reasonRows(10) {
+		reasons.rows = append(reasons.rows, []string{reason, fmt.Sprint(s.reasons[reason])})
+	}
+
+	shared := table{title: "Shared albums", header: []string{"Album", "Link access", "Shared with"}}
+	albums := append([]sharedAlbum(nil), s.albums...)
+	sort.Slice(albums, func(i, j int) bool { return albums[i].Title < albums[j].Title })
+	for _, album := range albums {
+		shared.rows = append(shared.rows, []string{album.Title, album.Access, strings.Join(album.Contributors, ", ")})
+	}
+
+	formats := table{title: "Formats", header: []string{"Extension", "Files", "Support"}}
+	exts := make([]string, 0, len(s.formats))
+	for ext := range s.formats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		formats.rows = append(formats.rows, []string{ext, fmt.Sprint(s.formats[ext]), capability(ext)})
+	}
+
+	slow := table{title: "Slowest files", header: []string{"Sidecar", "Duration", "Outcome"}}
+	for _, file := range s.slowest {
+		slow.rows = append(slow.rows, []string{relativeTo(root, file.Path), file.Duration.Round(time.Millisecond).String(), string(s.files[file.Path])})
+	}
+
+	empty := table{title: "Empty folders", header: []string{"Folder"}}
+	for _, folder := range s.emptyFolders() {
+		empty.rows = append(empty.rows, []string{relativeTo(root, folder)})
+	}
+
+	vols := table{title: "Volumes", header: []string{"Volume", "File system", "Notes"}, rows: volumeRows()}
+
+	tables := []table{totals, years, reasons, s.conflictTable(root), s.futureTable(root), shared, empty, formats, slow, vols}
+	if dryRun {
+		tables = append(tables, s.plannedTable(root))
+	}
+	details := []string{
+		fmt.Sprintf("Run ID: %s", runID),
+		fmt.Sprintf("Folder: %s", root),
+		fmt.Sprintf("Started: %s", s.started.Format(time.RFC1123)),
+		fmt.Sprintf("Duration: %s", time.Since(s.started).Round(time.Second)),
+	}
+	if len(labels) > 0 {
+		details = append(details, fmt.Sprintf("Labels: %s", strings.Join(labels, ", ")))
+	}
+
+	var out string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err := json.MarshalIndent(s.report(root), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode summary: %w", err)
+		}
+		out = string(data) + "\n"
+	case ".html", ".htm":
+		out = summaryHTML(details, tables)
+	default:
+		out = summaryMarkdown(details, tables)
+	}
+	err := takeout.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, out)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write summary %s: %w", path, err)
+	}
+	return nil
+}
+
+func summaryMarkdown(details []string, tables []table) string {
+	var b strings.Builder
+	b.WriteString("# Google Takeout migration summary\n\n")
+	for _, detail := range details {
+		fmt.Fprintf(&b, "- %s\n", detail)
+	}
+	for _, t := range tables {
+		fmt.Fprintf(&b, "\n## %s\n\n", t.title)
+		if len(t.rows) == 0 {
+			b.WriteString("None\n")
+			continue
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(t.header, " | "))
+		b.WriteString("|" + strings.Repeat(" --- |", len(t.header)) + "\n")
+		for _, row := range t.rows {
+			escaped := make([]string, len(row))
+			for i, cell := range row {
+				escaped[i] = strings.ReplaceAll(cell, "|", `\|`)
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(escaped, " | "))
+		}
+	}
+	return b.String()
+}
+
+func summaryHTML(details []string, tables []table) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Google Takeout migration summary</title>\n")
+	b.WriteString("<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}</style>\n")
+	b.WriteString("</head>\n<body>\n<h1>Google Takeout migration summary</h1>\n<ul>\n")
+	for _, detail := range details {
+		fmt.Fprintf(&b, "<li>%s</li>\n", html.EscapeString(detail))
+	}
+	b.WriteString("</ul>\n")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(t.title))
+		if len(t.rows) == 0 {
+			b.WriteString("<p>None</p>\n")
+			continue
+		}
+		b.WriteString("<table>\n<tr>")
+		for _, cell := range t.header {
+			fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(cell))
+		}
+		b.WriteString("</tr>\n")
+		for _, row := range t.rows {
+			b.WriteString("<tr>")
+			for _, cell := range row {
+				fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(cell))
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestForgetDropsFailureFromProgress(t *testing.T) {
+	s := newSummary()
+	s.fail("a.json", outcomeFailed, "Updating file times", errors.New("locked"))
+	s.fail("b.json", outcomeFailed, "Updating file times", errors.New("locked"))
+	_, _, _, seen := s.progressSince(0)
+
+	// A retry fixes a.json, and c.json fails after it.
+	s.forget("a.json")
+	s.record("a.json", outcomeUpdated)
+	s.fail("c.json", outcomeFailed, "Updating file times", errors.New("locked"))
+
+	_, failures, recent, noted := s.progressSince(seen)
+	if failures != 2 {
+		t.Errorf("progress shows %d failures, want 2", failures)
+	}
+	if len(recent) != 1 || recent[0].path != "c.json" {
+		t.Errorf("progress prints %v, want only c.json", recent)
+	}
+	if noted != 3 {
+		t.Errorf("noted %d failures, want 3", noted)
+	}
+	if s.counts[outcomeFailed] != 2 || s.counts[outcomeUpdated] != 1 {
+		t.Errorf("counts %v, want 2 failed and 1 updated", s.counts)
+	}
+}
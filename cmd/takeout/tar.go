@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// mediaArchive receives the corrected media of a run that writes them into archives
+// instead of changing the originals.
+type mediaArchive interface {
+	// addMedia adds the media at imagePath with the taken time and the metadata changes
+	// the run asks for.
+	addMedia(imagePath string, meta *takeout.Takeout, takenTime time.Time) error
+	// close finishes the archive, keeping it only if complete is set.
+	close(complete bool) error
+}
+
+// tarPath is the tar archive the corrected media is written into, set by -output-tar, or
+// "-" for stdout.
+var tarPath string
+
+// archive receives the corrected media of a run with -output-tar or -package-by-year,
+// nil otherwise.
+var archive mediaArchive
+
+// correctedMedia returns the media at imagePath with the EXIF and IPTC changes -exif, -gps,
+// -iptc and -captions ask for, written by the handler of its format, or nil if the file is
+// to be archived as it is. complete reports whether the media holds all of the changes, as
+// for files edited in place.
+func correctedMedia(imagePath string, meta *takeout.Takeout, takenTime time.Time) (data []byte, complete bool, err error) {
+	requested, ok := requestedEdit(meta, takenTime)
+	if !ok || unknownType(imagePath) {
+		return nil, false, nil
+	}
+	var out bytes.Buffer
+	complete, err = takeout.HandlerFor(imagePath).EditTo(&out, imagePath, requested)
+	if errors.Is(err, takeout.ErrUnsupported) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return out.Bytes(), complete, nil
+}
+
+// tarArchive writes corrected media into a tar archive, leaving the originals untouched.
+// It is safe for concurrent use; every entry is written whole before the next starts.
+type tarArchive struct {
+	mu   sync.Mutex
+	w    *tar.Writer
+	root string
+	file *os.File // the temporary file behind the archive, nil when writing to stdout
+	path string
+}
+
+// openArchive starts a tar archive at path, or on stdout for "-". Entries are named
+// relative to root.
+func openArchive(path, root string) (*tarArchive, error) {
+	a := &tarArchive{root: root, path: path}
+	if path == "-" {
+		a.w = tar.NewWriter(os.Stdout)
+		return a, nil
+	}
+	file, err := takeout.CreateTemp(path)
+	if err != nil {
+		return nil, err
+	}
+	a.file, a.w = file, tar.NewWriter(file)
+	return a, nil
+}
+
+// addMedia adds the media at imagePath with the taken time as its modification time,
+// and with the EXIF and IPTC changes -exif, -gps and -iptc ask for. The XMP sidecar
+// -xmp asks for, or the location of formats without writable EXIF, is added as an entry.
+func (a *tarArchive) addMedia(imagePath string, meta *takeout.Takeout, takenTime time.Time) error {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return err
+	}
+	name := relativeTo(a.root, imagePath)
+
+	data, embedded, err := correctedMedia(imagePath, meta, takenTime)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	header := &tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		ModTime: takenTime,
+		Size:    info.Size(),
+	}
+	if data != nil {
+		header.Size = int64(len(data))
+	}
+	if err := a.w.WriteHeader(header); err != nil {
+		return err
+	}
+	if data != nil {
+		_, err = a.w.Write(data)
+	} else {
+		err = a.copyFile(imagePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if xmp := xmpFor(meta, takenTime, embedded); xmp != "" && !unknownType(imagePath) {
+		header := &tar.Header{Name: takeout.XMPPath(name), Mode: 0o644, ModTime: takenTime, Size: int64(len(xmp))}
+		if err := a.w.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.WriteString(a.w, xmp)
+	}
+	return err
+}
+
+// copyFile streams the file at path into the current entry.
+func (a *tarArchive) copyFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(a.w, file)
+	return err
+}
+
+// close finishes the archive. An archive file is only moved into place if it is complete,
+// otherwise it is discarded.
+func (a *tarArchive) close(complete bool) error {
+	err := a.w.Close()
+	if a.file == nil {
+		return err
+	}
+	if err != nil || !complete {
+		takeout.DiscardTemp(a.file)
+		return err
+	}
+	if err := takeout.CommitTemp(a.file, a.path); err != nil {
+		return fmt.Errorf("failed to write archive %s: %w", a.path, err)
+	}
+	return nil
+}
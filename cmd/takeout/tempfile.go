@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// tempRegistry returns the directory where every temporary file the current process
+// creates is registered, one marker file per temporary file, grouped by process ID.
+func tempRegistry(pid int) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "takeout", "temp", strconv.Itoa(pid)), nil
+}
+
+// tempMarker returns the registry marker for the temporary file at path.
+func tempMarker(pid int, path string) (string, error) {
+	registry, err := tempRegistry(pid)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(path))
+	return filepath.Join(registry, hex.EncodeToString(sum[:])), nil
+}
+
+// tempMarkers is the takeout.TempRegistry of the tool: a marker file per temporary file in
+// the registry of the process, so cleanOrphanedTemp can remove what a crashed run left behind.
+type tempMarkers struct{}
+
+func (tempMarkers) Register(name string) error {
+	marker, err := tempMarker(os.Getpid(), name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(marker, []byte(name), 0o644)
+}
+
+func (tempMarkers) Unregister(name string) {
+	if marker, err := tempMarker(os.Getpid(), name); err == nil {
+		os.Remove(marker)
+	}
+}
+
+// cleanOrphanedTemp removes the temporary files registered by processes that are
+// no longer running, and returns the paths it removed.
+func cleanOrphanedTemp() ([]string, error) {
+	registry, err := tempRegistry(os.Getpid())
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Dir(registry)
+
+	pids, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range pids {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+
+		dir := filepath.Join(root, entry.Name())
+		markers, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, marker := range markers {
+			name, err := os.ReadFile(filepath.Join(dir, marker.Name()))
+			if err != nil {
+				continue
+			}
+			path := string(name)
+			if err := os.Remove(path); err == nil {
+				removed = append(removed, path)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+	return removed, nil
+}
+
+// findTempFiles lists leftover temporary files below dir, including unregistered
+// ones from versions or runs whose registry was lost.
+func findTempFiles(dir string) ([]string, error) {
+	var found []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), takeout.TempSuffix) {
+			found = append(found, path)
+		}
+		return nil
+	})
+	return found, err
+}
+
+// runCleanTemp implements the "clean-temp" command. It removes the registered orphans
+// of crashed runs and any leftover temporary files below the given folders.
+func runCleanTemp(args []string) {
+	removed, err := cleanOrphanedTemp()
+	if err != nil {
+		color.Red("Error cleaning registered temporary files: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range removed {
+		color.Green("✓ Removed %s\n", path)
+	}
+
+	for _, dir := range args {
+		leftovers, err := findTempFiles(dir)
+		if err != nil {
+			color.Red("Error searching %s: %v\n", dir, err)
+			continue
+		}
+		for _, path := range leftovers {
+			if err := os.Remove(path); err != nil {
+				color.Red("Error removing %s: %v\n", path, err)
+				continue
+			}
+			removed = append(removed, path)
+			color.Green("✓ Removed %s\n", path)
+		}
+	}
+
+	if len(removed) == 0 {
+		color.Green("✓ No temporary files left behind\n")
+	}
+}
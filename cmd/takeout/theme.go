@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// uiTheme is the look of the dialogs, set by -theme: "auto" follows the terminal's dark or
+// light background, "dark" and "light" assume one, and "plain" uses no colors.
+var uiTheme = "auto"
+
+// setTheme parses -theme.
+func setTheme(value string) error {
+	switch value {
+	case "auto", "plain":
+	case "dark", "light":
+		lipgloss.SetHasDarkBackground(value == "dark")
+	default:
+		return fmt.Errorf("unknown theme %q, expected auto, dark, light or plain", value)
+	}
+	uiTheme = value
+	return nil
+}
+
+// formTheme returns the huh theme for -theme. The colors of the default theme adapt to
+// the background lipgloss detects or -theme sets.
+func formTheme() *huh.Theme {
+	if uiTheme == "plain" {
+		return huh.ThemeBase()
+	}
+	return huh.ThemeCharm()
+}
+
+// keyMap is the key bindings of the dialogs, with the changes of the keys file applied.
+var keyMap = huh.NewDefaultKeyMap()
+
+// keyActions are the actions the keys file can rebind, each to the bindings of every
+// kind of field it moves or answers.
+func keyActions(m *huh.KeyMap) map[string][]*key.Binding {
+	return map[string][]*key.Binding{
+		"up":         {&m.Select.Up, &m.MultiSelect.Up},
+		"down":       {&m.Select.Down, &m.MultiSelect.Down},
+		"top":        {&m.Select.GotoTop, &m.MultiSelect.GotoTop},
+		"bottom":     {&m.Select.GotoBottom, &m.MultiSelect.GotoBottom},
+		"toggle":     {&m.MultiSelect.Toggle},
+		"select-all": {&m.MultiSelect.SelectAll, &m.MultiSelect.SelectNone},
+		"filter":     {&m.Select.Filter, &m.MultiSelect.Filter},
+		"next": {&m.Input.Next, &m.Input.Submit, &m.Select.Next, &m.Select.Submit, &m.MultiSelect.Next,
+			&m.MultiSelect.Submit, &m.Note.Next, &m.Note.Submit, &m.Confirm.Next, &m.Confirm.Submit},
+		"back":   {&m.Input.Prev, &m.Select.Prev, &m.MultiSelect.Prev, &m.Note.Prev, &m.Confirm.Prev},
+		"switch": {&m.Confirm.Toggle},
+		"yes":    {&m.Confirm.Accept},
+		"no":     {&m.Confirm.Reject},
+		"quit":   {&m.Quit},
+	}
+}
+
+// defaultKeysPath returns the keys file used when -keys isn't given.
+func defaultKeysPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "takeout", "keys.txt"), nil
+}
+
+// loadKeys applies the keys file at path to keyMap. Each line binds an action to
+// comma-separated keys, replacing its default ones, e.g. "down = n, down" for a Colemak
+// layout, with space for the space bar. Blank lines and lines starting with # are ignored.
+// A missing file is only an error if required is set.
+func loadKeys(path string, required bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	actions := keyActions(keyMap)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		action, list, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected action = keys", path, line)
+		}
+		bindings, ok := actions[strings.ToLower(strings.TrimSpace(action))]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown action %q", path, line, strings.TrimSpace(action))
+		}
+		var names, keys []string
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			names = append(names, name)
+			if name == "space" {
+				name = " "
+			}
+			keys = append(keys, name)
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("%s:%d: no keys for %s", path, line, strings.TrimSpace(action))
+		}
+		for _, b := range bindings {
+			b.SetKeys(keys...)
+			b.SetHelp(names[0], b.Help().Desc)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// runForm runs a dialog with the theme and key bindings chosen.
+func runForm(form *huh.Form) error {
+	return form.WithTheme(formTheme()).WithKeyMap(keyMap).Run()
+}
+
+// runField runs a dialog of a single field, without the key help, like huh.Run.
+func runField(field huh.Field) error {
+	return runForm(huh.NewForm(huh.NewGroup(field)).WithShowHelp(false))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// traceAll is set by the fix-one command to print every decision made for the file.
+var traceAll bool
+
+// traceGlob is the pattern given with -trace. Sidecars whose path or name, with or
+// without the .json extension, match it have their decisions printed.
+var traceGlob string
+
+// traced reports whether the decisions for jsonPath are being traced.
+func traced(jsonPath string) bool {
+	if traceAll {
+		return true
+	}
+	if traceGlob == "" {
+		return false
+	}
+	name := filepath.Base(jsonPath)
+	media, _ := takeout.SidecarMedia(name)
+	for _, candidate := range []string{name, strings.TrimSuffix(name, ".json"), media, jsonPath} {
+		if ok, _ := filepath.Match(traceGlob, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tracef prints a step of the decision trace for jsonPath when it is being traced.
+func tracef(jsonPath, format string, args ...any) {
+	if !traced(jsonPath) {
+		return
+	}
+	color.Cyan("  · %s: %s\n", filepath.Base(jsonPath), fmt.Sprintf(format, args...))
+}
+
+// result describes the outcome of a system call for the trace.
+func result(err error) string {
+	if err != nil {
+		return fmt.Sprintf("failed (%v)", err)
+	}
+	return "ok"
+}
+
+// runFixOne implements the "fix-one" command. It processes a single media file with
+// the given sidecar and traces every decision, for debugging or scripting around problem files.
+func runFixOne(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: takeout fix-one <media> <sidecar>")
+		os.Exit(2)
+	}
+	media, sidecar := args[0], args[1]
+	traceAll = true
+
+	meta, err := readTakeout(sidecar)
+	tracef(sidecar, "read sidecar: %v", result(err))
+	if err != nil {
+		color.Red("Error reading JSON file %s: %v\n", sidecar, err)
+		os.Exit(1)
+	}
+	if resolved := mediaPath(sidecar, meta); !takeout.SameFile(resolved, media) {
+		tracef(sidecar, "title %q would resolve to %s, using %s as given", meta.Title, resolved, media)
+	}
+
+	processMedia(sidecar, media, meta)
+	if stats.counts[outcomeUpdated] == 0 {
+		os.Exit(1)
+	}
+}
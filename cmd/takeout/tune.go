@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// autoWorkers is set by -workers auto to start with a few workers and tune their number
+// while the run goes, by the throughput and transient errors measured. Network shares
+// often answer too many parallel writes with sharing violations.
+var autoWorkers bool
+
+// Bounds and pace of -workers auto.
+const (
+	tuneStart    = 2
+	tuneInterval = 3 * time.Second
+	// tuneHold is the number of intervals to keep the count after stepping back, before
+	// probing for more workers again.
+	tuneHold = 5
+)
+
+// tuneMax is the most workers -workers auto uses. Waiting on disks and shares rather
+// than the CPU, more workers than cores can still help.
+var tuneMax = 4 * runtime.NumCPU()
+
+// setWorkers parses -workers, a number of workers or "auto".
+func setWorkers(value string) error {
+	if value == "auto" {
+		autoWorkers = true
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.New("expected a number or auto")
+	}
+	if n < 1 {
+		return errors.New("must be at least 1")
+	}
+	workers, autoWorkers = n, false
+	return nil
+}
+
+// startWorkers calls handle for every sidecar sent on queue from a pool of workers and
+// returns a function waiting for them once queue is closed.
+func startWorkers(queue <-chan string, handle func(jsonPath string)) (wait func()) {
+	var t *tuner
+	size := workers
+	if autoWorkers {
+		t = newTuner()
+		size = t.max
+	}
+
+	var wg sync.WaitGroup
+	for range size {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jsonPath := range queue {
+				t.acquire()
+				handle(jsonPath)
+				t.release()
+			}
+		}()
+	}
+	if t == nil {
+		return wg.Wait
+	}
+
+	stop := make(chan struct{})
+	go t.run(stop)
+	return func() {
+		wg.Wait()
+		close(stop)
+		log.Printf("Finished with %d workers\n", t.current())
+	}
+}
+
+// tuner limits how many workers handle a sidecar at once. Every interval it adds a worker
+// while that makes the run at least 5% faster, steps back when it didn't and halves the
+// number when more than 1% of the sidecars failed with a transient error.
+type tuner struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	max    int
+
+	// Owned by run.
+	handled, transient int
+	rate               float64
+	grew               bool
+	hold               int
+}
+
+func newTuner() *tuner {
+	t := &tuner{limit: min(tuneStart, tuneMax), max: tuneMax}
+	t.cond = sync.NewCond(&t.mu)
+	log.Printf("Starting with %d workers, tuning up to %d\n", t.limit, t.max)
+	return t
+}
+
+// acquire waits until fewer workers than the limit are busy. A nil tuner never waits.
+func (t *tuner) acquire() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+}
+
+func (t *tuner) release() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	t.cond.Signal()
+}
+
+func (t *tuner) current() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// set changes the limit and logs why.
+func (t *tuner) set(limit int, why string) {
+	t.mu.Lock()
+	t.grew = limit > t.limit
+	t.limit = limit
+	t.cond.Broadcast()
+	t.mu.Unlock()
+	log.Printf("Using %d workers, %s\n", limit, why)
+}
+
+// run tunes the limit every interval until stop is closed.
+func (t *tuner) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(tuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			handled, transient := stats.throughput()
+			t.step(handled-t.handled, transient-t.transient)
+			t.handled, t.transient = handled, transient
+		}
+	}
+}
+
+// step adjusts the limit after an interval in which handled sidecars were done and
+// transient of them failed with a transient error.
+func (t *tuner) step(handled, transient int) {
+	if handled == 0 {
+		return // still walking folders, or waiting on a single slow file
+	}
+	rate := float64(handled) / tuneInterval.Seconds()
+	limit := t.current()
+	switch {
+	case transient*100 > handled:
+		t.hold = tuneHold
+		if limit > 1 {
+			t.set(max(limit/2, 1), fmt.Sprintf("%d of %d files were locked or busy", transient, handled))
+		}
+	case t.grew && rate < t.rate*1.05:
+		t.hold = tuneHold
+		t.set(limit-1, fmt.Sprintf("%d were no faster at %.0f files/s", limit, rate))
+	case t.hold > 0:
+		t.hold--
+		t.grew = false
+	case limit < t.max:
+		t.set(limit+1, fmt.Sprintf("%d handled %.0f files/s", limit, rate))
+	default:
+		t.grew = false
+	}
+	t.rate = rate
+}
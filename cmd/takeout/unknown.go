@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// unknownPolicy is what a run does with media of a type it doesn't know, such as the PDFs
+// and zips Google occasionally stores: "times" sets only its file times, without embedded
+// metadata or an XMP sidecar, "skip" leaves it alone and "report" leaves it alone and lists
+// it among the files that need attention.
+type unknownPolicy string
+
+const (
+	unknownTimes  unknownPolicy = "times"
+	unknownSkip   unknownPolicy = "skip"
+	unknownReport unknownPolicy = "report"
+)
+
+// unknownPolicies are the policies -unknown-types sets by lowercase extension, with
+// unknownDefault for the other unknown types.
+var (
+	unknownPolicies = make(map[string]unknownPolicy)
+	unknownDefault  = unknownTimes
+)
+
+// setUnknownTypes parses -unknown-types, a comma-separated list of ext=policy pairs where
+// * stands for every other unknown type, e.g. "pdf=skip,zip=report,*=times".
+func setUnknownTypes(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		ext, policy, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("expected ext=policy, got %q", pair)
+		}
+		p := unknownPolicy(strings.ToLower(strings.TrimSpace(policy)))
+		switch p {
+		case unknownTimes, unknownSkip, unknownReport:
+		default:
+			return fmt.Errorf("unknown policy %q for %s, expected times, skip or report", policy, ext)
+		}
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		switch {
+		case ext == "*":
+			unknownDefault = p
+			continue
+		case ext == "" || strings.ContainsAny(ext, `/\`):
+			return errors.New("expected an extension like pdf or * for every other type")
+		case !strings.HasPrefix(ext, "."):
+			ext = "." + ext
+		}
+		if kindOf("x"+ext) != kindOther {
+			return fmt.Errorf("%s is a known media type", ext)
+		}
+		unknownPolicies[ext] = p
+	}
+	return nil
+}
+
+// unknownType reports whether the media at path is of a type the run doesn't know.
+func unknownType(path string) bool {
+	return kindOf(path) == kindOther
+}
+
+// unknownPolicyOf returns the policy for the media at path, which must be of an unknown type.
+func unknownPolicyOf(path string) unknownPolicy {
+	if p, ok := unknownPolicies[strings.ToLower(filepath.Ext(path))]; ok {
+		return p
+	}
+	return unknownDefault
+}
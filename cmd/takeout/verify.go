@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// verifyResult counts what the "verify" command found.
+type verifyResult struct {
+	checked, mismatched, missing, unreadable int
+}
+
+// runVerify implements the "verify" command, which rereads every sidecar below a folder and
+// lists the media whose times no longer match its taken time, without changing anything.
+// It confirms a run succeeded and finds the files other tools touched since.
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	withExif := flags.Bool("exif", false, "Also compare the EXIF DateTimeOriginal of JPEG and TIFF files, in any time zone")
+	rulesPath := flags.String("rules", "", "Pick the time to expect with the `file` of rules the run used (default rules.txt in the takeout config folder, if present)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: takeout verify [-exif] [-rules file] <folder>")
+		flags.PrintDefaults()
+	}
+	if err := setFlagsFromEnv(flags, "TAKEOUT_VERIFY_"); err != nil {
+		color.Red("%v\n", err)
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	root := flags.Arg(0)
+
+	rulesFile, required := *rulesPath, *rulesPath != ""
+	if !required {
+		rulesFile, _ = defaultRulesPath()
+	}
+	if rulesFile != "" {
+		var err error
+		if rules, err = loadRules(rulesFile, required); err != nil {
+			color.Red("Error loading rules: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	var result verifyResult
+	verifyDir(root, root, ignoresAbove(root, root), *withExif, &result)
+	if result.checked == 0 && result.missing == 0 && result.unreadable == 0 {
+		color.Yellow("No sidecars were found below %s\n", root)
+		os.Exit(exitNothingDone)
+	}
+	if result.mismatched == 0 && result.missing == 0 && result.unreadable == 0 {
+		color.Green("✓ All %d files match their sidecars\n", result.checked)
+		return
+	}
+	fmt.Printf("%d of %d files don't match their sidecars", result.mismatched, result.checked)
+	if result.missing > 0 {
+		fmt.Printf(", %d are missing", result.missing)
+	}
+	if result.unreadable > 0 {
+		fmt.Printf(", %d sidecars are unreadable", result.unreadable)
+	}
+	fmt.Println()
+	os.Exit(1)
+}
+
+// verifyDir verifies the sidecars in dir and below, skipping what .takeoutignore files exclude.
+func verifyDir(root, dir string, parent *ignoreList, withExif bool, result *verifyResult) {
+	ignores := parent.load(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		color.Red("Error reading %s: %v\n", dir, err)
+		return
+	}
+	for _, entry := range entries {
+		fullPath := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			if !ignores.ignored(fullPath, true) {
+				verifyDir(root, fullPath, ignores, withExif, result)
+			}
+		case entry.Name() == "metadata.json", entry.Name() == failuresName, !strings.HasSuffix(entry.Name(), ".json"):
+		case !ignores.ignoredSidecar(fullPath):
+			verifySidecar(root, fullPath, withExif, result)
+		}
+	}
+}
+
+// verifySidecar compares the times of the media of the sidecar at jsonPath with the time a
+// run would have given it, and prints what differs.
+func verifySidecar(root, jsonPath string, withExif bool, result *verifyResult) {
+	meta, err := takeout.Read(jsonPath, false)
+	var takenTime time.Time
+	if err == nil {
+		takenTime, err = meta.PhotoTakenTime.Time()
+	}
+	if err != nil {
+		color.Red("%s: %v\n", relativeTo(root, jsonPath), err)
+		result.unreadable++
+		return
+	}
+	imagePath, _ := resolveMedia(jsonPath, meta)
+	if r := matchRule(meta, imagePath, takenTime); r != nil {
+		if r.skip {
+			return
+		}
+		if r.timeSource != "" {
+			if takenTime, err = r.sourceTime(meta); err != nil {
+				color.Red("%s: %v\n", relativeTo(root, jsonPath), err)
+				result.unreadable++
+				return
+			}
+		}
+	}
+
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		color.Red("%s: media missing (%s)\n", relativeTo(root, imagePath), relativeTo(root, jsonPath))
+		result.missing++
+		return
+	}
+	result.checked++
+
+	var differences []string
+	vol := volumeOf(imagePath)
+	precision := fileSystemGranularity(vol.FileSystem)
+	if !sameTime(info.ModTime(), takenTime, max(precision.modified, time.Second)) {
+		differences = append(differences, "modified "+info.ModTime().Format(time.RFC3339))
+	}
+	// Where the filesystem doesn't report creation times, the modification time stands in.
+	if _, created := timestamps.FileTimes(info); !created.IsZero() && !created.Equal(info.ModTime()) &&
+		vol.creationSupported() && !sameTime(created, takenTime, max(precision.created, time.Second)) {
+		differences = append(differences, "created "+created.Format(time.RFC3339))
+	}
+	if withExif {
+		if date, ok := exifTakenTime(imagePath); ok && !sameMoment(date, takenTime) {
+			differences = append(differences, "EXIF "+date.Format(time.DateTime))
+		}
+	}
+	if len(differences) == 0 {
+		return
+	}
+	result.mismatched++
+	color.Yellow("%s: taken %s, but %s\n", relativeTo(root, imagePath), takenTime.Format(time.RFC3339), strings.Join(differences, ", "))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+)
+
+// verbose is set by -verbose to print a line for every file, as runs without a terminal
+// do, instead of showing the progress view.
+var verbose bool
+
+// errInterrupted stops a run whose progress view got Ctrl+C.
+var errInterrupted = errors.New("interrupted")
+
+// progressTick is how often the progress view is redrawn.
+const progressTick = 250 * time.Millisecond
+
+// progressBar is the width of the bar in the progress view, in cells.
+const progressBar = 30
+
+// showProgress reports whether the run shows the progress view: only in a terminal, where
+// it can be redrawn, and not when -verbose asks for every line.
+func showProgress() bool {
+	stdout := isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+	return terminal && stdout && !verbose
+}
+
+type (
+	progressTickMsg  struct{}
+	progressTotalMsg int
+	progressDoneMsg  struct{}
+)
+
+// progressView is the bubbletea model of the progress view. The counts are read from stats
+// on every tick; failures are printed above the view as they happen.
+type progressView struct {
+	started  time.Time
+	total    int // sidecars found by countSidecars, -1 until it is done
+	handled  int
+	failed   int
+	noted    int // failures printed so far
+	quitting bool
+}
+
+func (v *progressView) Init() tea.Cmd {
+	return tickProgress()
+}
+
+func tickProgress() tea.Cmd {
+	return tea.Tick(progressTick, func(time.Time) tea.Msg { return progressTickMsg{} })
+}
+
+func (v *progressView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		// Sidecars in progress finish, like a time budget running out.
+		if msg.Type == tea.KeyCtrlC {
+			stopRun(errInterrupted)
+		}
+	case progressTotalMsg:
+		v.total = int(msg)
+	case progressTickMsg:
+		return v, tea.Batch(v.refresh(), tickProgress())
+	case progressDoneMsg:
+		v.quitting = true
+		return v, tea.Sequence(v.refresh(), tea.Quit)
+	}
+	return v, nil
+}
+
+// refresh reads the counts from stats and returns the command printing the new failures.
+func (v *progressView) refresh() tea.Cmd {
+	handled, failed, recent, noted := stats.progressSince(v.noted)
+	v.handled, v.failed, v.noted = handled, failed, noted
+	if len(recent) == 0 {
+		return nil
+	}
+	lines := make([]string, len(recent))
+	for i, failure := range recent {
+		lines[i] = color.RedString("✗ %s: %s", relativeTo(exportRoot, failure.path), failure.reason)
+	}
+	return tea.Println(strings.Join(lines, "\n"))
+}
+
+func (v *progressView) View() string {
+	if v.quitting {
+		return ""
+	}
+	elapsed := time.Since(v.started)
+	rate := float64(v.handled) / max(elapsed.Seconds(), 1)
+
+	var b strings.Builder
+	if v.total >= 0 {
+		total := max(v.total, v.handled)
+		filled := progressBar
+		if total > 0 {
+			filled = progressBar * v.handled / total
+		}
+		fmt.Fprintf(&b, "[%s%s] %s/%s sidecars", strings.Repeat("█", filled), strings.Repeat("░", progressBar-filled),
+			humanize.Comma(int64(v.handled)), humanize.Comma(int64(total)))
+	} else {
+		fmt.Fprintf(&b, "%s sidecars, counting the rest", humanize.Comma(int64(v.handled)))
+	}
+	if v.failed > 0 {
+		b.WriteString(color.RedString(" · %s failed", humanize.Comma(int64(v.failed))))
+	}
+	fmt.Fprintf(&b, " · %.0f files/s", rate)
+	if v.total >= 0 && rate > 0 {
+		left := time.Duration(float64(max(v.total-v.handled, 0)) / rate * float64(time.Second))
+		fmt.Fprintf(&b, " · ETA %s", left.Round(time.Second))
+	}
+	if runCtx.Err() != nil {
+		b.WriteString(" · stopping")
+	}
+	return b.String() + "\n"
+}
+
+// printer writes each log line above the progress view instead of through it.
+type printer struct{ program *tea.Program }
+
+func (p printer) Write(b []byte) (int, error) {
+	p.program.Println(strings.TrimSuffix(string(b), "\n"))
+	return len(b), nil
+}
+
+// runWithProgress calls run while showing the progress view. count returns the number of
+// sidecars the run will handle and is called at the same time; nil leaves the total unknown.
+// The per-file lines are dropped while the view is shown, since the summary and -report
+// hold them.
+func runWithProgress(run func(), count func() int) {
+	view := &progressView{started: time.Now(), total: -1}
+	program := tea.NewProgram(view)
+
+	output, logOutput := color.Output, log.Writer()
+	color.Output = io.Discard
+	log.SetOutput(printer{program})
+	defer func() {
+		color.Output = output
+		log.SetOutput(logOutput)
+	}()
+
+	if count != nil {
+		go func() { program.Send(progressTotalMsg(count())) }()
+	}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		run()
+		program.Send(progressDoneMsg{})
+	}()
+	if _, err := program.Run(); err != nil {
+		log.SetOutput(logOutput)
+		log.Printf("Error showing progress: %v\n", err)
+	}
+	<-finished
+}
+
+// countSidecars returns the number of sidecars below the folders, skipping what
+// .takeoutignore files exclude, plus the listed sidecars. It gives up once the run stops.
+func countSidecars(root string, folders []string, sidecars int) int {
+	n := sidecars
+	for _, folder := range folders {
+		folder = sidecarFolder(root, folder)
+		ignores := ignoresAbove(cmp.Or(sidecarRoot, root), folder)
+		if !ignores.ignored(folder, true) {
+			n += countDir(folder, ignores)
+		}
+	}
+	return n
+}
+
+// countDir returns the number of sidecars in dir and below.
+func countDir(dir string, parent *ignoreList) int {
+	ignores := parent.load(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, entry := range entries {
+		if runCtx.Err() != nil {
+			return n
+		}
+		fullPath := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			if !ignores.ignored(fullPath, true) {
+				n += countDir(fullPath, ignores)
+			}
+		case entry.Name() == "metadata.json", entry.Name() == failuresName, !strings.HasSuffix(entry.Name(), ".json"):
+		case !ignores.ignoredSidecar(fullPath):
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ellypaws/takeout/timestamps"
+	"github.com/fatih/color"
+)
+
+// How a volume keeps access times, for volume.AccessTimes.
+const (
+	// accessDisabled means reads never update the access time, such as NTFS with
+	// last-access updates disabled or a noatime mount.
+	accessDisabled = "disabled"
+	// accessRelative means reads only update the access time if it is older than the
+	// modification time or a day old, as with relatime mounts.
+	accessRelative = "relatime"
+)
+
+// volume describes the filesystem capabilities of a volume media was written to.
+type volume struct {
+	Root       string
+	FileSystem string
+	Remote     bool
+	// AccessTimes is accessDisabled or accessRelative if reads don't update access times
+	// strictly, empty if they do or it is unknown.
+	AccessTimes string
+
+	mu         sync.Mutex
+	noCreation bool
+}
+
+// volumes caches the volumes seen during the run by their root path.
+var volumes = struct {
+	mu     sync.Mutex
+	byRoot map[string]*volume
+}{byRoot: make(map[string]*volume)}
+
+// volumeOf returns the volume holding path, detecting its filesystem the first time
+// the volume is seen. Detection failures leave the filesystem unknown rather than failing.
+func volumeOf(path string) *volume {
+	root := volumeRoot(path)
+
+	volumes.mu.Lock()
+	defer volumes.mu.Unlock()
+	if v, ok := volumes.byRoot[root]; ok {
+		return v
+	}
+
+	v := &volume{Root: root}
+	v.FileSystem, v.Remote = describeVolume(root)
+	v.AccessTimes = accessTimeUpdates(root, v.FileSystem)
+	volumes.byRoot[root] = v
+
+	if notes := v.notes(); len(notes) > 0 {
+		color.Yellow("Note: %s (%s) %s\n", v.Root, v.FileSystem, strings.Join(notes, "; "))
+	}
+	return v
+}
+
+// creationSupported reports whether creation times can still be set on the volume.
+func (v *volume) creationSupported() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return !v.noCreation
+}
+
+// creationUnsupported checks whether err from setting a creation time means the volume
+// doesn't support it. If so, the volume stops being asked and true is returned.
+func (v *volume) creationUnsupported(err error) bool {
+	if !timestamps.CreationNotSupported(err) {
+		return false
+	}
+
+	v.mu.Lock()
+	first := !v.noCreation
+	v.noCreation = true
+	v.mu.Unlock()
+
+	if first {
+		color.Yellow("Note: %s (%s) doesn't support creation times; only modification and access times are set there\n", v.Root, v.FileSystem)
+	}
+	return true
+}
+
+// notes describes how the volume limits the times the tool writes.
+func (v *volume) notes() []string {
+	var notes []string
+	switch strings.ToUpper(v.FileSystem) {
+	case "FAT", "FAT32":
+		notes = append(notes, "keeps modification times to 2 seconds and access times to the day")
+	case "EXFAT":
+		notes = append(notes, "keeps access times to 2 seconds")
+	}
+	switch v.AccessTimes {
+	case accessDisabled:
+		notes = append(notes, "has last-access updates disabled, so access times only change when the tool sets them")
+	case accessRelative:
+		notes = append(notes, "updates access times at most once a day on reads (relatime)")
+	}
+	if v.Remote {
+		notes = append(notes, "is a network share, so creation time support depends on the server")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.noCreation {
+		notes = append(notes, "doesn't support creation times, only modification and access times were set")
+	}
+	return notes
+}
+
+// volumeRows returns a row per volume written to: its root, filesystem and notes.
+func volumeRows() [][]string {
+	volumes.mu.Lock()
+	defer volumes.mu.Unlock()
+
+	rows := make([][]string, 0, len(volumes.byRoot))
+	for _, v := range volumes.byRoot {
+		notes := v.notes()
+		if len(notes) == 0 {
+			notes = []string{"full support"}
+		}
+		rows = append(rows, []string{v.Root, v.FileSystem, strings.Join(notes, "; ")})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return rows
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileSystemName returns the filesystem mounted at root and whether it is a network share.
+func fileSystemName(root string) (string, bool) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(root, &fs); err != nil {
+		return "unknown", false
+	}
+	name := unix.ByteSliceToString(fs.Fstypename[:])
+	switch name {
+	case "msdos":
+		return "FAT32", false
+	case "exfat":
+		return "exFAT", false
+	case "smbfs", "nfs", "afpfs", "webdav":
+		return name, true
+	}
+	return strings.ToLower(name), false
+}
+
+// accessTimeUpdates reports whether the mount at root has access time updates turned off.
+func accessTimeUpdates(root, fileSystem string) string {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(root, &fs); err != nil || fs.Flags&unix.MNT_NOATIME == 0 {
+		return ""
+	}
+	return accessDisabled
+}
@@ -0,0 +1,51 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// fileSystems maps the statfs magic numbers of common filesystems to their names,
+// and whether they are network filesystems.
+var fileSystems = map[int64]struct {
+	name   string
+	remote bool
+}{
+	0xEF53:     {"ext4", false},
+	0x9123683E: {"btrfs", false},
+	0x58465342: {"xfs", false},
+	0x4D44:     {"FAT32", false},
+	0x2011BAB0: {"exFAT", false},
+	0x5346544E: {"NTFS", false},
+	0x7366746E: {"NTFS", false},
+	0x01021994: {"tmpfs", false},
+	0x2FC12FC1: {"zfs", false},
+	0x65735546: {"fuse", false},
+	0x6969:     {"nfs", true},
+	0xFF534D42: {"cifs", true},
+	0xFE534D42: {"smb2", true},
+}
+
+// fileSystemName returns the filesystem mounted at root from its statfs magic number.
+func fileSystemName(root string) (string, bool) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(root, &fs); err != nil {
+		return "unknown", false
+	}
+	if known, ok := fileSystems[int64(fs.Type)]; ok {
+		return known.name, known.remote
+	}
+	return "unknown", false
+}
+
+// accessTimeUpdates reports how the mount at root updates access times on reads.
+func accessTimeUpdates(root, fileSystem string) string {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(root, &fs); err != nil {
+		return ""
+	}
+	switch {
+	case fs.Flags&unix.ST_NOATIME != 0:
+		return accessDisabled
+	case fs.Flags&unix.ST_RELATIME != 0:
+		return accessRelative
+	}
+	return ""
+}
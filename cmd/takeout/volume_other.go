@@ -0,0 +1,49 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// volumeRoot returns the mount point of the filesystem holding path: the topmost
+// folder above it that is still on the same device.
+func volumeRoot(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	dev, ok := deviceOf(abs)
+	if !ok {
+		return abs
+	}
+	root := abs
+	for parent := filepath.Dir(root); parent != root; parent = filepath.Dir(root) {
+		if parentDev, ok := deviceOf(parent); !ok || parentDev != dev {
+			break
+		}
+		root = parent
+	}
+	return root
+}
+
+// deviceOf returns the device number of the filesystem holding path.
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// describeVolume returns the filesystem mounted at root and whether it is a network share.
+// FAT variants use the Windows names so that their time precision is recognized.
+func describeVolume(root string) (fileSystem string, remote bool) {
+	return fileSystemName(root)
+}
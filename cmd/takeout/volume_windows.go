@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// volumeRoot returns the root of the volume holding path, e.g. `E:\` or `\\nas\photos\`.
+func volumeRoot(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if p, err := windows.UTF16PtrFromString(abs); err == nil {
+		buf := make([]uint16, windows.MAX_PATH+1)
+		if windows.GetVolumePathName(p, &buf[0], uint32(len(buf))) == nil {
+			return windows.UTF16ToString(buf)
+		}
+	}
+	return filepath.VolumeName(abs) + `\`
+}
+
+// describeVolume returns the filesystem of the volume at root, e.g. "NTFS" or "exFAT",
+// and whether it is a network share.
+func describeVolume(root string) (fileSystem string, remote bool) {
+	fileSystem = "unknown"
+	rootPtr, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return fileSystem, false
+	}
+	name := make([]uint16, windows.MAX_PATH+1)
+	if windows.GetVolumeInformation(rootPtr, nil, 0, nil, nil, nil, &name[0], uint32(len(name))) == nil {
+		fileSystem = windows.UTF16ToString(name)
+	}
+	return fileSystem, windows.GetDriveType(rootPtr) == windows.DRIVE_REMOTE
+}
+
+// accessTimeUpdates reports whether NTFS has last-access updates disabled, as it is by
+// default on many Windows versions. The low bit of NtfsDisableLastAccessUpdate is set when
+// they are disabled, whether by the user or by the system.
+func accessTimeUpdates(root, fileSystem string) string {
+	if !strings.EqualFold(fileSystem, "NTFS") {
+		return ""
+	}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\FileSystem`, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	value, _, err := key.GetIntegerValue("NtfsDisableLastAccessUpdate")
+	if err != nil || value&1 == 0 {
+		return ""
+	}
+	return accessDisabled
+}
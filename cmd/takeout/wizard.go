@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/fatih/color"
+)
+
+// The modes the wizard's first step offers.
+const (
+	modeInPlace  = "in-place"
+	modeOrganize = "organize"
+	modePackage  = "package"
+	modeServer   = "server"
+)
+
+// chooseMode asks what the run is for before the wizard picks the folders: fixing the export
+// in place, also copying it into folders by date, writing corrected copies into yearly zips,
+// or fixing an export on an SFTP server. It sets -reorganize, -package-by-year or the sftp://
+// -dir to match and returns the mode. The zips and the server are only offered when the
+// flags given allow them.
+func chooseMode(startDir *string) (string, error) {
+	options := []huh.Option[string]{
+		huh.NewOption("Fix the file dates of the export in place", modeInPlace),
+		huh.NewOption("Fix them in place and copy the media into folders by date", modeOrganize),
+	}
+	if !extractMotion && dedupe != "link" && dedupe != "move" {
+		options = append(options, huh.NewOption("Leave the export as it is and write corrected copies into one zip per year", modePackage))
+	}
+	if *startDir == "." && len(unsupportedRemoteFlags()) == 0 {
+		options = append(options, huh.NewOption("Fix the file dates of an export on an SFTP server", modeServer))
+	}
+
+	mode := modeInPlace
+	var folder, target string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("What do you want to do?").
+				Options(options...).
+				Value(&mode),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Folder to copy the media into").
+				Description("Laid out as "+reorganizeLayout+" by the date each file was taken").
+				Validate(requiredFolder).
+				Value(&folder),
+		).WithHideFunc(func() bool { return mode != modeOrganize }),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Folder to write the zips into").
+				Description("One zip per year taken, e.g. 2017.zip").
+				Validate(requiredFolder).
+				Value(&folder),
+		).WithHideFunc(func() bool { return mode != modePackage }),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Export on the server").
+				Description("sftp://[user@]host[:port]/path, signed in to with your ssh setup").
+				Validate(validRemote).
+				Value(&target),
+		).WithHideFunc(func() bool { return mode != modeServer }),
+	)
+	if err := runForm(form); err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case modeOrganize, modePackage:
+		dir, err := filepath.Abs(strings.TrimSpace(folder))
+		if err != nil {
+			return "", err
+		}
+		if mode == modeOrganize {
+			reorganizeDir = dir
+		} else {
+			packageDir = dir
+		}
+	case modeServer:
+		*startDir = strings.TrimSpace(target)
+	}
+	return mode, nil
+}
+
+// requiredFolder validates the answer to a folder question.
+func requiredFolder(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("enter a folder")
+	}
+	return nil
+}
+
+// validRemote validates an sftp:// URL of an export.
+func validRemote(value string) error {
+	value = strings.TrimSpace(value)
+	if !isRemote(value) {
+		return errors.New("enter an sftp:// URL")
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return errors.New("the URL names no server")
+	}
+	return nil
+}
+
+// confirmRemotePlan shows the plan of a run on the export at root on the server chosen in
+// the wizard, and exits unless it is started.
+func confirmRemotePlan(root string) {
+	start := true
+	err := runForm(huh.NewForm(huh.NewGroup(
+		huh.NewNote().
+			Title("Plan").
+			Description(planSummary(root, nil, false)),
+		huh.NewConfirm().
+			Title("Start processing?").
+			Affirmative("Start processing").
+			Negative("Cancel").
+			Value(&start),
+	)))
+	if err != nil {
+		log.Fatalf("Error running form: %v", err)
+	}
+	if !start {
+		color.Yellow("Cancelled, nothing was changed\n")
+		os.Exit(0)
+	}
+}
+
+// planSummary describes what a run with the wizard's answers and the flags given will do
+// under root: where the corrected times go, what else gets written, and which albums, with
+// albums nil for a run over all of root.
+func planSummary(root string, albums []string, recordSnapshot bool) string {
+	var plan strings.Builder
+	switch {
+	case dryRun:
+		fmt.Fprintf(&plan, "Dry run: list the file dates that would change under %s, changing nothing\n", root)
+	case remote != nil:
+		fmt.Fprintf(&plan, "Fix file dates in place on the server under %s\n", root)
+	case tarPath == "-":
+		fmt.Fprintf(&plan, "Write corrected copies of the media under %s as a tar archive to stdout, leaving the originals untouched\n", root)
+	case tarPath != "":
+		fmt.Fprintf(&plan, "Write corrected copies of the media under %s into the tar archive %s, leaving the originals untouched\n", root, tarPath)
+	case packageDir != "":
+		fmt.Fprintf(&plan, "Write corrected copies of the media under %s into one zip per year in %s, leaving the originals untouched\n", root, packageDir)
+	default:
+		fmt.Fprintf(&plan, "Fix file dates in place under %s\n", root)
+	}
+
+	if !dryRun {
+		if reorganizeDir != "" {
+			verb := "Copy"
+			if reorganizeMove {
+				verb = "Move"
+			}
+			fmt.Fprintf(&plan, "%s the updated media into %s, laid out as %s\n", verb, reorganizeDir, reorganizeLayout)
+		}
+		embedded := plannedWrites()
+		if len(embedded) == 0 {
+			embedded = []string{"none, file times only"}
+		}
+		fmt.Fprintf(&plan, "Metadata: %s\n", strings.Join(embedded, ", "))
+		if also := plannedExtras(); len(also) > 0 {
+			fmt.Fprintf(&plan, "Also: %s\n", strings.Join(also, ", "))
+		}
+	}
+
+	if albums != nil {
+		fmt.Fprintf(&plan, "Albums: %d selected\n", len(albums))
+	}
+	if recordSnapshot {
+		plan.WriteString("Snapshot: before and after the run\n")
+	} else {
+		plan.WriteString("Snapshot: none\n")
+	}
+	return plan.String()
+}
+
+// plannedWrites lists the metadata -exif, -gps, -iptc, -captions and -xmp write besides
+// the file times.
+func plannedWrites() []string {
+	var writes []string
+	if writeExif {
+		writes = append(writes, "taken time in EXIF and movie headers")
+	}
+	if writeGPS {
+		writes = append(writes, "location in EXIF GPS")
+	}
+	if writeIPTC {
+		writes = append(writes, "taken time in IPTC")
+	}
+	if writeCaptions {
+		writes = append(writes, "captions and people in IPTC")
+	}
+	if writeXMP {
+		writes = append(writes, "an .xmp sidecar next to every file")
+	}
+	return writes
+}
+
+// plannedExtras lists the other files and copies the run handles or writes.
+func plannedExtras() []string {
+	var extras []string
+	if withEdited {
+		extras = append(extras, "edited copies")
+	}
+	if extractMotion {
+		extras = append(extras, "Motion Photo videos saved as .mp4")
+	}
+	if dedupe != "" {
+		extras = append(extras, "duplicates "+map[string]string{"skip": "left as they are", "link": "replaced with hard links", "move": "moved aside"}[dedupe])
+	}
+	if icsPath != "" {
+		extras = append(extras, "a calendar in "+icsPath)
+	}
+	if auditPath != "" {
+		extras = append(extras, "a report in "+auditPath)
+	}
+	if mappingOut != "" {
+		extras = append(extras, "the pairing in "+mappingOut)
+	}
+	return extras
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanSummary(t *testing.T) {
+	defer func(tar, pkg, reorganize string, exif, xmp bool) {
+		tarPath, packageDir, reorganizeDir, writeExif, writeXMP = tar, pkg, reorganize, exif, xmp
+	}(tarPath, packageDir, reorganizeDir, writeExif, writeXMP)
+
+	for _, test := range []struct {
+		name          string
+		set           func()
+		want, wantNot []string
+	}{
+		{
+			name: "in place",
+			set:  func() {},
+			want: []string{"Fix file dates in place under /export", "Metadata: none, file times only", "Albums: 2 selected"},
+		},
+		{
+			name:    "tar",
+			set:     func() { tarPath = "/out.tar" },
+			want:    []string{"into the tar archive /out.tar, leaving the originals untouched"},
+			wantNot: []string{"in place"},
+		},
+		{
+			name:    "yearly zips",
+			set:     func() { packageDir = "/zips"; writeExif = true },
+			want:    []string{"one zip per year in /zips", "Metadata: taken time in EXIF and movie headers"},
+			wantNot: []string{"in place"},
+		},
+		{
+			name: "reorganize",
+			set:  func() { reorganizeDir = "/sorted"; writeXMP = true },
+			want: []string{"Fix file dates in place", "Copy the updated media into /sorted, laid out as {year}/{month}", "an .xmp sidecar next to every file"},
+		},
+	} {
+		tarPath, packageDir, reorganizeDir, writeExif, writeXMP = "", "", "", false, false
+		test.set()
+		plan := planSummary("/export", []string{"A", "B"}, false)
+		for _, want := range test.want {
+			if !strings.Contains(plan, want) {
+				t.Errorf("%s: plan doesn't say %q:\n%s", test.name, want, plan)
+			}
+		}
+		for _, unwanted := range test.wantNot {
+			if strings.Contains(plan, unwanted) {
+				t.Errorf("%s: plan says %q:\n%s", test.name, unwanted, plan)
+			}
+		}
+	}
+}
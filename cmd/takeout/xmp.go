@@ -0,0 +1,33 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+// writeXMP is set by -xmp to write the taken time, the Google Photos flags and, with -gps,
+// the location into an .xmp sidecar next to every media file, for software that reads
+// neither EXIF nor IPTC.
+var writeXMP bool
+
+// xmpFor returns the XMP sidecar to write for the item, or an empty string if none is needed.
+// With -xmp it holds the taken time, the favorite, archived and trashed flags, the location
+// with -gps and the description and people with -captions. Without it, only media whose location couldn't be embedded get a sidecar,
+// holding just the location.
+func xmpFor(meta *takeout.Takeout, takenTime time.Time, embedded bool) string {
+	location, hasLocation := meta.Location()
+	gps := writeGPS && hasLocation
+	switch {
+	case writeXMP:
+		fields := takeout.XMP{Taken: exifLocalTime(meta, takenTime), Dates: true, Location: location, GPS: gps}
+		fields.Rating, fields.Keywords = takeout.XMPFlags(meta)
+		var names []string
+		fields.Description, names = captionsOf(meta)
+		fields.Keywords = append(fields.Keywords, names...)
+		return fields.Packet()
+	case gps && !embedded:
+		return takeout.XMP{Location: location, GPS: true}.Packet()
+	}
+	return ""
+}
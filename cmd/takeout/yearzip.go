@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/takeout"
+	"github.com/fatih/color"
+)
+
+// packageDir is the folder of the yearly zips, set by -package-by-year.
+var packageDir string
+
+// yearArchives writes corrected media into one zip per year taken in a folder, set by
+// -package-by-year, leaving the originals untouched. The zip entries carry the taken time.
+// It is safe for concurrent use; every entry is written whole before the next starts.
+type yearArchives struct {
+	mu    sync.Mutex
+	dir   string
+	root  string
+	years map[int]*yearZip
+}
+
+// yearZip is the zip of a single year, written to a temporary file until it is verified.
+type yearZip struct {
+	file    *os.File
+	w       *zip.Writer
+	path    string
+	entries int
+}
+
+// openYearArchives prepares the folder the yearly zips are written into. Entries are
+// named relative to root.
+func openYearArchives(dir, root string) (*yearArchives, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &yearArchives{dir: dir, root: root, years: make(map[int]*yearZip)}, nil
+}
+
+// yearPath returns the zip of the year in the folder, e.g. "2017.zip".
+func (a *yearArchives) yearPath(year int) string {
+	return filepath.Join(a.dir, strconv.Itoa(year)+".zip")
+}
+
+// addMedia adds the media at imagePath to the zip of the year it was taken in, in the
+// zone of its location like EXIF dates, with the EXIF and IPTC changes the run asks for.
+// The XMP sidecar -xmp asks for, or the location of formats without writable EXIF, is
+// added next to it.
+func (a *yearArchives) addMedia(imagePath string, meta *takeout.Takeout, takenTime time.Time) error {
+	data, embedded, err := correctedMedia(imagePath, meta, takenTime)
+	if err != nil {
+		return err
+	}
+	local := exifLocalTime(meta, takenTime)
+	name := relativeTo(a.root, imagePath)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	z, err := a.year(local.Year())
+	if err != nil {
+		return err
+	}
+	// Media is compressed already, so it is stored as it is.
+	w, err := z.w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: local})
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		_, err = w.Write(data)
+	} else {
+		err = copyInto(w, imagePath)
+	}
+	if err != nil {
+		return err
+	}
+	z.entries++
+
+	if xmp := xmpFor(meta, takenTime, embedded); xmp != "" && !unknownType(imagePath) {
+		w, err := z.w.CreateHeader(&zip.FileHeader{Name: takeout.XMPPath(name), Method: zip.Deflate, Modified: local})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, xmp); err != nil {
+			return err
+		}
+		z.entries++
+	}
+	return nil
+}
+
+// year returns the zip of the year, starting it if this is its first file. The caller
+// must hold a.mu.
+func (a *yearArchives) year(year int) (*yearZip, error) {
+	if z, ok := a.years[year]; ok {
+		return z, nil
+	}
+	path := a.yearPath(year)
+	file, err := takeout.CreateTemp(path)
+	if err != nil {
+		return nil, err
+	}
+	z := &yearZip{file: file, w: zip.NewWriter(file), path: path}
+	a.years[year] = z
+	return z, nil
+}
+
+// copyInto streams the file at path into w.
+func copyInto(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// close finishes the yearly zips. Each zip is read back and its every entry checked
+// against its checksum before it replaces an earlier zip of that year; incomplete or
+// broken zips are discarded.
+func (a *yearArchives) close(complete bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []error
+	for _, year := range a.sortedYears() {
+		z := a.years[year]
+		err := z.w.Close()
+		if err == nil && complete {
+			err = verifyZip(z.file.Name(), z.entries)
+		}
+		if err != nil || !complete {
+			takeout.DiscardTemp(z.file)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", z.path, err))
+			}
+			continue
+		}
+		if err := takeout.CommitTemp(z.file, z.path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write archive %s: %w", z.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedYears returns the years with a zip, oldest first.
+func (a *yearArchives) sortedYears() []int {
+	years := make([]int, 0, len(a.years))
+	for year := range a.years {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	return years
+}
+
+// report prints which yearly zips were written.
+func (a *yearArchives) report() {
+	years := a.sortedYears()
+	switch len(years) {
+	case 0:
+		color.Yellow("No media was added, so no yearly archives were written\n")
+	case 1:
+		color.Green("✓ Wrote the %d archive to %s\n", years[0], a.dir)
+	default:
+		color.Green("✓ Wrote %d yearly archives, %d to %d, to %s\n", len(years), years[0], years[len(years)-1], a.dir)
+	}
+}
+
+// verifyZip reads the zip at path back, checking every entry against its CRC-32, and that
+// it holds the expected number of entries.
+func verifyZip(path string, entries int) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if len(r.File) != entries {
+		return fmt.Errorf("holds %d entries instead of %d", len(r.File), entries)
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
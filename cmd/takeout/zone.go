@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+	_ "time/tzdata" // so -tz finds zones on Windows, which has no zoneinfo files
+
+	"github.com/ellypaws/takeout"
+)
+
+// takenZone is the zone set by -tz that the local dates of every item are written in, such
+// as the EXIF dates and the {year} of -reorganize folders: the local zone of this machine by
+// default. Nil, for -tz auto, takes the zone of the item's location when the sidecar has one,
+// so photos taken abroad don't land a day off. That zone is only takeout.NauticalZone's guess,
+// often an hour or more off, so auto must be asked for.
+var takenZone = time.Local
+
+// setTimeZone parses -tz: auto, local, or a zone name like Europe/Berlin or UTC.
+func setTimeZone(value string) error {
+	switch strings.ToLower(value) {
+	case "auto":
+		takenZone = nil
+		return nil
+	case "local":
+		takenZone = time.Local
+		return nil
+	case "":
+		return errors.New("expected auto, local or a zone name like Europe/Berlin")
+	}
+	zone, err := time.LoadLocation(value)
+	if err != nil {
+		return err
+	}
+	takenZone = zone
+	return nil
+}
+
+// takenLocation returns the zone the local dates of the item are written in.
+func takenLocation(meta *takeout.Takeout) *time.Location {
+	if takenZone != nil {
+		return takenZone
+	}
+	if g, ok := meta.Location(); ok {
+		return takeout.NauticalZone(g)
+	}
+	return time.Local
+}
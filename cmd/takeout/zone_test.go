@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ellypaws/takeout"
+)
+
+func TestTakenLocationDefaultsToLocal(t *testing.T) {
+	defer func(zone *time.Location) { takenZone = zone }(takenZone)
+	munich := &takeout.Takeout{GeoData: takeout.GeoData{Latitude: 48.1, Longitude: 11.5}}
+
+	if got := takenLocation(munich); got != time.Local {
+		t.Errorf("default zone %v, want the local zone", got)
+	}
+	if err := setTimeZone("auto"); err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := time.Unix(1500000000, 0).In(takenLocation(munich)).Zone(); offset != 3600 {
+		t.Errorf("-tz auto gives offset %d in Munich, want the nautical zone's 3600", offset)
+	}
+	if got := takenLocation(&takeout.Takeout{}); got != time.Local {
+		t.Errorf("-tz auto without a location gives %v, want the local zone", got)
+	}
+}
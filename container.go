@@ -0,0 +1,341 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// containerEpoch is the start of the times MP4 and QuickTime headers hold, in seconds.
+var containerEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// errContainerLayout means the dates of an MP4 style file can't be changed in place, such
+// as a HEIC whose EXIF lacks the date fields or sits in more than one extent. Like other
+// formats without writable EXIF, such files only get a sidecar and their file times.
+var errContainerLayout = fmt.Errorf("%w: no date fields to overwrite in place", errExifUnsupported)
+
+// containerExts are the extensions of MP4 style files, whose dates are written into their
+// movie headers, or for HEIC into their EXIF item.
+var containerExts = []string{".mp4", ".mp", ".m4v", ".mov", ".3gp", ".3g2", ".heic", ".heif", ".avif"}
+
+// containerVideo reports whether the MP4 style file at path is a video rather than a HEIC
+// style photo.
+func containerVideo(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".heic", ".heif", ".avif":
+		return false
+	}
+	return true
+}
+
+// containerFormat reports whether the media at path is an MP4 style file.
+func containerFormat(path string) bool {
+	return slices.Contains(containerExts, strings.ToLower(filepath.Ext(path)))
+}
+
+// containerPatch is bytes of an MP4 style file to overwrite at offset.
+type containerPatch struct {
+	offset int64
+	data   []byte
+}
+
+// containerPatches returns the changes setting the dates of an MP4 style file to taken:
+// the creation and modification times of the movie, track and media headers of a video,
+// or the EXIF dates of a HEIC, which keep their size. Nothing else in the file moves.
+func containerPatches(r io.ReaderAt, size int64, path string, taken time.Time) ([]containerPatch, error) {
+	if taken.Before(containerEpoch) {
+		return nil, errContainerLayout
+	}
+	var patches []containerPatch
+	video := containerVideo(path)
+	err := eachBox(r, size, func(kind string, payload *io.SectionReader) error {
+		switch {
+		case kind == "moov" && video:
+			data, err := readBox(payload)
+			if err != nil {
+				return err
+			}
+			if setMovieTimes(data, taken) {
+				_, offset, _ := payload.Outer()
+				patches = append(patches, containerPatch{offset: offset, data: data})
+			}
+		case kind == "meta" && !video:
+			data, err := readBox(payload)
+			if err != nil {
+				return err
+			}
+			patch, err := heicExifDates(r, data, taken)
+			if err != nil {
+				return err
+			}
+			patches = append(patches, patch)
+		}
+		return nil
+	})
+	if err == nil && len(patches) == 0 {
+		err = errContainerLayout
+	}
+	return patches, err
+}
+
+// setMovieTimes sets the creation and modification times of the mvhd, tkhd and mdhd boxes
+// in a moov payload to taken, and reports whether it found any.
+func setMovieTimes(moov []byte, taken time.Time) bool {
+	seconds := uint64(taken.Sub(containerEpoch) / time.Second)
+	found := false
+	set := func(header []byte) {
+		// Version 1 headers hold 64-bit times, version 0 ones 32-bit times.
+		switch {
+		case len(header) >= 20 && header[0] == 1:
+			binary.BigEndian.PutUint64(header[4:12], seconds)
+			binary.BigEndian.PutUint64(header[12:20], seconds)
+		case len(header) >= 12 && header[0] == 0:
+			binary.BigEndian.PutUint32(header[4:8], uint32(seconds))
+			binary.BigEndian.PutUint32(header[8:12], uint32(seconds))
+		default:
+			return
+		}
+		found = true
+	}
+	boxesIn(moov, func(kind string, payload []byte) {
+		switch kind {
+		case "mvhd":
+			set(payload)
+		case "trak":
+			boxesIn(payload, func(kind string, payload []byte) {
+				switch kind {
+				case "tkhd":
+					set(payload)
+				case "mdia":
+					boxesIn(payload, func(kind string, payload []byte) {
+						if kind == "mdhd" {
+							set(payload)
+						}
+					})
+				}
+			})
+		}
+	})
+	return found
+}
+
+// heicExifDates returns the change setting the EXIF dates of a HEIC to taken, given the
+// payload of its meta box. The EXIF item is found through the item info and location
+// boxes; it must already hold the date fields, since a bigger item would move the rest.
+func heicExifDates(r io.ReaderAt, meta []byte, taken time.Time) (containerPatch, error) {
+	if len(meta) < 4 {
+		return containerPatch{}, ErrBrokenMedia
+	}
+	var (
+		exifItem uint32
+		found    bool
+		offset   int64
+		length   int64
+		located  bool
+	)
+	boxesIn(meta[4:], func(kind string, payload []byte) {
+		if kind == "iinf" {
+			exifItem, found = findExifItem(payload)
+		}
+	})
+	if !found {
+		return containerPatch{}, errContainerLayout
+	}
+	boxesIn(meta[4:], func(kind string, payload []byte) {
+		if kind == "iloc" {
+			offset, length, located = locateItem(payload, exifItem)
+		}
+	})
+	if !located || length < 10 {
+		return containerPatch{}, errContainerLayout
+	}
+
+	item := make([]byte, length)
+	if _, err := r.ReadAt(item, offset); err != nil {
+		return containerPatch{}, err
+	}
+	// The item starts with the offset of the TIFF header past these four bytes, usually
+	// skipping an "Exif\0\0" marker.
+	start := 4 + int64(binary.BigEndian.Uint32(item[:4]))
+	if start >= length {
+		return containerPatch{}, ErrBrokenMedia
+	}
+	original := item[start:]
+	t, err := parseTIFF(bytes.Clone(original))
+	if err != nil {
+		return containerPatch{}, err
+	}
+	if err := t.setDates(taken); err != nil {
+		return containerPatch{}, err
+	}
+	// The item is patched in place, so the offsets are only written where they fit, in
+	// photos that had them already.
+	withOffsets := &tiffBlock{data: bytes.Clone(t.data), order: t.order}
+	if withOffsets.setOffsets(taken) == nil && len(withOffsets.data) == len(original) {
+		t = withOffsets
+	}
+	if len(t.data) != len(original) {
+		return containerPatch{}, errContainerLayout
+	}
+	return containerPatch{offset: offset + start, data: t.data}, nil
+}
+
+// findExifItem returns the ID of the item of type Exif in an iinf payload.
+func findExifItem(iinf []byte) (uint32, bool) {
+	if len(iinf) < 6 {
+		return 0, false
+	}
+	entries := iinf[6:]
+	if iinf[0] != 0 {
+		if len(iinf) < 8 {
+			return 0, false
+		}
+		entries = iinf[8:]
+	}
+	var id uint32
+	var found bool
+	boxesIn(entries, func(kind string, infe []byte) {
+		if kind != "infe" || found || len(infe) < 1 {
+			return
+		}
+		// Only version 2 and 3 entries name the item's type.
+		switch {
+		case infe[0] == 2 && len(infe) >= 12:
+			if string(infe[8:12]) == "Exif" {
+				id, found = uint32(binary.BigEndian.Uint16(infe[4:6])), true
+			}
+		case infe[0] == 3 && len(infe) >= 14:
+			if string(infe[10:14]) == "Exif" {
+				id, found = binary.BigEndian.Uint32(infe[4:8]), true
+			}
+		}
+	})
+	return id, found
+}
+
+// locateItem returns where the item with the ID is in the file, from an iloc payload. Only
+// items stored whole in the file itself are located.
+func locateItem(iloc []byte, want uint32) (offset, length int64, ok bool) {
+	if len(iloc) < 8 {
+		return 0, 0, false
+	}
+	version := iloc[0]
+	offsetSize, lengthSize := int(iloc[4]>>4), int(iloc[4]&0x0F)
+	baseSize, indexSize := int(iloc[5]>>4), int(iloc[5]&0x0F)
+	if version == 0 {
+		indexSize = 0
+	}
+	pos := 6
+	read := func(n int) (uint64, bool) {
+		if pos+n > len(iloc) {
+			return 0, false
+		}
+		var v uint64
+		for _, b := range iloc[pos : pos+n] {
+			v = v<<8 | uint64(b)
+		}
+		pos += n
+		return v, true
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, ok := read(idSize)
+	if !ok {
+		return 0, 0, false
+	}
+	for range count {
+		id, ok := read(idSize)
+		if !ok {
+			return 0, 0, false
+		}
+		var method uint64
+		if version == 1 || version == 2 {
+			if method, ok = read(2); !ok {
+				return 0, 0, false
+			}
+			method &= 0x0F
+		}
+		reference, ok1 := read(2)
+		base, ok2 := read(baseSize)
+		extents, ok3 := read(2)
+		if !ok1 || !ok2 || !ok3 {
+			return 0, 0, false
+		}
+		var first, size uint64
+		for i := range extents {
+			if _, ok := read(indexSize); !ok {
+				return 0, 0, false
+			}
+			extentOffset, ok1 := read(offsetSize)
+			extentLength, ok2 := read(lengthSize)
+			if !ok1 || !ok2 {
+				return 0, 0, false
+			}
+			if i == 0 {
+				first, size = extentOffset, extentLength
+			}
+		}
+		if uint32(id) != want {
+			continue
+		}
+		if method != 0 || reference != 0 || extents != 1 {
+			return 0, 0, false
+		}
+		return int64(base + first), int64(size), true
+	}
+	return 0, 0, false
+}
+
+// editContainer sets the dates of the MP4 style file at path to taken. Only the header
+// bytes holding them are overwritten, in place, so multi-gigabyte videos aren't copied.
+func editContainer(path string, taken time.Time) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	patches, err := containerPatches(file, info.Size(), path, taken)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	for _, patch := range patches {
+		if _, err := file.WriteAt(patch.data, patch.offset); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// editedContainer returns the HEIC at path with its dates set to taken. Videos return
+// errExifUnsupported, so archives take them as they are instead of reading them into memory.
+func editedContainer(path string, taken time.Time) ([]byte, error) {
+	if containerVideo(path) {
+		return nil, errExifUnsupported
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	patches, err := containerPatches(bytes.NewReader(data), int64(len(data)), path, taken)
+	if err != nil {
+		return nil, err
+	}
+	for _, patch := range patches {
+		copy(data[patch.offset:], patch.data)
+	}
+	return data, nil
+}
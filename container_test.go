@@ -0,0 +1,195 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// box returns an MP4 box of the kind holding the payloads.
+func box(kind string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, kind...), payload...)
+}
+
+// movieHeader returns the payload of an mvhd, tkhd or mdhd box of the version, with its
+// creation and modification times set to seconds since containerEpoch.
+func movieHeader(version byte, seconds uint64) []byte {
+	header := []byte{version, 0, 0, 0}
+	if version == 1 {
+		header = binary.BigEndian.AppendUint64(header, seconds)
+		header = binary.BigEndian.AppendUint64(header, seconds)
+	} else {
+		header = binary.BigEndian.AppendUint32(header, uint32(seconds))
+		header = binary.BigEndian.AppendUint32(header, uint32(seconds))
+	}
+	return append(header, "timescale, duration and the rest"...)
+}
+
+// headerTimes returns the creation and modification times of the movie, track and media
+// headers in a moov payload, in seconds since containerEpoch.
+func headerTimes(moov []byte) []uint64 {
+	var times []uint64
+	read := func(header []byte) {
+		if header[0] == 1 {
+			times = append(times, binary.BigEndian.Uint64(header[4:]), binary.BigEndian.Uint64(header[12:]))
+		} else {
+			times = append(times, uint64(binary.BigEndian.Uint32(header[4:])), uint64(binary.BigEndian.Uint32(header[8:])))
+		}
+	}
+	var walk func(data []byte)
+	walk = func(data []byte) {
+		boxesIn(data, func(kind string, payload []byte) {
+			switch kind {
+			case "mvhd", "tkhd", "mdhd":
+				read(payload)
+			case "trak", "mdia":
+				walk(payload)
+			}
+		})
+	}
+	walk(moov)
+	return times
+}
+
+// writeMedia writes data to a file called name in a new folder and returns its path.
+func writeMedia(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEditContainerVideo(t *testing.T) {
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.UTC)
+	old := uint64(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Sub(containerEpoch) / time.Second)
+	want := uint64(taken.Sub(containerEpoch) / time.Second)
+
+	for _, test := range []struct {
+		name                string
+		movie, track, media byte // header versions
+		ext                 string
+	}{
+		{name: "version 0", ext: ".mp4"},
+		{name: "version 1", movie: 1, track: 1, media: 1, ext: ".mov"},
+		{name: "mixed versions", movie: 1, media: 1, ext: ".mp4"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+			moov := box("moov",
+				box("mvhd", movieHeader(test.movie, old)),
+				box("trak", box("tkhd", movieHeader(test.track, old)), box("mdia", box("mdhd", movieHeader(test.media, old)))),
+			)
+			mdat := box("mdat", []byte("frames"))
+			original := bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+			path := writeMedia(t, "clip"+test.ext, original)
+
+			if err := editContainer(path, taken); err != nil {
+				t.Fatal(err)
+			}
+			out, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out) != len(original) {
+				t.Fatalf("size %d, want %d", len(out), len(original))
+			}
+			if !bytes.Equal(out[:len(ftyp)], ftyp) || !bytes.Equal(out[len(ftyp)+len(moov):], mdat) {
+				t.Error("bytes outside the movie box changed")
+			}
+			times := headerTimes(out[len(ftyp)+8 : len(ftyp)+len(moov)])
+			if len(times) != 6 {
+				t.Fatalf("read %d header times, want 6", len(times))
+			}
+			for i, got := range times {
+				if got != want {
+					t.Errorf("time %d = %d, want %d", i, got, want)
+				}
+			}
+
+			if _, err := editedContainer(path, taken); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("editedContainer of a video returned %v, want ErrUnsupported", err)
+			}
+		})
+	}
+}
+
+func TestEditContainerUnsupported(t *testing.T) {
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.UTC)
+	noMovie := writeMedia(t, "clip.mp4", box("ftyp", []byte("isom\x00\x00\x02\x00")))
+	if err := editContainer(noMovie, taken); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("a video without a movie box returned %v, want ErrUnsupported", err)
+	}
+	movie := writeMedia(t, "clip.mp4", box("moov", box("mvhd", movieHeader(0, 0))))
+	if err := editContainer(movie, time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("a date before 1904 returned %v, want ErrUnsupported", err)
+	}
+}
+
+// heicOf returns a HEIC whose EXIF item holds the TIFF block.
+func heicOf(tiff []byte) []byte {
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	item := append([]byte("\x00\x00\x00\x06Exif\x00\x00"), tiff...)
+	meta := func(offset int) []byte {
+		infe := box("infe", []byte{2, 0, 0, 0, 0, 1, 0, 0}, []byte("Exif\x00"))
+		iinf := box("iinf", []byte{0, 0, 0, 0, 0, 1}, infe)
+		// Version 0, 4-byte offsets and lengths, one item with a single extent.
+		location := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1, 0, 0, 0, 1}
+		location = binary.BigEndian.AppendUint32(location, uint32(offset))
+		location = binary.BigEndian.AppendUint32(location, uint32(len(item)))
+		return box("meta", []byte{0, 0, 0, 0}, box("hdlr", []byte("\x00\x00\x00\x00\x00\x00\x00\x00pict")), iinf, box("iloc", location))
+	}
+	offset := len(ftyp) + len(meta(0)) + 8
+	return bytes.Join([][]byte{ftyp, meta(offset), box("mdat", item)}, nil)
+}
+
+func TestEditContainerHEIC(t *testing.T) {
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.FixedZone("CEST", 2*3600))
+	for _, order := range []string{"II", "MM"} {
+		t.Run(order, func(t *testing.T) {
+			tiff := tiffOf(t, order, old)
+			original := heicOf(tiff)
+			path := writeMedia(t, "photo.heic", original)
+
+			out, err := editedContainer(path, taken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out) != len(original) {
+				t.Fatalf("size %d, want %d", len(out), len(original))
+			}
+			start := len(original) - len(tiff)
+			if !bytes.Equal(out[:start], original[:start]) {
+				t.Error("bytes outside the EXIF item changed")
+			}
+			block, err := parseTIFF(out[start:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTaken(t, block, taken)
+
+			if err := editContainer(path, taken); err != nil {
+				t.Fatal(err)
+			}
+			if edited, err := os.ReadFile(path); err != nil || !bytes.Equal(edited, out) {
+				t.Errorf("editing in place differs from the edited copy (%v)", err)
+			}
+		})
+	}
+}
+
+func TestEditContainerHEICWithoutDates(t *testing.T) {
+	// Writing dates into an EXIF item without them would grow it and move the image data.
+	path := writeMedia(t, "photo.heic", heicOf(emptyTIFF().data))
+	if err := editContainer(path, time.Date(2017, 7, 14, 4, 40, 0, 0, time.UTC)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("a HEIC without EXIF dates returned %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,179 @@
+package takeout
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mediaEdit is a MediaEdit as changes to a file: changes to its EXIF block and to its IPTC
+// record, either of which may be nil, and the taken time MP4 style files only take their
+// dates from, zero unless the edit writes dates.
+type mediaEdit struct {
+	exif  func(t *tiffBlock) error
+	iptc  func(record []byte) ([]byte, error)
+	dates time.Time
+}
+
+// editedMedia returns the media at path with edit applied. JPEG, plain TIFF and HEIC files
+// are supported; other formats, and videos, return errExifUnsupported.
+func editedMedia(path string, edit *mediaEdit) ([]byte, error) {
+	if containerFormat(path) {
+		if edit.dates.IsZero() {
+			return nil, errExifUnsupported
+		}
+		return editedContainer(path, edit.dates)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".tif" || ext == ".tiff" {
+		return editedExif(path, func(t *tiffBlock) error {
+			if edit.exif != nil {
+				if err := edit.exif(t); err != nil {
+					return err
+				}
+			}
+			if edit.iptc != nil {
+				return t.setIPTC(edit.iptc)
+			}
+			return nil
+		})
+	}
+
+	if edit.exif == nil {
+		// IPTC alone leaves the EXIF alone, rather than adding an empty block to JPEGs without one.
+		switch ext {
+		case ".jpg", ".jpeg", ".jpe", ".jfif":
+		default:
+			return nil, errExifUnsupported
+		}
+		if edit.iptc == nil {
+			return nil, errExifUnsupported
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return editJPEGIPTC(data, edit.iptc)
+	}
+	data, err := editedExif(path, edit.exif)
+	if err != nil || edit.iptc == nil {
+		return data, err
+	}
+	return editJPEGIPTC(data, edit.iptc)
+}
+
+// changes returns the changes to the EXIF and IPTC of a JPEG or TIFF file, and to the
+// dates of an MP4 style file, that make up requested, or nil if there are none.
+func (requested MediaEdit) changes() *mediaEdit {
+	meta, local := requested.Meta, requested.Taken
+	location, hasLocation := meta.Location()
+	dates, gps := requested.Dates, requested.Location && hasLocation
+	var edit mediaEdit
+	if dates {
+		edit.dates = local
+	}
+	if dates || gps {
+		edit.exif = func(t *tiffBlock) error {
+			if dates {
+				if err := t.setDates(local); err != nil {
+					return err
+				}
+				if err := t.setOffsets(local); err != nil {
+					return err
+				}
+			}
+			if gps {
+				return t.setGPS(location)
+			}
+			return nil
+		}
+	}
+	var description string
+	var names []string
+	if requested.Captions {
+		description, names = strings.TrimSpace(meta.Description), meta.PeopleNames()
+	}
+	captions := description != "" || len(names) > 0
+	if requested.IPTC || captions {
+		edit.iptc = func(record []byte) ([]byte, error) {
+			var err error
+			if requested.IPTC {
+				if record, err = iptcDates(record, local); err != nil {
+					return nil, err
+				}
+			}
+			if captions {
+				record, err = iptcCaptions(record, description, names)
+			}
+			return record, err
+		}
+	}
+	if edit.exif == nil && edit.iptc == nil {
+		return nil
+	}
+	return &edit
+}
+
+// exifHandler is the Handler of JPEG and TIFF files, which take the taken time, location and
+// captions into their EXIF and IPTC.
+type exifHandler struct{}
+
+// edited returns the file at path with edit applied, or an error wrapping ErrUnsupported
+// for edits with nothing to write.
+func (exifHandler) edited(path string, edit MediaEdit) ([]byte, error) {
+	changes := edit.changes()
+	if changes == nil {
+		return nil, errExifUnsupported
+	}
+	return editedMedia(path, changes)
+}
+
+func (h exifHandler) Edit(path string, edit MediaEdit) (bool, error) {
+	out, err := h.edited(path, edit)
+	if err != nil {
+		return false, err
+	}
+	if err := ReplaceFile(path, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h exifHandler) EditTo(w io.Writer, path string, edit MediaEdit) (bool, error) {
+	out, err := h.edited(path, edit)
+	if err != nil {
+		return false, err
+	}
+	if _, err := w.Write(out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// containerHandler is the Handler of MP4 style files: it writes the taken time into the
+// movie headers of videos and the EXIF item of HEIC photos, in place. Their location and
+// captions are left to an XMP sidecar.
+type containerHandler struct{}
+
+func (containerHandler) Edit(path string, edit MediaEdit) (bool, error) {
+	if !edit.Dates {
+		return false, errExifUnsupported
+	}
+	return false, editContainer(path, edit.Taken)
+}
+
+// EditTo writes HEIC photos with their dates set. Videos return ErrUnsupported, so
+// archives take them as they are instead of reading them into memory.
+func (containerHandler) EditTo(w io.Writer, path string, edit MediaEdit) (bool, error) {
+	if !edit.Dates {
+		return false, errExifUnsupported
+	}
+	out, err := editedContainer(path, edit.Taken)
+	if err != nil {
+		return false, err
+	}
+	_, err = w.Write(out)
+	return false, err
+}
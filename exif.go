@@ -0,0 +1,406 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errExifUnsupported means the format of the media has no EXIF block the package can write.
+var errExifUnsupported = fmt.Errorf("%w: no writable EXIF", ErrUnsupported)
+
+// errExifTooLarge means the EXIF block would outgrow the 64 KiB a JPEG segment can hold.
+var errExifTooLarge = errors.New("EXIF block too large for a JPEG segment")
+
+// EXIF tags of the taken time.
+const (
+	tagDateTime            = 0x0132 // ModifyDate
+	tagExifIFD             = 0x8769
+	tagDateTimeOriginal    = 0x9003
+	tagDateTimeDigitized   = 0x9004 // CreateDate
+	tagOffsetTime          = 0x9010 // zone of ModifyDate
+	tagOffsetTimeOriginal  = 0x9011
+	tagOffsetTimeDigitized = 0x9012
+)
+
+// TIFF field types.
+const (
+	typeASCII = 2
+	typeLong  = 4
+)
+
+// ifdEntry is a single field of an image file directory.
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    [4]byte // the value itself if it fits, otherwise the offset of the value
+	at       uint32  // offset of the entry in the TIFF block, 0 for added entries
+}
+
+// ifd is an image file directory of a TIFF block. Changes that fit the existing layout
+// are made in place; otherwise the directory is dirty and is appended to the block anew,
+// leaving every other offset in the block valid.
+type ifd struct {
+	entries []ifdEntry
+	next    uint32
+	dirty   bool
+}
+
+// byteOrder reads and appends integers in the byte order of a TIFF block.
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffBlock is a TIFF structure, either a whole TIFF file or the payload of a JPEG's EXIF segment.
+type tiffBlock struct {
+	data  []byte
+	order byteOrder
+}
+
+// parseTIFF checks the TIFF header of data.
+func parseTIFF(data []byte) (*tiffBlock, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated TIFF header")
+	}
+	t := &tiffBlock{data: data}
+	switch string(data[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid TIFF header")
+	}
+	return t, nil
+}
+
+// emptyTIFF returns a big-endian TIFF block with an empty first directory.
+func emptyTIFF() *tiffBlock {
+	return &tiffBlock{data: []byte("MM\x00*\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00"), order: binary.BigEndian}
+}
+
+// readIFD reads the directory at offset.
+func (t *tiffBlock) readIFD(offset uint32) (*ifd, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("directory offset %d outside the TIFF block", offset)
+	}
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	end := uint64(offset) + 2 + uint64(count)*12
+	if end+4 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("truncated directory at %d", offset)
+	}
+	d := &ifd{next: t.order.Uint32(t.data[end:])}
+	for i := uint32(0); i < count; i++ {
+		at := offset + 2 + i*12
+		e := ifdEntry{
+			tag:   t.order.Uint16(t.data[at:]),
+			typ:   t.order.Uint16(t.data[at+2:]),
+			count: t.order.Uint32(t.data[at+4:]),
+			at:    at,
+		}
+		copy(e.value[:], t.data[at+8:at+12])
+		d.entries = append(d.entries, e)
+	}
+	return d, nil
+}
+
+// entry returns the entry for tag, or nil.
+func (d *ifd) entry(tag uint16) *ifdEntry {
+	for i := range d.entries {
+		if d.entries[i].tag == tag {
+			return &d.entries[i]
+		}
+	}
+	return nil
+}
+
+// set stores value, count values of type typ, as the field tag of d. An existing field of
+// the same type and count is overwritten in place; anything else is appended to the block.
+func (t *tiffBlock) set(d *ifd, tag, typ uint16, count uint32, value []byte) {
+	e := d.entry(tag)
+	if e != nil && e.typ == typ && e.count == count {
+		if len(value) <= 4 {
+			copy(e.value[:], value)
+			if e.at != 0 {
+				copy(t.data[e.at+8:e.at+12], e.value[:])
+			}
+			return
+		}
+		if offset := t.order.Uint32(e.value[:]); uint64(offset)+uint64(len(value)) <= uint64(len(t.data)) {
+			copy(t.data[offset:], value)
+			return
+		}
+	}
+
+	var field [4]byte
+	if len(value) <= 4 {
+		copy(field[:], value)
+	} else {
+		t.align()
+		t.order.PutUint32(field[:], uint32(len(t.data)))
+		t.data = append(t.data, value...)
+	}
+	if e == nil {
+		d.entries = append(d.entries, ifdEntry{tag: tag})
+		e = &d.entries[len(d.entries)-1]
+	}
+	e.typ, e.count, e.value, e.at = typ, count, field, 0
+	d.dirty = true
+}
+
+// setASCII stores s as a NUL-terminated ASCII field.
+func (t *tiffBlock) setASCII(d *ifd, tag uint16, s string) {
+	t.set(d, tag, typeASCII, uint32(len(s)+1), append([]byte(s), 0))
+}
+
+// setLong stores v as a single LONG field.
+func (t *tiffBlock) setLong(d *ifd, tag uint16, v uint32) {
+	value := make([]byte, 4)
+	t.order.PutUint32(value, v)
+	t.set(d, tag, typeLong, 1, value)
+}
+
+// align pads the block to the word boundary TIFF offsets must start on.
+func (t *tiffBlock) align() {
+	if len(t.data)%2 != 0 {
+		t.data = append(t.data, 0)
+	}
+}
+
+// appendIFD writes d at the end of the block, with its entries sorted by tag as TIFF
+// requires, and returns its offset.
+func (t *tiffBlock) appendIFD(d *ifd) uint32 {
+	sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].tag < d.entries[j].tag })
+	t.align()
+	offset := uint32(len(t.data))
+	t.data = t.order.AppendUint16(t.data, uint16(len(d.entries)))
+	for _, e := range d.entries {
+		t.data = t.order.AppendUint16(t.data, e.tag)
+		t.data = t.order.AppendUint16(t.data, e.typ)
+		t.data = t.order.AppendUint32(t.data, e.count)
+		t.data = append(t.data, e.value[:]...)
+	}
+	t.data = t.order.AppendUint32(t.data, d.next)
+	return offset
+}
+
+// subIFD returns the directory the pointer field tag of parent points to, or a new empty
+// one if parent has none.
+func (t *tiffBlock) subIFD(parent *ifd, tag uint16) (*ifd, error) {
+	e := parent.entry(tag)
+	if e == nil {
+		return &ifd{dirty: true}, nil
+	}
+	return t.readIFD(t.order.Uint32(e.value[:]))
+}
+
+// storeSubIFD appends child if it changed and points the field tag of parent at it.
+func (t *tiffBlock) storeSubIFD(parent, child *ifd, tag uint16) {
+	if child.dirty {
+		t.setLong(parent, tag, t.appendIFD(child))
+	}
+}
+
+// storeRoot appends the first directory if it changed and points the header at it.
+func (t *tiffBlock) storeRoot(root *ifd) {
+	if root.dirty {
+		// Appending may move the block, so the header is only sliced afterwards.
+		offset := t.appendIFD(root)
+		t.order.PutUint32(t.data[4:8], offset)
+	}
+}
+
+// exifTime formats t the way EXIF date fields hold it, without a zone.
+func exifTime(t time.Time) string {
+	return t.Format("2006:01:02 15:04:05")
+}
+
+// exifOffset formats the UTC offset of t the way the EXIF offset fields hold it, e.g. "+02:00".
+func exifOffset(t time.Time) string {
+	return t.Format("-07:00")
+}
+
+// setDates writes the taken time into DateTimeOriginal, CreateDate and ModifyDate, in the
+// zone of taken.
+func (t *tiffBlock) setDates(taken time.Time) error {
+	root, err := t.readIFD(t.order.Uint32(t.data[4:8]))
+	if err != nil {
+		return err
+	}
+	exif, err := t.subIFD(root, tagExifIFD)
+	if err != nil {
+		return err
+	}
+
+	stamp := exifTime(taken)
+	t.setASCII(exif, tagDateTimeOriginal, stamp)
+	t.setASCII(exif, tagDateTimeDigitized, stamp)
+	t.storeSubIFD(root, exif, tagExifIFD)
+	t.setASCII(root, tagDateTime, stamp)
+	t.storeRoot(root)
+	return nil
+}
+
+// setOffsets writes the UTC offset of taken into the OffsetTime fields paired with the
+// dates setDates writes, so readers don't have to guess the zone the dates are in.
+func (t *tiffBlock) setOffsets(taken time.Time) error {
+	root, err := t.readIFD(t.order.Uint32(t.data[4:8]))
+	if err != nil {
+		return err
+	}
+	exif, err := t.subIFD(root, tagExifIFD)
+	if err != nil {
+		return err
+	}
+
+	offset := exifOffset(taken)
+	t.setASCII(exif, tagOffsetTime, offset)
+	t.setASCII(exif, tagOffsetTimeOriginal, offset)
+	t.setASCII(exif, tagOffsetTimeDigitized, offset)
+	t.storeSubIFD(root, exif, tagExifIFD)
+	t.storeRoot(root)
+	return nil
+}
+
+// exifHeader starts the payload of a JPEG's EXIF segment.
+var exifHeader = []byte("Exif\x00\x00")
+
+// editJPEGExif rewrites the EXIF segment of a JPEG with edit, adding one after the
+// JFIF header if the file has none. Everything else in the file is kept byte for byte.
+func editJPEGExif(data []byte, edit func(t *tiffBlock) error) ([]byte, error) {
+	if !isJPEG(data) {
+		return nil, ErrBrokenMedia
+	}
+
+	insert, start, end := 2, -1, -1
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // image data follows; metadata segments come before it
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		next := pos + 2 + length
+		if length < 2 || next > len(data) {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		if marker == 0xE0 && insert == pos {
+			insert = next
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[pos+4:next], exifHeader) {
+			start, end = pos, next
+			break
+		}
+		pos = next
+	}
+
+	var t *tiffBlock
+	if start >= 0 {
+		var err error
+		if t, err = parseTIFF(bytes.Clone(data[start+4+len(exifHeader) : end])); err != nil {
+			return nil, err
+		}
+	} else {
+		t = emptyTIFF()
+		start, end = insert, insert
+	}
+	if err := edit(t); err != nil {
+		return nil, err
+	}
+
+	length := 2 + len(exifHeader) + len(t.data)
+	if length > 0xFFFF {
+		return nil, errExifTooLarge
+	}
+	out := make([]byte, 0, len(data)-(end-start)+2+length)
+	out = append(out, data[:start]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(length))
+	out = append(out, exifHeader...)
+	out = append(out, t.data...)
+	return append(out, data[end:]...), nil
+}
+
+// editedExif returns the media at path with edit applied to its EXIF. Only JPEG and plain
+// TIFF files are supported; other formats return errExifUnsupported.
+func editedExif(path string, edit func(t *tiffBlock) error) ([]byte, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".jpg", ".jpeg", ".jpe", ".jfif", ".tif", ".tiff":
+	default:
+		return nil, errExifUnsupported
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ext == ".tif" || ext == ".tiff" {
+		t, err := parseTIFF(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := edit(t); err != nil {
+			return nil, err
+		}
+		if len(t.data) > 0xFFFFFFFF {
+			return nil, errors.New("TIFF file too large for its offsets")
+		}
+		return t.data, nil
+	}
+	return editJPEGExif(data, edit)
+}
+
+// errDateRead stops editedExif once the dates have been read.
+var errDateRead = errors.New("date read")
+
+// ExifTakenTime reads the EXIF DateTimeOriginal of the JPEG or TIFF file at path. EXIF dates
+// carry no zone, so it is returned as UTC.
+func ExifTakenTime(path string) (time.Time, bool) {
+	var stamp string
+	_, err := editedExif(path, func(t *tiffBlock) error {
+		root, err := t.readIFD(t.order.Uint32(t.data[4:8]))
+		if err != nil {
+			return err
+		}
+		if root.entry(tagExifIFD) == nil {
+			return errDateRead
+		}
+		exif, err := t.subIFD(root, tagExifIFD)
+		if err != nil {
+			return err
+		}
+		if e := exif.entry(tagDateTimeOriginal); e != nil {
+			stamp = t.ascii(e)
+		}
+		return errDateRead
+	})
+	if !errors.Is(err, errDateRead) || stamp == "" {
+		return time.Time{}, false
+	}
+	taken, err := time.Parse("2006:01:02 15:04:05", stamp)
+	return taken, err == nil
+}
+
+// ascii returns the value of an ASCII field without its terminating NUL.
+func (t *tiffBlock) ascii(e *ifdEntry) string {
+	value := e.value[:]
+	if e.count > 4 {
+		offset := uint64(t.order.Uint32(e.value[:]))
+		if offset+uint64(e.count) > uint64(len(t.data)) {
+			return ""
+		}
+		value = t.data[offset : offset+uint64(e.count)]
+	}
+	value = value[:min(len(value), int(e.count))]
+	if i := bytes.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return string(value)
+}
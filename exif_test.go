@@ -0,0 +1,282 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// minimalJPEG is the smallest file that passes for a JPEG: its start and end markers.
+const minimalJPEG = "\xff\xd8\xff\xd9"
+
+// exifOf returns the TIFF block of the EXIF segment of a JPEG.
+func exifOf(t *testing.T, jpeg []byte) *tiffBlock {
+	t.Helper()
+	for pos := 2; pos+4 <= len(jpeg) && jpeg[pos] == 0xFF; {
+		length := int(binary.BigEndian.Uint16(jpeg[pos+2:]))
+		payload := jpeg[pos+4 : pos+2+length]
+		if jpeg[pos+1] == 0xE1 && bytes.HasPrefix(payload, exifHeader) {
+			block, err := parseTIFF(payload[len(exifHeader):])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return block
+		}
+		pos += 2 + length
+	}
+	t.Fatal("no EXIF segment")
+	return nil
+}
+
+// asciiFields returns the ASCII fields of the first directory and the EXIF directory of the
+// block, by tag.
+func asciiFields(t *testing.T, block *tiffBlock) map[uint16]string {
+	t.Helper()
+	root, err := block.readIFD(block.order.Uint32(block.data[4:8]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[uint16]string)
+	directories := []*ifd{root}
+	if root.entry(tagExifIFD) != nil {
+		exif, err := block.subIFD(root, tagExifIFD)
+		if err != nil {
+			t.Fatal(err)
+		}
+		directories = append(directories, exif)
+	}
+	for _, d := range directories {
+		for i := range d.entries {
+			if e := &d.entries[i]; e.typ == typeASCII {
+				fields[e.tag] = block.ascii(e)
+			}
+		}
+	}
+	return fields
+}
+
+func TestDatesCarryOffset(t *testing.T) {
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.FixedZone("CEST", 2*3600))
+	out, err := editJPEGExif([]byte(minimalJPEG), func(block *tiffBlock) error {
+		if err := block.setDates(taken); err != nil {
+			return err
+		}
+		return block.setOffsets(taken)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := asciiFields(t, exifOf(t, out))
+	for tag, want := range map[uint16]string{
+		tagDateTime:            "2017:07:14 04:40:00",
+		tagDateTimeOriginal:    "2017:07:14 04:40:00",
+		tagDateTimeDigitized:   "2017:07:14 04:40:00",
+		tagOffsetTime:          "+02:00",
+		tagOffsetTimeOriginal:  "+02:00",
+		tagOffsetTimeDigitized: "+02:00",
+	} {
+		if got := fields[tag]; got != want {
+			t.Errorf("tag %#04x = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+// tagMake is the EXIF field of the camera maker, which edits must keep.
+const tagMake = 0x010F
+
+// scan is the start of the image data of the test JPEGs, which edits must keep byte for byte.
+const scan = "\xff\xda\x00\x08\x01\x01\x00\x00\x3f\x00image data\xff\xd9"
+
+// segment returns a JPEG segment of the marker holding payload.
+func segment(marker byte, payload string) string {
+	length := len(payload) + 2
+	return string([]byte{0xFF, marker, byte(length >> 8), byte(length)}) + payload
+}
+
+// jpegOf returns a JPEG of the segments followed by the scan.
+func jpegOf(segments ...string) []byte {
+	return []byte("\xff\xd8" + strings.Join(segments, "") + scan)
+}
+
+// segmentsOf returns the segments of a JPEG before its image data.
+func segmentsOf(t *testing.T, jpeg []byte) []string {
+	t.Helper()
+	var segments []string
+	for pos := 2; pos+4 <= len(jpeg) && jpeg[pos] == 0xFF && jpeg[pos+1] != 0xDA; {
+		next := pos + 2 + int(binary.BigEndian.Uint16(jpeg[pos+2:]))
+		if next > len(jpeg) {
+			t.Fatal("truncated segment")
+		}
+		segments = append(segments, string(jpeg[pos:next]))
+		pos = next
+	}
+	return segments
+}
+
+// tiffOf returns a TIFF block in the byte order, "II" or "MM", with a Make field and the
+// dates and their offsets set to taken.
+func tiffOf(t *testing.T, order string, taken time.Time) []byte {
+	t.Helper()
+	block := emptyTIFF()
+	if order == "II" {
+		block = &tiffBlock{data: []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00"), order: binary.LittleEndian}
+	}
+	root, err := block.readIFD(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.setASCII(root, tagMake, "Pixel")
+	block.storeRoot(root)
+	if err := block.setDates(taken); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.setOffsets(taken); err != nil {
+		t.Fatal(err)
+	}
+	return block.data
+}
+
+// setTaken is the EXIF edit of the tests, writing the dates and offsets of taken.
+func setTaken(taken time.Time) func(block *tiffBlock) error {
+	return func(block *tiffBlock) error {
+		if err := block.setDates(taken); err != nil {
+			return err
+		}
+		return block.setOffsets(taken)
+	}
+}
+
+// checkTaken checks that the block holds the Make field and the dates of taken.
+func checkTaken(t *testing.T, block *tiffBlock, taken time.Time) {
+	t.Helper()
+	fields := asciiFields(t, block)
+	for tag, want := range map[uint16]string{
+		tagMake:               "Pixel",
+		tagDateTime:           exifTime(taken),
+		tagDateTimeOriginal:   exifTime(taken),
+		tagDateTimeDigitized:  exifTime(taken),
+		tagOffsetTimeOriginal: exifOffset(taken),
+	} {
+		if got := fields[tag]; got != want {
+			t.Errorf("tag %#04x = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestEditJPEGExif(t *testing.T) {
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.FixedZone("CEST", 2*3600))
+	jfif := segment(0xE0, "JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00")
+	icc := segment(0xE2, "ICC_PROFILE\x00\x01\x01profile")
+	exif := func(order string) string { return segment(0xE1, string(exifHeader)+string(tiffOf(t, order, old))) }
+
+	for _, test := range []struct {
+		name     string
+		segments []string
+		order    string // of an existing EXIF block
+		markers  []byte // of the edited segments
+	}{
+		{name: "without segments", markers: []byte{0xE1}},
+		{name: "without EXIF", segments: []string{jfif}, markers: []byte{0xE0, 0xE1}},
+		{name: "without EXIF after ICC", segments: []string{jfif, icc}, markers: []byte{0xE0, 0xE1, 0xE2}},
+		{name: "little endian", segments: []string{exif("II")}, order: "II", markers: []byte{0xE1}},
+		{name: "big endian", segments: []string{exif("MM")}, order: "MM", markers: []byte{0xE1}},
+		{name: "after JFIF and ICC", segments: []string{jfif, icc, exif("II")}, order: "II", markers: []byte{0xE0, 0xE2, 0xE1}},
+		{name: "before ICC", segments: []string{exif("MM"), icc}, order: "MM", markers: []byte{0xE1, 0xE2}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := editJPEGExif(jpegOf(test.segments...), setTaken(taken))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(out, []byte(scan)) {
+				t.Error("image data changed")
+			}
+
+			segments := segmentsOf(t, out)
+			var markers []byte
+			var kept []string
+			for _, s := range segments {
+				markers = append(markers, s[1])
+				if s[1] != 0xE1 {
+					kept = append(kept, s)
+				}
+			}
+			if !bytes.Equal(markers, test.markers) {
+				t.Errorf("segment markers % X, want % X", markers, test.markers)
+			}
+			var others []string
+			for _, s := range test.segments {
+				if s[1] != 0xE1 {
+					others = append(others, s)
+				}
+			}
+			if !slices.Equal(kept, others) {
+				t.Error("segments other than EXIF changed")
+			}
+
+			block := exifOf(t, out)
+			if test.order != "" {
+				if got := string(block.data[:2]); got != test.order {
+					t.Errorf("byte order %s, want the original %s", got, test.order)
+				}
+				checkTaken(t, block, taken)
+			} else if fields := asciiFields(t, block); fields[tagDateTimeOriginal] != exifTime(taken) {
+				t.Errorf("DateTimeOriginal = %q, want %q", fields[tagDateTimeOriginal], exifTime(taken))
+			}
+		})
+	}
+}
+
+func TestEditedTIFF(t *testing.T) {
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.FixedZone("CEST", 2*3600))
+	for _, order := range []string{"II", "MM"} {
+		t.Run(order, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scan.tif")
+			if err := os.WriteFile(path, tiffOf(t, order, old), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := editedExif(path, setTaken(taken))
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, err := parseTIFF(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(out[:2]); got != order {
+				t.Errorf("byte order %s, want %s", got, order)
+			}
+			checkTaken(t, block, taken)
+
+			if err := os.WriteFile(path, out, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := ExifTakenTime(path)
+			if want := time.Date(2017, 7, 14, 4, 40, 0, 0, time.UTC); !ok || !got.Equal(want) {
+				t.Errorf("ExifTakenTime = %v, %v, want %v", got, ok, want)
+			}
+		})
+	}
+}
+
+func TestEditedExifRejectsOtherFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := editedExif(path, setTaken(time.Now())); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("editing a PNG returned %v, want ErrUnsupported", err)
+	}
+	if _, err := editJPEGExif([]byte("not a jpeg"), setTaken(time.Now())); !errors.Is(err, ErrBrokenMedia) {
+		t.Errorf("editing a broken JPEG returned %v, want ErrBrokenMedia", err)
+	}
+}
@@ -0,0 +1,39 @@
+package takeout
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Known reports whether the sidecar recorded a location. Google writes zeros when it has none.
+func (g GeoData) Known() bool {
+	return g.Latitude != 0 || g.Longitude != 0
+}
+
+// Location returns the geographic location of the item, preferring the coordinates Google
+// read from the file's EXIF over the ones it inferred.
+func (t *Takeout) Location() (GeoData, bool) {
+	switch {
+	case t.GeoDataExif.Known():
+		return t.GeoDataExif, true
+	case t.GeoData.Known():
+		return t.GeoData, true
+	}
+	return GeoData{}, false
+}
+
+// NauticalZone approximates the time zone at the coordinates by their nautical zone, one hour
+// per 15 degrees of longitude. It knows neither political boundaries nor daylight saving
+// time, so it is often an hour off, and more where a country keeps a zone far from its
+// longitude: Munich in summer comes out an hour behind CEST, Spain an hour behind its clocks
+// all year, India half an hour off and western China hours off. Use it only where the zone
+// is otherwise unknown and a date close to the local one beats the zone of the machine.
+func NauticalZone(g GeoData) *time.Location {
+	offset := int(math.Round(g.Longitude / 15))
+	name := "UTC"
+	if offset != 0 {
+		name = fmt.Sprintf("UTC%+d", offset)
+	}
+	return time.FixedZone(name, offset*3600)
+}
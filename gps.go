@@ -0,0 +1,86 @@
+package takeout
+
+import (
+	"math"
+)
+
+// EXIF GPS tags of the location.
+const (
+	tagGPSIFD          = 0x8825
+	tagGPSVersionID    = 0x0000
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// More TIFF field types.
+const (
+	typeByte     = 1
+	typeRational = 5
+)
+
+// setRationals stores values as RATIONAL fields with the given denominator.
+func (t *tiffBlock) setRationals(d *ifd, tag uint16, denominator uint32, values ...float64) {
+	var value []byte
+	for _, v := range values {
+		value = t.order.AppendUint32(value, uint32(math.Round(v*float64(denominator))))
+		value = t.order.AppendUint32(value, denominator)
+	}
+	t.set(d, tag, typeRational, uint32(len(values)), value)
+}
+
+// degrees splits a coordinate into degrees, minutes and seconds.
+// The seconds are rounded to the precision they are stored with first, so that
+// they never round up to a full minute.
+func degrees(coordinate float64) (deg, min, sec float64) {
+	total := math.Round(math.Abs(coordinate)*3600*10000) / 10000
+	deg = math.Floor(total / 3600)
+	min = math.Floor((total - deg*3600) / 60)
+	sec = total - deg*3600 - min*60
+	return deg, min, sec
+}
+
+// hemispheres returns the EXIF reference letters of the coordinates.
+func hemispheres(g GeoData) (lat, lon string) {
+	lat, lon = "N", "E"
+	if g.Latitude < 0 {
+		lat = "S"
+	}
+	if g.Longitude < 0 {
+		lon = "W"
+	}
+	return lat, lon
+}
+
+// setGPS writes the location into the GPS directory of the EXIF block.
+func (t *tiffBlock) setGPS(g GeoData) error {
+	root, err := t.readIFD(t.order.Uint32(t.data[4:8]))
+	if err != nil {
+		return err
+	}
+	gps, err := t.subIFD(root, tagGPSIFD)
+	if err != nil {
+		return err
+	}
+
+	latRef, lonRef := hemispheres(g)
+	t.set(gps, tagGPSVersionID, typeByte, 4, []byte{2, 3, 0, 0})
+	t.setASCII(gps, tagGPSLatitudeRef, latRef)
+	d, m, s := degrees(g.Latitude)
+	t.setRationals(gps, tagGPSLatitude, 10000, d, m, s)
+	t.setASCII(gps, tagGPSLongitudeRef, lonRef)
+	d, m, s = degrees(g.Longitude)
+	t.setRationals(gps, tagGPSLongitude, 10000, d, m, s)
+	below := byte(0)
+	if g.Altitude < 0 {
+		below = 1
+	}
+	t.set(gps, tagGPSAltitudeRef, typeByte, 1, []byte{below})
+	t.setRationals(gps, tagGPSAltitude, 100, math.Abs(g.Altitude))
+	t.storeSubIFD(root, gps, tagGPSIFD)
+	t.storeRoot(root)
+	return nil
+}
@@ -0,0 +1,90 @@
+package takeout
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported means a Handler can't write an edit into a media file, such as a format
+// without room for the metadata. The media then only gets its file times.
+var ErrUnsupported = errors.New("format not supported")
+
+// MediaEdit is the metadata of an item to write into its media file.
+type MediaEdit struct {
+	// Meta is the item's sidecar.
+	Meta *Takeout
+	// Taken is the item's taken time, in the zone its local dates are written in.
+	Taken time.Time
+	// Dates, IPTC, Location and Captions choose what to write: the taken time into the
+	// format's date fields, the taken time into IPTC dates, the sidecar's location, and its
+	// description and the names of the people in it.
+	Dates, IPTC, Location, Captions bool
+}
+
+// Handler writes the metadata of items into media files of the formats it is registered for.
+type Handler interface {
+	// Edit writes edit into the media file at path, in place, and reports whether the file
+	// now holds all of it, so that no XMP sidecar needs to carry the rest. It returns
+	// ErrUnsupported for files or edits it can't write.
+	Edit(path string, edit MediaEdit) (complete bool, err error)
+	// EditTo writes the media file at path with edit applied to w, leaving the file as it
+	// is, for callers that store the result elsewhere, such as in an archive. It reports
+	// completeness like Edit, and returns ErrUnsupported, before writing anything, for
+	// files or edits it can't write this way.
+	EditTo(w io.Writer, path string, edit MediaEdit) (complete bool, err error)
+}
+
+// TimesOnly is the Handler of the formats nothing else is registered for. It writes
+// nothing, since the file times are all such media gets.
+var TimesOnly Handler = timesOnly{}
+
+type timesOnly struct{}
+
+func (timesOnly) Edit(string, MediaEdit) (bool, error) { return false, ErrUnsupported }
+
+func (timesOnly) EditTo(io.Writer, string, MediaEdit) (bool, error) { return false, ErrUnsupported }
+
+// handlers holds the registered handlers by lowercase extension.
+var handlers = struct {
+	mu    sync.RWMutex
+	byExt map[string]Handler
+}{byExt: builtinHandlers()}
+
+// builtinHandlers returns the handlers of the formats the package writes into: the EXIF and
+// IPTC of JPEG and TIFF files and the dates of MP4 style files.
+func builtinHandlers() map[string]Handler {
+	byExt := make(map[string]Handler)
+	for _, ext := range []string{".jpg", ".jpeg", ".jpe", ".jfif", ".tif", ".tiff"} {
+		byExt[ext] = exifHandler{}
+	}
+	for _, ext := range containerExts {
+		byExt[ext] = containerHandler{}
+	}
+	return byExt
+}
+
+// RegisterHandler makes h the handler of media with the extension ext, such as ".jpg",
+// regardless of case. A later registration for the same extension replaces an earlier one.
+func RegisterHandler(ext string, h Handler) {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	handlers.mu.Lock()
+	defer handlers.mu.Unlock()
+	handlers.byExt[ext] = h
+}
+
+// HandlerFor returns the handler registered for the extension of path, or TimesOnly.
+func HandlerFor(path string) Handler {
+	handlers.mu.RLock()
+	defer handlers.mu.RUnlock()
+	if h, ok := handlers.byExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return h
+	}
+	return TimesOnly
+}
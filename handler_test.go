@@ -0,0 +1,63 @@
+package takeout
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandlerEditTo(t *testing.T) {
+	meta := &Takeout{
+		Description: "Sunset",
+		People:      []Person{{Name: "Alice"}},
+		GeoData:     GeoData{Latitude: 48.1, Longitude: 11.5},
+	}
+	edit := MediaEdit{
+		Meta:     meta,
+		Taken:    time.Date(2017, 7, 14, 4, 40, 0, 0, time.FixedZone("CEST", 2*3600)),
+		Dates:    true,
+		IPTC:     true,
+		Location: true,
+		Captions: true,
+	}
+	jfif := segment(0xE0, "JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00")
+	original := jpegOf(jfif)
+	path := writeMedia(t, "photo.jpg", original)
+
+	h := HandlerFor("PHOTO.JPG")
+	var copied bytes.Buffer
+	complete, err := h.EditTo(&copied, path, edit)
+	if err != nil || !complete {
+		t.Fatalf("EditTo = %v, %v", complete, err)
+	}
+	if unchanged, _ := os.ReadFile(path); !bytes.Equal(unchanged, original) {
+		t.Error("EditTo changed the file")
+	}
+	if complete, err := h.Edit(path, edit); err != nil || !complete {
+		t.Fatalf("Edit = %v, %v", complete, err)
+	}
+	if edited, _ := os.ReadFile(path); !bytes.Equal(edited, copied.Bytes()) {
+		t.Error("EditTo wrote something else than Edit")
+	}
+	fields := asciiFields(t, exifOf(t, copied.Bytes()))
+	if got, want := fields[tagDateTimeOriginal], "2017:07:14 04:40:00"; got != want {
+		t.Errorf("DateTimeOriginal = %q, want %q", got, want)
+	}
+	if got := datasets(t, resourcesOf(t, copied.Bytes())[0].data)[iptcCaption]; len(got) != 1 || got[0] != "Sunset" {
+		t.Errorf("caption = %q, want Sunset", got)
+	}
+
+	// Dates are all MP4 style files take; their location is left to a sidecar.
+	video := writeMedia(t, "clip.mp4", box("moov", box("mvhd", movieHeader(0, 0))))
+	if complete, err := HandlerFor(video).Edit(video, edit); err != nil || complete {
+		t.Errorf("editing a video = %v, %v, want it incomplete", complete, err)
+	}
+	if _, err := HandlerFor(video).EditTo(&copied, video, edit); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("EditTo of a video returned %v, want ErrUnsupported", err)
+	}
+	if h := HandlerFor("a.png"); h != TimesOnly {
+		t.Errorf("PNG handler %T, want TimesOnly", h)
+	}
+}
@@ -0,0 +1,330 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// IPTC IIM datasets of the dates and captions, as record and dataset number.
+const (
+	iptcCharacterSet  = 0x015A
+	iptcRecordVersion = 0x0200
+	iptcKeywords      = 0x0219
+	iptcDateCreated   = 0x0237
+	iptcTimeCreated   = 0x023C
+	iptcCaption       = 0x0278
+)
+
+// Longest caption and keyword, in bytes, the IIM specification allows.
+const (
+	iptcCaptionSize = 2000
+	iptcKeywordSize = 64
+)
+
+// iptcUTF8 is the character set dataset value declaring the record's text as UTF-8.
+var iptcUTF8 = []byte("\x1b%G")
+
+// Photoshop image resources holding the IPTC record in JPEG files.
+const (
+	resourceIPTC   = 0x0404
+	resourceDigest = 0x0425 // MD5 of the IPTC record, dropped since it no longer matches
+)
+
+// tagIPTC is the TIFF field holding the IPTC record of TIFF files.
+const tagIPTC = 0x83BB
+
+// typeUndefined is the TIFF field type of raw bytes.
+const typeUndefined = 7
+
+// photoshopHeader starts the payload of a JPEG's Photoshop segment.
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+// iimDataset is a single dataset of an IPTC record.
+type iimDataset struct {
+	tag   uint16 // record and dataset number
+	value []byte
+}
+
+// parseIIM splits an IPTC record into its datasets.
+func parseIIM(data []byte) ([]iimDataset, error) {
+	var datasets []iimDataset
+	for pos := 0; pos < len(data); {
+		if data[pos] != 0x1C {
+			if bytes.Count(data[pos:], []byte{0}) == len(data)-pos {
+				break // padding
+			}
+			return nil, errors.New("invalid IPTC dataset marker")
+		}
+		if pos+5 > len(data) {
+			return nil, errors.New("truncated IPTC dataset")
+		}
+		tag := binary.BigEndian.Uint16(data[pos+1:])
+		length, start := int(binary.BigEndian.Uint16(data[pos+3:])), pos+5
+		if length&0x8000 != 0 {
+			// Extended datasets give the size of their length first.
+			size := length & 0x7FFF
+			if size > 4 || start+size > len(data) {
+				return nil, errors.New("invalid extended IPTC dataset")
+			}
+			length = 0
+			for _, b := range data[start : start+size] {
+				length = length<<8 | int(b)
+			}
+			start += size
+		}
+		if start+length > len(data) {
+			return nil, errors.New("truncated IPTC dataset")
+		}
+		datasets = append(datasets, iimDataset{tag: tag, value: data[start : start+length]})
+		pos = start + length
+	}
+	return datasets, nil
+}
+
+// appendIIM appends the datasets as an IPTC record.
+func appendIIM(out []byte, datasets []iimDataset) []byte {
+	for _, d := range datasets {
+		out = append(out, 0x1C)
+		out = binary.BigEndian.AppendUint16(out, d.tag)
+		if len(d.value) < 0x8000 {
+			out = binary.BigEndian.AppendUint16(out, uint16(len(d.value)))
+		} else {
+			out = binary.BigEndian.AppendUint16(out, 0x8004)
+			out = binary.BigEndian.AppendUint32(out, uint32(len(d.value)))
+		}
+		out = append(out, d.value...)
+	}
+	return out
+}
+
+// iptcDates returns the IPTC record with DateCreated and TimeCreated set to taken, e.g.
+// "20190714" and "024000+0200", keeping every other dataset.
+func iptcDates(record []byte, taken time.Time) ([]byte, error) {
+	datasets, err := parseIIM(record)
+	if err != nil {
+		return nil, err
+	}
+	kept := datasets[:0]
+	hasVersion := false
+	for _, d := range datasets {
+		switch d.tag {
+		case iptcDateCreated, iptcTimeCreated:
+			continue
+		case iptcRecordVersion:
+			hasVersion = true
+		}
+		kept = append(kept, d)
+	}
+	if !hasVersion {
+		kept = append(kept, iimDataset{tag: iptcRecordVersion, value: []byte{0, 4}})
+	}
+	kept = append(kept,
+		iimDataset{tag: iptcDateCreated, value: []byte(taken.Format("20060102"))},
+		iimDataset{tag: iptcTimeCreated, value: []byte(taken.Format("150405-0700"))},
+	)
+	// Readers expect the datasets in record and dataset order.
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].tag < kept[j].tag })
+	return appendIIM(nil, kept), nil
+}
+
+// iptcCaptions returns the IPTC record with the caption set to description, unless it is
+// empty, and the names added to its keywords, keeping every other dataset. The record is
+// marked as UTF-8, which the names and descriptions Google exports are.
+func iptcCaptions(record []byte, description string, names []string) ([]byte, error) {
+	datasets, err := parseIIM(record)
+	if err != nil {
+		return nil, err
+	}
+	keywords := make(map[string]bool)
+	kept := datasets[:0]
+	hasVersion := false
+	for _, d := range datasets {
+		switch d.tag {
+		case iptcCharacterSet:
+			continue
+		case iptcCaption:
+			if description != "" {
+				continue
+			}
+		case iptcKeywords:
+			keywords[string(d.value)] = true
+		case iptcRecordVersion:
+			hasVersion = true
+		}
+		kept = append(kept, d)
+	}
+	kept = append(kept, iimDataset{tag: iptcCharacterSet, value: iptcUTF8})
+	if !hasVersion {
+		kept = append(kept, iimDataset{tag: iptcRecordVersion, value: []byte{0, 4}})
+	}
+	if description != "" {
+		kept = append(kept, iimDataset{tag: iptcCaption, value: []byte(truncateUTF8(description, iptcCaptionSize))})
+	}
+	for _, name := range names {
+		keyword := truncateUTF8(name, iptcKeywordSize)
+		if !keywords[keyword] {
+			keywords[keyword] = true
+			kept = append(kept, iimDataset{tag: iptcKeywords, value: []byte(keyword)})
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].tag < kept[j].tag })
+	return appendIIM(nil, kept), nil
+}
+
+// truncateUTF8 returns s cut to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// photoshopResource is a single image resource of a Photoshop segment.
+type photoshopResource struct {
+	id   uint16
+	name []byte // Pascal string with its length byte and padding
+	data []byte
+}
+
+// parseResources splits the payload of a Photoshop segment, after its header, into resources.
+func parseResources(data []byte) ([]photoshopResource, error) {
+	var resources []photoshopResource
+	for pos := 0; pos < len(data); {
+		if pos+7 > len(data) || !bytes.Equal(data[pos:pos+4], []byte("8BIM")) {
+			return nil, errors.New("invalid Photoshop resource")
+		}
+		id := binary.BigEndian.Uint16(data[pos+4:])
+		nameEnd := pos + 6 + 1 + int(data[pos+6])
+		nameEnd += (nameEnd - pos - 6) % 2
+		if nameEnd+4 > len(data) {
+			return nil, errors.New("truncated Photoshop resource")
+		}
+		size := int(binary.BigEndian.Uint32(data[nameEnd:]))
+		start := nameEnd + 4
+		if start+size > len(data) {
+			return nil, errors.New("truncated Photoshop resource")
+		}
+		resources = append(resources, photoshopResource{id: id, name: data[pos+6 : nameEnd], data: data[start : start+size]})
+		pos = start + size + size%2
+	}
+	return resources, nil
+}
+
+// appendResources appends the resources to a Photoshop segment payload.
+func appendResources(out []byte, resources []photoshopResource) []byte {
+	for _, r := range resources {
+		out = append(out, "8BIM"...)
+		out = binary.BigEndian.AppendUint16(out, r.id)
+		out = append(out, r.name...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(r.data)))
+		out = append(out, r.data...)
+		if len(r.data)%2 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// editJPEGIPTC rewrites the IPTC record in the Photoshop segment of a JPEG with edit, adding
+// the segment after the JFIF and EXIF segments if the file has none. Everything else in the
+// file is kept byte for byte.
+func editJPEGIPTC(data []byte, edit func(record []byte) ([]byte, error)) ([]byte, error) {
+	if !isJPEG(data) {
+		return nil, ErrBrokenMedia
+	}
+
+	insert, start, end := 2, -1, -1
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		next := pos + 2 + length
+		if length < 2 || next > len(data) {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		if (marker == 0xE0 || marker == 0xE1) && insert == pos {
+			insert = next
+		}
+		if marker == 0xED && bytes.HasPrefix(data[pos+4:next], photoshopHeader) {
+			start, end = pos, next
+			break
+		}
+		pos = next
+	}
+
+	var resources []photoshopResource
+	if start >= 0 {
+		var err error
+		if resources, err = parseResources(data[start+4+len(photoshopHeader) : end]); err != nil {
+			return nil, err
+		}
+	} else {
+		start, end = insert, insert
+	}
+
+	var record []byte
+	kept := resources[:0]
+	for _, r := range resources {
+		switch r.id {
+		case resourceIPTC:
+			record = r.data
+		case resourceDigest:
+		default:
+			kept = append(kept, r)
+		}
+	}
+	record, err := edit(record)
+	if err != nil {
+		return nil, err
+	}
+	kept = append(kept, photoshopResource{id: resourceIPTC, name: []byte{0, 0}, data: record})
+
+	payload := appendResources(append([]byte(nil), photoshopHeader...), kept)
+	if 2+len(payload) > 0xFFFF {
+		return nil, errors.New("IPTC record too large for a JPEG segment")
+	}
+	out := make([]byte, 0, len(data)-(end-start)+4+len(payload))
+	out = append(out, data[:start]...)
+	out = append(out, 0xFF, 0xED)
+	out = binary.BigEndian.AppendUint16(out, uint16(2+len(payload)))
+	out = append(out, payload...)
+	return append(out, data[end:]...), nil
+}
+
+// setIPTC rewrites the IPTC record of a TIFF file, kept in its first directory, with edit.
+func (t *tiffBlock) setIPTC(edit func(record []byte) ([]byte, error)) error {
+	root, err := t.readIFD(t.order.Uint32(t.data[4:8]))
+	if err != nil {
+		return err
+	}
+	var record []byte
+	if e := root.entry(tagIPTC); e != nil {
+		size := uint64(e.count)
+		if e.typ == typeLong {
+			size *= 4
+		}
+		if size <= 4 {
+			record = e.value[:size]
+		} else if offset := uint64(t.order.Uint32(e.value[:])); offset+size <= uint64(len(t.data)) {
+			record = t.data[offset : offset+size]
+		} else {
+			return fmt.Errorf("IPTC field outside the TIFF block")
+		}
+	}
+	if record, err = edit(bytes.Clone(record)); err != nil {
+		return err
+	}
+	t.set(root, tagIPTC, typeUndefined, uint32(len(record)), record)
+	t.storeRoot(root)
+	return nil
+}
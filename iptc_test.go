@@ -0,0 +1,233 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// datasets returns the values of an IPTC record by tag, in record order.
+func datasets(t *testing.T, record []byte) map[uint16][]string {
+	t.Helper()
+	parsed, err := parseIIM(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[uint16][]string)
+	for i, d := range parsed {
+		if i > 0 && parsed[i-1].tag > d.tag {
+			t.Errorf("dataset %#04x follows %#04x", d.tag, parsed[i-1].tag)
+		}
+		values[d.tag] = append(values[d.tag], string(d.value))
+	}
+	return values
+}
+
+// iptcObjectName is the title dataset, which edits must keep.
+const iptcObjectName = 0x0205
+
+func TestIPTCMerge(t *testing.T) {
+	taken := time.Date(2019, 7, 14, 2, 40, 0, 0, time.FixedZone("CEST", 2*3600))
+	record := appendIIM(nil, []iimDataset{
+		{tag: iptcRecordVersion, value: []byte{0, 2}},
+		{tag: iptcObjectName, value: []byte("Beach")},
+		{tag: iptcKeywords, value: []byte("Alice")},
+		{tag: iptcDateCreated, value: []byte("20200101")},
+		{tag: iptcCaption, value: []byte("old caption")},
+	})
+
+	record, err := iptcDates(record, taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err = iptcCaptions(record, "Sunset at the pier", []string{"Alice", "Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := datasets(t, record)
+	for tag, want := range map[uint16][]string{
+		iptcCharacterSet:  {string(iptcUTF8)},
+		iptcRecordVersion: {"\x00\x02"},
+		iptcObjectName:    {"Beach"},
+		iptcKeywords:      {"Alice", "Bob"},
+		iptcDateCreated:   {"20190714"},
+		iptcTimeCreated:   {"024000+0200"},
+		iptcCaption:       {"Sunset at the pier"},
+	} {
+		if !slices.Equal(got[tag], want) {
+			t.Errorf("dataset %#04x = %q, want %q", tag, got[tag], want)
+		}
+	}
+
+	// Captions without a description keep the one there is.
+	record, err = iptcCaptions(record, "", []string{"Carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = datasets(t, record)
+	if want := []string{"Sunset at the pier"}; !slices.Equal(got[iptcCaption], want) {
+		t.Errorf("caption = %q, want %q", got[iptcCaption], want)
+	}
+	if want := []string{"Alice", "Bob", "Carol"}; !slices.Equal(got[iptcKeywords], want) {
+		t.Errorf("keywords = %q, want %q", got[iptcKeywords], want)
+	}
+}
+
+func TestIPTCEmptyRecord(t *testing.T) {
+	record, err := iptcDates(nil, time.Date(2019, 7, 14, 2, 40, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := datasets(t, record)
+	if want := []string{"\x00\x04"}; !slices.Equal(got[iptcRecordVersion], want) {
+		t.Errorf("record version = %q, want %q", got[iptcRecordVersion], want)
+	}
+	if want := []string{"024000+0000"}; !slices.Equal(got[iptcTimeCreated], want) {
+		t.Errorf("time created = %q, want %q", got[iptcTimeCreated], want)
+	}
+}
+
+func TestIPTCTruncatesUTF8(t *testing.T) {
+	name := strings.Repeat("é", 40) // 80 bytes
+	record, err := iptcCaptions(nil, strings.Repeat("ü", 1500), []string{name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := datasets(t, record)
+	if keyword := got[iptcKeywords][0]; keyword != strings.Repeat("é", 32) {
+		t.Errorf("keyword cut to %d bytes %q, want 32 whole characters", len(keyword), keyword)
+	}
+	if caption := got[iptcCaption][0]; caption != strings.Repeat("ü", 1000) {
+		t.Errorf("caption cut to %d bytes, want 1000 whole characters", len(caption))
+	}
+}
+
+func TestIPTCLongDataset(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 0x9000)
+	parsed, err := parseIIM(appendIIM(nil, []iimDataset{{tag: iptcCaption, value: long}, {tag: iptcObjectName, value: []byte("t")}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || !bytes.Equal(parsed[0].value, long) || string(parsed[1].value) != "t" {
+		t.Errorf("extended dataset read back as %d datasets", len(parsed))
+	}
+}
+
+// photoshopOf returns the payload of a JPEG's Photoshop segment holding the resources.
+func photoshopOf(resources ...photoshopResource) string {
+	return string(appendResources(bytes.Clone(photoshopHeader), resources))
+}
+
+// resourcesOf returns the resources of the Photoshop segment of a JPEG.
+func resourcesOf(t *testing.T, jpeg []byte) []photoshopResource {
+	t.Helper()
+	for _, s := range segmentsOf(t, jpeg) {
+		if s[1] == 0xED && strings.HasPrefix(s[4:], string(photoshopHeader)) {
+			resources, err := parseResources([]byte(s[4+len(photoshopHeader):]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resources
+		}
+	}
+	t.Fatal("no Photoshop segment")
+	return nil
+}
+
+func TestEditJPEGIPTC(t *testing.T) {
+	taken := time.Date(2019, 7, 14, 2, 40, 0, 0, time.UTC)
+	jfif := segment(0xE0, "JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00")
+	exif := segment(0xE1, string(exifHeader)+string(emptyTIFF().data))
+	resolution := photoshopResource{id: 0x03ED, name: []byte{0, 0}, data: []byte("resolution info!")}
+	photoshop := segment(0xED, photoshopOf(
+		resolution,
+		photoshopResource{id: resourceDigest, name: []byte{0, 0}, data: []byte("0123456789abcdef")},
+		photoshopResource{id: resourceIPTC, name: []byte{0, 0}, data: appendIIM(nil, []iimDataset{{tag: iptcObjectName, value: []byte("Beach")}})},
+	))
+
+	for _, test := range []struct {
+		name     string
+		segments []string
+		markers  []byte
+		kept     []photoshopResource
+	}{
+		{name: "without segments", markers: []byte{0xED}},
+		{name: "after JFIF and EXIF", segments: []string{jfif, exif}, markers: []byte{0xE0, 0xE1, 0xED}},
+		{name: "existing record", segments: []string{jfif, photoshop}, markers: []byte{0xE0, 0xED}, kept: []photoshopResource{resolution}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := editJPEGIPTC(jpegOf(test.segments...), func(record []byte) ([]byte, error) {
+				return iptcDates(record, taken)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(out, []byte(scan)) {
+				t.Error("image data changed")
+			}
+			var markers []byte
+			for _, s := range segmentsOf(t, out) {
+				markers = append(markers, s[1])
+			}
+			if !bytes.Equal(markers, test.markers) {
+				t.Errorf("segment markers % X, want % X", markers, test.markers)
+			}
+
+			resources := resourcesOf(t, out)
+			iptc := resources[len(resources)-1]
+			if iptc.id != resourceIPTC {
+				t.Fatalf("last resource %#04x, want the IPTC record", iptc.id)
+			}
+			for i, r := range resources[:len(resources)-1] {
+				if i >= len(test.kept) || r.id != test.kept[i].id || !bytes.Equal(r.data, test.kept[i].data) {
+					t.Errorf("resource %#04x kept, want %d resources before the record", r.id, len(test.kept))
+				}
+			}
+			got := datasets(t, iptc.data)
+			if want := []string{"20190714"}; !slices.Equal(got[iptcDateCreated], want) {
+				t.Errorf("date created = %q, want %q", got[iptcDateCreated], want)
+			}
+			if len(test.kept) > 0 && !slices.Equal(got[iptcObjectName], []string{"Beach"}) {
+				t.Errorf("object name = %q, want the original", got[iptcObjectName])
+			}
+		})
+	}
+}
+
+func TestTIFFIPTC(t *testing.T) {
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	block, err := parseTIFF(tiffOf(t, "II", old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, description := range []string{"first", "a longer second caption"} {
+		err := block.setIPTC(func(record []byte) ([]byte, error) {
+			return iptcCaptions(record, description, []string{"Alice"})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := block.readIFD(binary.LittleEndian.Uint32(block.data[4:8]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := root.entry(tagIPTC)
+	if e == nil {
+		t.Fatal("no IPTC field")
+	}
+	offset := binary.LittleEndian.Uint32(e.value[:])
+	got := datasets(t, block.data[offset:offset+e.count])
+	if want := []string{"a longer second caption"}; !slices.Equal(got[iptcCaption], want) {
+		t.Errorf("caption = %q, want %q", got[iptcCaption], want)
+	}
+	if want := []string{"Alice"}; !slices.Equal(got[iptcKeywords], want) {
+		t.Errorf("keywords = %q, want %q", got[iptcKeywords], want)
+	}
+	checkTaken(t, block, old)
+}
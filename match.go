@@ -0,0 +1,120 @@
+package takeout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Matcher pairs media files with their sidecars: a sidecar belongs to the media file its
+// title names, in the same folder.
+type Matcher struct {
+	// Resolve finds the media of a sidecar, Resolve in the sidecar's folder if nil.
+	Resolve func(sidecar string, meta *Takeout) (media, how string)
+	// Strict rejects sidecars with unknown fields, as Read does.
+	Strict bool
+}
+
+// resolve finds the media of a sidecar with m.Resolve.
+func (m Matcher) resolve(sidecar string, meta *Takeout) (media, how string) {
+	if m.Resolve != nil {
+		return m.Resolve(sidecar, meta)
+	}
+	return Resolve(filepath.Dir(sidecar), filepath.Base(sidecar), meta)
+}
+
+// Match is a single sidecar and media pairing and why it was made. Paired is false for
+// sidecars that were only considered because of their name.
+type Match struct {
+	Sidecar string
+	Media   string
+	Reason  string
+	Paired  bool
+	Exists  bool
+}
+
+// Match explains the pairings of path. For a sidecar it returns the media its title names;
+// for a media file it returns every sidecar in its folder naming it, or, if none do, the
+// sidecars whose name suggests they should have.
+func (m Matcher) Match(path string) ([]Match, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		return m.matchSidecar(path)
+	}
+	return m.matchMedia(path)
+}
+
+func (m Matcher) matchSidecar(sidecar string) ([]Match, error) {
+	meta, err := Read(sidecar, m.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sidecar, err)
+	}
+	media, how := m.resolve(sidecar, meta)
+	reason := fmt.Sprintf("title %q names it", meta.Title)
+	if how != "" {
+		reason += ", " + how
+	}
+	if hint := meta.PathHint(); hint != "" {
+		reason += fmt.Sprintf(", ignoring the directories %q", hint)
+	}
+	_, statErr := os.Stat(media)
+	return []Match{{Sidecar: sidecar, Media: media, Reason: reason, Paired: true, Exists: statErr == nil}}, nil
+}
+
+func (m Matcher) matchMedia(media string) ([]Match, error) {
+	if _, err := os.Stat(media); err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(media)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Google truncates long sidecar names, so only compare a prefix of the media name.
+	base := filepath.Base(media)
+	prefix := strings.ToLower(base[:min(len(base), 40)])
+
+	var paired, similar []Match
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(name), ".json") || name == "metadata.json" {
+			continue
+		}
+		sidecar := filepath.Join(dir, name)
+		meta, err := Read(sidecar, m.Strict)
+		if err != nil {
+			continue
+		}
+		named, how := m.resolve(sidecar, meta)
+		switch {
+		case SameFile(named, media):
+			reason := fmt.Sprintf("title %q names it", meta.Title)
+			if how != "" {
+				reason += ", " + how
+			}
+			paired = append(paired, Match{Sidecar: sidecar, Media: media, Reason: reason, Paired: true, Exists: true})
+		case strings.HasPrefix(strings.ToLower(name), prefix):
+			similar = append(similar, Match{Sidecar: sidecar, Media: named, Reason: fmt.Sprintf("similar name, but title %q names %s", meta.Title, filepath.Base(named))})
+		}
+	}
+	if len(paired) > 0 {
+		return paired, nil
+	}
+	sort.Slice(similar, func(i, j int) bool { return similar[i].Sidecar < similar[j].Sidecar })
+	return similar, nil
+}
+
+// SameFile reports whether a and b name the same file: the same file on disk if both
+// exist, the same path once made absolute otherwise.
+func SameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
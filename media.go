@@ -0,0 +1,116 @@
+package takeout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrEmptyMedia means the media file has no content, typically a failed or aborted download.
+	ErrEmptyMedia = errors.New("media file is empty")
+	// ErrBrokenMedia means the media file doesn't start with the header its extension implies,
+	// typically a partial download or an HTML error page saved under the media name.
+	ErrBrokenMedia = errors.New("media file header does not match its extension")
+)
+
+// mediaSignatures maps lowercase extensions to a check of the file's leading bytes.
+var mediaSignatures = map[string]func(header []byte) bool{
+	".jpg":  isJPEG,
+	".jpeg": isJPEG,
+	".jpe":  isJPEG,
+	".jfif": isJPEG,
+	".png":  hasPrefix("\x89PNG\r\n\x1a\n"),
+	".gif":  func(h []byte) bool { return hasPrefix("GIF87a")(h) || hasPrefix("GIF89a")(h) },
+	".bmp":  hasPrefix("BM"),
+	".tif":  isTIFF,
+	".tiff": isTIFF,
+	".dng":  isTIFF,
+	".nef":  isTIFF,
+	".arw":  isTIFF,
+	".cr2":  isTIFF,
+	".webp": isRIFF("WEBP"),
+	".avi":  isRIFF("AVI "),
+	".mp4":  isISOBMFF,
+	".m4v":  isISOBMFF,
+	".mp":   isISOBMFF,
+	".mov":  isISOBMFF,
+	".3gp":  isISOBMFF,
+	".3g2":  isISOBMFF,
+	".heic": isISOBMFF,
+	".heif": isISOBMFF,
+	".avif": isISOBMFF,
+	".cr3":  isISOBMFF,
+	".mkv":  hasPrefix("\x1a\x45\xdf\xa3"),
+	".webm": hasPrefix("\x1a\x45\xdf\xa3"),
+	".wmv":  hasPrefix("\x30\x26\xb2\x75\x8e\x66\xcf\x11"),
+	".asf":  hasPrefix("\x30\x26\xb2\x75\x8e\x66\xcf\x11"),
+}
+
+// CheckMedia classifies obviously broken media so that dates aren't stamped onto it.
+// Files with an unknown extension are only checked for being empty.
+func CheckMedia(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return ErrEmptyMedia
+	}
+
+	matches, ok := mediaSignatures[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil
+	}
+
+	header := make([]byte, 16)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if !matches(header[:n]) {
+		return ErrBrokenMedia
+	}
+	return nil
+}
+
+func hasPrefix(prefix string) func(header []byte) bool {
+	return func(header []byte) bool { return bytes.HasPrefix(header, []byte(prefix)) }
+}
+
+func isJPEG(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF})
+}
+
+func isTIFF(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*"))
+}
+
+func isRIFF(format string) func(header []byte) bool {
+	return func(header []byte) bool {
+		return len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == format
+	}
+}
+
+// isISOBMFF checks for an MP4/QuickTime style box at the start of the file.
+// QuickTime files don't always start with ftyp, so the other common leading boxes are accepted too.
+func isISOBMFF(header []byte) bool {
+	if len(header) < 8 {
+		return false
+	}
+	switch string(header[4:8]) {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip", "pnot":
+		return true
+	}
+	return false
+}
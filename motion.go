@@ -0,0 +1,50 @@
+package takeout
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+)
+
+// ErrNoMotion means a JPEG has no embedded Motion Photo video.
+var ErrNoMotion = errors.New("no embedded video")
+
+// microVideoOffset matches the XMP field giving the embedded video's distance from the end of the file.
+var microVideoOffset = regexp.MustCompile(`MicroVideoOffset="(\d+)"`)
+
+// mp4Brands are the ISO base media brands embedded Motion Photo videos start with.
+var mp4Brands = [][]byte{[]byte("ftypmp4"), []byte("ftypisom"), []byte("ftypavc1"), []byte("ftypqt")}
+
+// MotionVideo returns the MP4 embedded in a Motion Photo JPEG, or ErrNoMotion. The position is taken from the
+// XMP MicroVideoOffset when present, otherwise from the first MP4 header after the image.
+func MotionVideo(data []byte) ([]byte, error) {
+	if !isJPEG(data) {
+		return nil, ErrNoMotion
+	}
+	head := data[:min(len(data), 64<<10)]
+	if !bytes.Contains(head, []byte("MicroVideo")) && !bytes.Contains(head, []byte("MotionPhoto")) {
+		return nil, ErrNoMotion
+	}
+
+	if m := microVideoOffset.FindSubmatch(head); m != nil {
+		offset, err := strconv.Atoi(string(m[1]))
+		if err == nil && offset > 8 && offset < len(data) {
+			video := data[len(data)-offset:]
+			if bytes.Equal(video[4:8], []byte("ftyp")) {
+				return video, nil
+			}
+		}
+	}
+
+	start := -1
+	for _, brand := range mp4Brands {
+		if i := bytes.Index(data, brand); i >= 4 && (start < 0 || i-4 < start) {
+			start = i - 4
+		}
+	}
+	if start < 0 {
+		return nil, ErrNoMotion
+	}
+	return data[start:], nil
+}
@@ -0,0 +1,234 @@
+package takeout
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MediaSize is the size of a photo or video in pixels and, for videos, how long it plays.
+// Sizes are those the frames are stored at, before any rotation the media asks for.
+type MediaSize struct {
+	Width, Height int
+	Duration      time.Duration
+}
+
+// maxBoxRead is the most of a single MP4 box read into memory while probing. Movie
+// headers are a few megabytes even for long videos; bigger boxes are media data.
+const maxBoxRead = 64 << 20
+
+// Probe reads the size of the media at path from its headers, without decoding it.
+// JPEG, PNG, GIF, WebP and the MP4 family, which includes MOV and HEIC, are read; other
+// formats return a zero size.
+func Probe(path string) (MediaSize, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return MediaSize{}, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".jpe", ".jfif", ".png", ".gif":
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			return MediaSize{}, err
+		}
+		return MediaSize{Width: config.Width, Height: config.Height}, nil
+	case ".webp":
+		return probeWebP(file)
+	case ".mp4", ".mp", ".m4v", ".mov", ".3gp", ".3g2", ".heic", ".heif", ".avif":
+		info, err := file.Stat()
+		if err != nil {
+			return MediaSize{}, err
+		}
+		return probeISOBMFF(file, info.Size())
+	}
+	return MediaSize{}, nil
+}
+
+// probeWebP reads the canvas size from the first chunk of a WebP file.
+func probeWebP(r io.Reader) (MediaSize, error) {
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return MediaSize{}, err
+	}
+	if !isRIFF("WEBP")(header) {
+		return MediaSize{}, ErrBrokenMedia
+	}
+	le24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+	switch string(header[12:16]) {
+	case "VP8X":
+		return MediaSize{Width: le24(header[24:27]) + 1, Height: le24(header[27:30]) + 1}, nil
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		return MediaSize{Width: int(bits&0x3FFF) + 1, Height: int(bits>>14&0x3FFF) + 1}, nil
+	case "VP8 ":
+		return MediaSize{Width: int(binary.LittleEndian.Uint16(header[26:28]) & 0x3FFF), Height: int(binary.LittleEndian.Uint16(header[28:30]) & 0x3FFF)}, nil
+	}
+	return MediaSize{}, errors.New("unknown WebP chunk " + string(header[12:16]))
+}
+
+// probeISOBMFF reads the size of an MP4 style file: the duration from the movie header and
+// the largest track size of a video, or the largest image size of a HEIC photo.
+func probeISOBMFF(r io.ReaderAt, size int64) (MediaSize, error) {
+	var m MediaSize
+	err := eachBox(r, size, func(kind string, payload *io.SectionReader) error {
+		switch kind {
+		case "moov":
+			data, err := readBox(payload)
+			if err != nil {
+				return err
+			}
+			probeMovie(data, &m)
+		case "meta":
+			data, err := readBox(payload)
+			if err != nil {
+				return err
+			}
+			if len(data) > 4 {
+				probeImageProperties(data[4:], &m)
+			}
+		}
+		return nil
+	})
+	return m, err
+}
+
+// eachBox calls fn for every top-level box of r, which is end bytes long.
+func eachBox(r io.ReaderAt, end int64, fn func(kind string, payload *io.SectionReader) error) error {
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		kind := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0: // the box runs to the end
+			size = end - offset
+		case 1: // a 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return nil // trailing bytes that aren't a whole box, often padding
+		}
+		if err := fn(kind, io.NewSectionReader(r, offset+headerSize, size-headerSize)); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+// readBox reads the payload of a box, refusing the huge ones.
+func readBox(payload *io.SectionReader) ([]byte, error) {
+	if payload.Size() > maxBoxRead {
+		return nil, errors.New("box too large to probe")
+	}
+	data := make([]byte, payload.Size())
+	_, err := io.ReadFull(payload, data)
+	return data, err
+}
+
+// boxesIn calls fn for every box in data, the payload of a box holding other boxes. A
+// truncated box ends the list.
+func boxesIn(data []byte, fn func(kind string, payload []byte)) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		kind := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		fn(kind, data[header:size])
+		data = data[size:]
+	}
+}
+
+// probeMovie reads the duration from the mvhd box of a moov payload and the largest
+// width and height of its tracks' tkhd boxes.
+func probeMovie(moov []byte, m *MediaSize) {
+	boxesIn(moov, func(kind string, payload []byte) {
+		switch kind {
+		case "mvhd":
+			if timescale, duration, ok := movieDuration(payload); ok && timescale > 0 {
+				m.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+			}
+		case "trak":
+			boxesIn(payload, func(kind string, tkhd []byte) {
+				if kind != "tkhd" || len(tkhd) < 8 {
+					return
+				}
+				// Width and height close the box, as 16.16 fixed-point numbers.
+				width := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+				height := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+				if width*height > m.Width*m.Height {
+					m.Width, m.Height = width, height
+				}
+			})
+		}
+	})
+}
+
+// movieDuration returns the timescale and duration of an mvhd payload.
+func movieDuration(mvhd []byte) (timescale uint32, duration uint64, ok bool) {
+	if len(mvhd) < 1 {
+		return 0, 0, false
+	}
+	if mvhd[0] == 1 {
+		// Version 1 has 64-bit creation and modification times and duration.
+		if len(mvhd) < 32 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(mvhd[20:24]), binary.BigEndian.Uint64(mvhd[24:32]), true
+	}
+	if len(mvhd) < 20 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(mvhd[12:16]), uint64(binary.BigEndian.Uint32(mvhd[16:20])), true
+}
+
+// probeImageProperties reads the largest ispe image size in the iprp box of a HEIC meta
+// payload. The grid of tiles a photo is stored as is the largest.
+func probeImageProperties(meta []byte, m *MediaSize) {
+	boxesIn(meta, func(kind string, iprp []byte) {
+		if kind != "iprp" {
+			return
+		}
+		boxesIn(iprp, func(kind string, ipco []byte) {
+			if kind != "ipco" {
+				return
+			}
+			boxesIn(ipco, func(kind string, ispe []byte) {
+				if kind != "ispe" || len(ispe) < 12 {
+					return
+				}
+				width := int(binary.BigEndian.Uint32(ispe[4:8]))
+				height := int(binary.BigEndian.Uint32(ispe[8:12]))
+				if width*height > m.Width*m.Height {
+					m.Width, m.Height = width, height
+				}
+			})
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package takeout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Read reads and parses the sidecar at path. In strict mode, sidecars with fields
+// UnknownFields reports are rejected.
+func Read(path string, strict bool) (*Takeout, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+	return Parse(data, strict)
+}
+
+// Parse parses the contents of a sidecar, in strict mode like Read.
+func Parse(data []byte, strict bool) (*Takeout, error) {
+	var meta Takeout
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	if strict {
+		unknown, err := UnknownFields(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse: %w", err)
+		}
+		if len(unknown) > 0 {
+			return nil, fmt.Errorf("unexpected fields %s", strings.Join(unknown, ", "))
+		}
+	}
+	return &meta, nil
+}
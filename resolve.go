@@ -0,0 +1,351 @@
+package takeout
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// mediaNameLimit is the length, extension included, that Google truncates the file names of
+// exported media to. The title in the sidecar keeps the full name.
+const mediaNameLimit = 47
+
+// minPrefix is the shortest stem a media file may have to be matched to a longer title by
+// prefix alone, so that short names like "IMG_1.jpg" are never paired by accident.
+const minPrefix = 30
+
+// duplicateSidecar matches the sidecar name Google gives the metadata of a numbered
+// duplicate: "IMG_1234.jpg(1).json" describes "IMG_1234(1).jpg".
+var duplicateSidecar = regexp.MustCompile(`(\(\d+\))\.json$`)
+
+// supplementalSuffix is what newer exports add to sidecar names before ".json", often cut
+// short by the name limit: "IMG_1234.jpg.supplemental-metadata.json", but also
+// "IMG_1234.jpg.supplemental-metad.json" or "IMG_1234.jpg.suppl.json".
+const supplementalSuffix = ".supplemental-metadata"
+
+// Ways a sidecar's title was matched to a media file with a different name, as reported by Resolve.
+const (
+	resolvedTruncated  = "truncated to 47 characters"
+	resolvedNormalized = "matched ignoring case, Unicode normalization and characters invalid in file names"
+	resolvedPrefix     = "matched by prefix, the only media in the folder starting like the title"
+	resolvedSidecar    = "named by the sidecar's file name"
+)
+
+// FS is the file system media is looked for in: the local one, or a remote one such as an
+// sftp.Client.
+type FS interface {
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// Local is the local file system.
+var Local FS = localFS{}
+
+type localFS struct{}
+
+func (localFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (localFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// Resolve finds the media in mediaDir that the sidecar named sidecarName describes. The title
+// names the media, allowing for the truncation and renaming the file may have gone through;
+// numbered duplicates take their number from the sidecar's name. It returns how the file was
+// found, empty if the title names it exactly. Sidecars without a title, or whose title names
+// nothing in mediaDir, fall back to the media their own file name points at. If nothing is
+// found, the path the title names is returned.
+func Resolve(mediaDir, sidecarName string, meta *Takeout) (path, how string) {
+	return ResolveIn(Local, mediaDir, sidecarName, meta)
+}
+
+// ResolveIn is Resolve for media on fsys.
+func ResolveIn(fsys FS, mediaDir, sidecarName string, meta *Takeout) (path, how string) {
+	if meta.Title != "" {
+		path, how = resolveTitle(fsys, mediaDir, sidecarName, meta)
+		if _, err := fsys.Lstat(path); err == nil {
+			return path, how
+		}
+	}
+	if named, ok := SidecarMedia(sidecarName); ok {
+		found, foundHow := findMedia(fsys, mediaDir, named)
+		if _, err := fsys.Lstat(found); err == nil {
+			if foundHow != "" {
+				return found, resolvedSidecar + ", " + foundHow
+			}
+			return found, resolvedSidecar
+		}
+		if path == "" {
+			path = found
+		}
+	}
+	return path, how
+}
+
+// resolveTitle finds the media the title of the sidecar names.
+func resolveTitle(fsys FS, mediaDir, sidecarName string, meta *Takeout) (path, how string) {
+	name := meta.Name()
+	// The title of a numbered duplicate is the original's; only the sidecar's name has the number.
+	if m := duplicateSidecar.FindStringSubmatch(sidecarName); m != nil {
+		ext := filepath.Ext(name)
+		numbered := strings.TrimSuffix(name, ext) + m[1] + ext
+		path, how = findMedia(fsys, mediaDir, numbered)
+		if how == "" {
+			return path, "numbered duplicate " + m[1] + " from the sidecar's name"
+		}
+		return path, "numbered duplicate " + m[1] + " from the sidecar's name, " + how
+	}
+	return findMedia(fsys, mediaDir, name)
+}
+
+// findMedia finds the media named name in dir on fsys. If no file has exactly that name, it tries
+// the name as Google truncates it, then the names in dir compared loosely, then a unique
+// prefix of the title. It returns how the file was found, empty for an exact match or if
+// nothing was found, in which case the exact path is returned.
+func findMedia(fsys FS, dir, name string) (path, how string) {
+	exact := filepath.Join(dir, name)
+	if _, err := fsys.Lstat(exact); err == nil {
+		return exact, ""
+	}
+	truncated := truncateName(name, mediaNameLimit)
+	if truncated != name {
+		if _, err := fsys.Lstat(filepath.Join(dir, truncated)); err == nil {
+			return filepath.Join(dir, truncated), resolvedTruncated
+		}
+	}
+
+	for _, want := range []string{name, truncated} {
+		if named := mediaNamed(fsys, dir, LooseName(want)); len(named) > 0 {
+			return filepath.Join(dir, named[0]), resolvedNormalized
+		}
+	}
+
+	ext := LooseName(filepath.Ext(name))
+	stem := strings.TrimSuffix(LooseName(name), ext)
+	var match string
+	for _, candidate := range MediaNamesIn(fsys, dir) {
+		if !strings.HasSuffix(candidate.Key, ext) {
+			continue
+		}
+		candidateStem := strings.TrimSuffix(candidate.Key, ext)
+		if utf8.RuneCountInString(candidateStem) < minPrefix || !strings.HasPrefix(stem, candidateStem) {
+			continue
+		}
+		if match != "" {
+			return exact, "" // ambiguous, better reported missing than paired wrongly
+		}
+		match = candidate.Name
+	}
+	if match != "" {
+		return filepath.Join(dir, match), resolvedPrefix
+	}
+	return exact, ""
+}
+
+// SidecarMedia returns the name of the media file a sidecar's file name points at: both
+// "IMG_1234.jpg(1).json" and "IMG_1234.jpg.supplemental-metadata(1).json" point at
+// "IMG_1234(1).jpg". Long names may be cut short, as the sidecar's name was. It returns
+// false if sidecarName doesn't end in ".json".
+func SidecarMedia(sidecarName string) (string, bool) {
+	if !strings.HasSuffix(strings.ToLower(sidecarName), ".json") {
+		return "", false
+	}
+	name := sidecarName[:len(sidecarName)-len(".json")]
+	var number string
+	if m := duplicateNumber.FindString(name); m != "" {
+		number, name = m, strings.TrimSuffix(name, m)
+	}
+	// What's left of the supplemental suffix follows the media's own extension.
+	if i := strings.LastIndex(name, "."); i > 0 && strings.Contains(name[:i], ".") {
+		if suffix := strings.ToLower(name[i:]); len(suffix) > 1 && strings.HasPrefix(supplementalSuffix, suffix) {
+			name = name[:i]
+		}
+	}
+	if number != "" {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) + number + ext
+	}
+	return name, true
+}
+
+// duplicateNumber matches the number of a numbered duplicate at the end of a sidecar name
+// without its ".json".
+var duplicateNumber = regexp.MustCompile(`\(\d+\)$`)
+
+// truncateName shortens the stem of name so that the whole name is at most limit characters,
+// keeping the extension, the way Google names long media files in an export.
+func truncateName(name string, limit int) string {
+	if utf8.RuneCountInString(name) <= limit {
+		return name
+	}
+	ext := filepath.Ext(name)
+	stem := []rune(strings.TrimSuffix(name, ext))
+	keep := limit - utf8.RuneCountInString(ext)
+	if keep <= 0 || keep >= len(stem) {
+		return name
+	}
+	return string(stem[:keep]) + ext
+}
+
+// LooseName folds a file name for comparisons that survive unzip tools and filesystems:
+// case-insensitive, NFC-normalized, and with the characters Windows doesn't allow in file
+// names replaced by underscores as extractors do.
+func LooseName(name string) string {
+	name = norm.NFC.String(name)
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"|?*`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.ToLower(name)
+}
+
+// MediaName is a media file name and its LooseName.
+type MediaName struct {
+	Name, Key string
+}
+
+// mediaListings caches the media files of each folder looked at by MediaNamesIn.
+var mediaListings sync.Map // listingKey → *mediaListing
+
+// listingKey is a folder on a file system.
+type listingKey struct {
+	fsys FS
+	dir  string
+}
+
+// keyOf returns the listingKey of dir on fsys. Local folders are keyed by their absolute
+// path, so that relative and absolute paths share a listing.
+func keyOf(fsys FS, dir string) listingKey {
+	dir = filepath.Clean(dir)
+	if fsys == Local {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+	}
+	return listingKey{fsys, dir}
+}
+
+// mediaListing is the media files of a folder, indexed by their LooseName.
+type mediaListing struct {
+	mu    sync.Mutex
+	names []MediaName         // nil after a removal, until MediaNamesIn lists byKey again
+	byKey map[string][]string // names by LooseName, in the order they were listed
+}
+
+// listingOf returns the listing of dir on fsys, reading the folder the first time.
+func listingOf(fsys FS, dir string) *mediaListing {
+	key := keyOf(fsys, dir)
+	if listing, ok := mediaListings.Load(key); ok {
+		return listing.(*mediaListing)
+	}
+	entries, _ := fsys.ReadDir(dir)
+	listing := &mediaListing{names: make([]MediaName, 0, len(entries)), byKey: make(map[string][]string, len(entries))}
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasSuffix(strings.ToLower(entry.Name()), ".json") {
+			name := MediaName{Name: entry.Name(), Key: LooseName(entry.Name())}
+			listing.names = append(listing.names, name)
+			listing.byKey[name.Key] = append(listing.byKey[name.Key], name.Name)
+		}
+	}
+	stored, _ := mediaListings.LoadOrStore(key, listing)
+	return stored.(*mediaListing)
+}
+
+// MediaNames returns the files in dir that aren't sidecars. The listing of each folder is
+// read once and kept, as exports don't change while they are read other than by the
+// caller's own writes, which AddMediaName and RemoveMediaName record.
+func MediaNames(dir string) []MediaName {
+	return MediaNamesIn(Local, dir)
+}
+
+// MediaNamesIn is MediaNames for a folder on fsys.
+func MediaNamesIn(fsys FS, dir string) []MediaName {
+	listing := listingOf(fsys, dir)
+	listing.mu.Lock()
+	defer listing.mu.Unlock()
+	if listing.names == nil {
+		listing.names = make([]MediaName, 0, len(listing.byKey))
+		for key, names := range listing.byKey {
+			for _, name := range names {
+				listing.names = append(listing.names, MediaName{Name: name, Key: key})
+			}
+		}
+		sort.Slice(listing.names, func(i, j int) bool { return listing.names[i].Name < listing.names[j].Name })
+	}
+	return listing.names
+}
+
+// mediaNamed returns the media files in dir on fsys whose LooseName is key.
+func mediaNamed(fsys FS, dir, key string) []string {
+	listing := listingOf(fsys, dir)
+	listing.mu.Lock()
+	defer listing.mu.Unlock()
+	return listing.byKey[key]
+}
+
+// AddMediaName records in the listing kept by MediaNames that the file called name was
+// created in dir. Replacing a file with one of the same name changes nothing.
+func AddMediaName(dir, name string) {
+	if strings.HasSuffix(strings.ToLower(name), ".json") {
+		return
+	}
+	cached, ok := mediaListings.Load(keyOf(Local, dir))
+	if !ok {
+		return
+	}
+	listing := cached.(*mediaListing)
+	listing.mu.Lock()
+	defer listing.mu.Unlock()
+	key := LooseName(name)
+	if slices.Contains(listing.byKey[key], name) {
+		return
+	}
+	// Appending leaves the part of the slices earlier callers were given untouched.
+	listing.byKey[key] = append(listing.byKey[key], name)
+	if listing.names != nil {
+		listing.names = append(listing.names, MediaName{Name: name, Key: key})
+	}
+}
+
+// RemoveMediaName records in the listing kept by MediaNames that the file called name
+// was removed from dir, or renamed away.
+func RemoveMediaName(dir, name string) {
+	cached, ok := mediaListings.Load(keyOf(Local, dir))
+	if !ok {
+		return
+	}
+	listing := cached.(*mediaListing)
+	listing.mu.Lock()
+	defer listing.mu.Unlock()
+	key := LooseName(name)
+	names := listing.byKey[key]
+	i := slices.Index(names, name)
+	if i < 0 {
+		return
+	}
+	if len(names) == 1 {
+		delete(listing.byKey, key)
+	} else {
+		listing.byKey[key] = slices.Delete(slices.Clone(names), i, i+1)
+	}
+	listing.names = nil
+}
+
+// ForgetMediaNames drops the listing of dir kept by MediaNames, so later lookups read the
+// folder again. Callers that change dir in ways AddMediaName and RemoveMediaName can't
+// describe call it.
+func ForgetMediaNames(dir string) {
+	ForgetMediaNamesIn(Local, dir)
+}
+
+// ForgetMediaNamesIn is ForgetMediaNames for a folder on fsys.
+func ForgetMediaNamesIn(fsys FS, dir string) {
+	mediaListings.Delete(keyOf(fsys, dir))
+}
@@ -0,0 +1,169 @@
+package takeout
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// names returns the names MediaNames lists for dir, sorted.
+func names(dir string) []string {
+	var names []string
+	for _, name := range MediaNames(dir) {
+		names = append(names, name.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestMediaNamesFollowWrites(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "a.jpg.json", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := names(dir); !slices.Equal(got, []string{"a.jpg", "b.jpg"}) {
+		t.Fatalf("listed %q", got)
+	}
+
+	if err := ReplaceFile(filepath.Join(dir, "a.jpg"), []byte("edited")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceFile(filepath.Join(dir, "a.jpg.xmp"), []byte("<x/>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	RemoveMediaName(dir, "b.jpg")
+
+	want := []string{"a.jpg", "a.jpg.xmp"}
+	if got := names(dir); !slices.Equal(got, want) {
+		t.Errorf("after the writes listed %q, want %q", got, want)
+	}
+	if got := mediaNamed(Local, dir, LooseName("A.JPG.XMP")); !slices.Equal(got, []string{"a.jpg.xmp"}) {
+		t.Errorf("looked up %q, want [a.jpg.xmp]", got)
+	}
+}
+
+func TestTruncateName(t *testing.T) {
+	long := strings.Repeat("a", 60) + ".jpg"
+	exact := strings.Repeat("b", 43) + ".jpg"
+	accents := strings.Repeat("é", 50) + ".jpeg"
+	for _, test := range []struct{ name, want string }{
+		{"IMG_1234.jpg", "IMG_1234.jpg"},
+		{exact, exact},
+		{long, strings.Repeat("a", 43) + ".jpg"},
+		// The limit counts characters, not bytes, and never splits one.
+		{accents, strings.Repeat("é", 42) + ".jpeg"},
+		{strings.Repeat("日", 47), strings.Repeat("日", 47)},
+		{strings.Repeat("日", 48), strings.Repeat("日", 47)},
+		{strings.Repeat("c", 50), strings.Repeat("c", 47)},
+		// An extension as long as the limit leaves nothing to cut.
+		{"a." + strings.Repeat("x", 50), "a." + strings.Repeat("x", 50)},
+	} {
+		if got := truncateName(test.name, mediaNameLimit); got != test.want {
+			t.Errorf("truncateName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSidecarMedia(t *testing.T) {
+	for _, test := range []struct {
+		sidecar, want string
+		ok            bool
+	}{
+		{"IMG_1234.jpg.json", "IMG_1234.jpg", true},
+		{"IMG_1234.jpg(1).json", "IMG_1234(1).jpg", true},
+		{"IMG_1234.jpg(12).json", "IMG_1234(12).jpg", true},
+		{"IMG_1234.jpg.supplemental-metadata.json", "IMG_1234.jpg", true},
+		{"IMG_1234.jpg.supplemental-metadata(1).json", "IMG_1234(1).jpg", true},
+		{"IMG_1234.jpg.supplemental-metad.json", "IMG_1234.jpg", true},
+		{"IMG_1234.jpg.supplemen.json", "IMG_1234.jpg", true},
+		{"IMG_1234.jpg.suppl.json", "IMG_1234.jpg", true},
+		{"IMG_1234.jpg.s.json", "IMG_1234.jpg", true},
+		{"IMG_1234.JPG.SUPPLEMENTAL-METADATA.JSON", "IMG_1234.JPG", true},
+		// Only what is left of the suffix is cut, and only after an extension.
+		{"IMG_1234.jpg.supplemental-metadatas.json", "IMG_1234.jpg.supplemental-metadatas", true},
+		{"archive.tar.json", "archive.tar", true},
+		{"photo.s.json", "photo.s", true},
+		{"title.json", "title", true},
+		{"IMG_1234.jpg", "", false},
+		{"IMG_1234.jsonl", "", false},
+	} {
+		got, ok := SidecarMedia(test.sidecar)
+		if got != test.want || ok != test.ok {
+			t.Errorf("SidecarMedia(%q) = %q, %v, want %q, %v", test.sidecar, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestFindMedia(t *testing.T) {
+	title := "Screenshot_20230405-123456_A very long application name.png" // 58 characters
+	truncated := truncateName(title, mediaNameLimit)
+	prefix := strings.Repeat("p", minPrefix)
+
+	for _, test := range []struct {
+		name  string
+		files []string // in the folder
+		find  string
+		want  string // found, or the name itself if missing
+		how   string
+	}{
+		{name: "exact", files: []string{"IMG_1.jpg", "img_1.JPG"}, find: "IMG_1.jpg", want: "IMG_1.jpg"},
+		{name: "missing", files: []string{"IMG_2.jpg"}, find: "IMG_1.jpg", want: "IMG_1.jpg"},
+		{name: "truncated", files: []string{truncated}, find: title, want: truncated, how: resolvedTruncated},
+		{
+			name:  "truncated multibyte",
+			files: []string{strings.Repeat("ü", 43) + ".jpg"},
+			find:  strings.Repeat("ü", 50) + ".jpg",
+			want:  strings.Repeat("ü", 43) + ".jpg",
+			how:   resolvedTruncated,
+		},
+		{name: "case", files: []string{"img_1.JPG"}, find: "IMG_1.jpg", want: "img_1.JPG", how: resolvedNormalized},
+		{name: "normalization", files: []string{"Cafe\u0301.jpg"}, find: "Caf\u00e9.jpg", want: "Cafe\u0301.jpg", how: resolvedNormalized},
+		{name: "invalid characters", files: []string{"What_ a day_.jpg"}, find: `What? a day*.jpg`, want: "What_ a day_.jpg", how: resolvedNormalized},
+		{name: "more invalid characters", files: []string{"a_b_c_d_.jpg"}, find: `a<b>c:d".jpg`, want: "a_b_c_d_.jpg", how: resolvedNormalized},
+		{name: "truncated and case", files: []string{strings.ToUpper(truncated)}, find: title, want: strings.ToUpper(truncated), how: resolvedNormalized},
+		{name: "prefix", files: []string{prefix + ".png"}, find: prefix + " and more.png", want: prefix + ".png", how: resolvedPrefix},
+		{name: "prefix ignoring case", files: []string{strings.ToUpper(prefix) + ".PNG"}, find: prefix + " and more.png", want: strings.ToUpper(prefix) + ".PNG", how: resolvedPrefix},
+		{name: "prefix too short", files: []string{prefix[1:] + ".png"}, find: prefix + " and more.png", want: prefix + " and more.png"},
+		{name: "prefix of another format", files: []string{prefix + ".jpg"}, find: prefix + " and more.png", want: prefix + " and more.png"},
+		{name: "ambiguous prefix", files: []string{prefix + ".png", prefix + " a.png"}, find: prefix + " and more.png", want: prefix + " and more.png"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			touch(t, dir, test.files...)
+			path, how := findMedia(Local, dir, test.find)
+			if path != filepath.Join(dir, test.want) || how != test.how {
+				t.Errorf("findMedia(%q) = %s, %q, want %s, %q", test.find, filepath.Base(path), how, test.want, test.how)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "IMG.jpg", "IMG(1).jpg", "IMG(2).JPG", "untitled.mp4")
+
+	for _, test := range []struct {
+		sidecar, title string
+		want, how      string
+	}{
+		{sidecar: "IMG.jpg.json", title: "IMG.jpg", want: "IMG.jpg"},
+		{sidecar: "IMG.jpg(1).json", title: "IMG.jpg", want: "IMG(1).jpg", how: "numbered duplicate (1) from the sidecar's name"},
+		{sidecar: "IMG.jpg.supplemental-metadata(1).json", title: "IMG.jpg", want: "IMG(1).jpg", how: "numbered duplicate (1) from the sidecar's name"},
+		{sidecar: "IMG.jpg(2).json", title: "IMG.jpg", want: "IMG(2).JPG", how: "numbered duplicate (2) from the sidecar's name, " + resolvedNormalized},
+		{sidecar: "untitled.mp4.suppl.json", want: "untitled.mp4", how: resolvedSidecar},
+		{sidecar: "untitled.MP4.json", title: "renamed.mp4", want: "untitled.mp4", how: resolvedSidecar + ", " + resolvedNormalized},
+		{sidecar: "gone.jpg.json", title: "gone.jpg", want: "gone.jpg"},
+	} {
+		path, how := Resolve(dir, test.sidecar, &Takeout{Title: test.title})
+		if path != filepath.Join(dir, test.want) || how != test.how {
+			t.Errorf("Resolve(%s, title %q) = %s, %q, want %s, %q", test.sidecar, test.title, filepath.Base(path), how, test.want, test.how)
+		}
+	}
+}
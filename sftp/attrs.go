@@ -0,0 +1,114 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// errShortPacket means a response ended before all its fields were read.
+var errShortPacket = errors.New("sftp: response too short")
+
+// decoder reads the fields of a response, keeping the first error.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil || len(d.data) < n {
+		d.err = errShortPacket
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	return string(d.take(int(n)))
+}
+
+// attrs reads file attributes for the file called name.
+func (d *decoder) attrs(name string) *fileInfo {
+	info := &fileInfo{name: name}
+	flags := d.uint32()
+	if flags&attrSize != 0 {
+		info.size = int64(d.uint64())
+	}
+	if flags&attrUIDGID != 0 {
+		d.uint32()
+		d.uint32()
+	}
+	if flags&attrPerm != 0 {
+		info.mode = fileMode(d.uint32())
+	}
+	if flags&attrTimes != 0 {
+		d.uint32() // atime
+		info.modified = time.Unix(int64(d.uint32()), 0)
+	}
+	if flags&attrExtends != 0 {
+		for count := d.uint32(); count > 0 && d.err == nil; count-- {
+			d.string()
+			d.string()
+		}
+	}
+	return info
+}
+
+// fileMode converts the POSIX mode the server sends into an fs.FileMode.
+func fileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	switch mode & 0o170000 {
+	case 0o040000:
+		m |= fs.ModeDir
+	case 0o120000:
+		m |= fs.ModeSymlink
+	case 0o010000:
+		m |= fs.ModeNamedPipe
+	case 0o140000:
+		m |= fs.ModeSocket
+	case 0o020000:
+		m |= fs.ModeDevice | fs.ModeCharDevice
+	case 0o060000:
+		m |= fs.ModeDevice
+	}
+	return m
+}
+
+// fileInfo is the fs.FileInfo of a remote file.
+type fileInfo struct {
+	name     string
+	size     int64
+	mode     fs.FileMode
+	modified time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modified }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return nil }
+
+// sortEntries sorts directory entries by name.
+func sortEntries(entries []fs.DirEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+}
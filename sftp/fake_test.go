@@ -0,0 +1,261 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFile is a file or folder of a fakeServer.
+type fakeFile struct {
+	data     string
+	dir      bool
+	modified time.Time
+	denied   bool // requests on it are refused
+}
+
+// fakeServer is an in-process SFTP version 3 server serving files from memory, enough to
+// answer the requests the Client sends.
+type fakeServer struct {
+	files   map[string]*fakeFile
+	version uint32 // sent in the handshake, 3 unless set
+	page    int    // names per READDIR response, all of them unless set
+	chunk   int    // bytes per READ response at most, as asked unless set
+	batch   int    // requests answered together in reverse order, 1 unless set
+	hangup  string // a path whose request ends the session unanswered
+
+	mu       sync.Mutex
+	requests []request  // every request after the handshake
+	listings [][]string // the folders being listed, by directory handle
+}
+
+// request is a request a fakeServer received.
+type request struct {
+	typ     byte
+	path    string
+	offset  uint64
+	length  uint32
+	payload []byte // after the request ID
+}
+
+// connect starts the server on pipes and returns a Client of it, closed when the test ends.
+// wrap, if not nil, wraps the Client's side of the pipes.
+func (s *fakeServer) connect(t *testing.T, wrap func(r io.Reader, w io.WriteCloser) (io.Reader, io.WriteCloser)) *Client {
+	t.Helper()
+	c, err := s.dial(wrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// dial starts the server on pipes and opens a Client on it.
+func (s *fakeServer) dial(wrap func(r io.Reader, w io.WriteCloser) (io.Reader, io.WriteCloser)) (*Client, error) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.serve(serverReader, serverWriter)
+		serverWriter.Close()
+		serverReader.Close()
+		done <- err
+	}()
+	var r io.Reader = clientReader
+	var w io.WriteCloser = clientWriter
+	if wrap != nil {
+		r, w = wrap(r, w)
+	}
+	return newClient(r, w, func() error { return <-done })
+}
+
+// serve answers the requests read from r until it ends.
+func (s *fakeServer) serve(r io.Reader, w io.Writer) error {
+	typ, _, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if typ != fxpInit {
+		return errors.New("no handshake")
+	}
+	version := s.version
+	if version == 0 {
+		version = 3
+	}
+	if err := writePacket(w, fxpVersion, binary.BigEndian.AppendUint32(nil, version)); err != nil {
+		return err
+	}
+
+	batch := max(s.batch, 1)
+	var responses [][]byte
+	for {
+		typ, payload, err := readPacket(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		response, ok := s.answer(typ, payload)
+		if !ok {
+			return nil // hang up
+		}
+		if responses = append(responses, response); len(responses) < batch {
+			continue
+		}
+		for i := len(responses) - 1; i >= 0; i-- {
+			if err := writePacket(w, responses[i][0], responses[i][1:]); err != nil {
+				return err
+			}
+		}
+		responses = responses[:0]
+	}
+}
+
+// answer returns the response to a request, its type first, or false to hang up.
+func (s *fakeServer) answer(typ byte, payload []byte) ([]byte, bool) {
+	d := decoder{data: payload}
+	id := d.uint32()
+	req := request{typ: typ, payload: d.data}
+	respond := func(typ byte, fields []byte) []byte {
+		return append(binary.BigEndian.AppendUint32([]byte{typ}, id), fields...)
+	}
+	statusOf := func(code uint32, message string) []byte {
+		fields := binary.BigEndian.AppendUint32(nil, code)
+		fields = appendString(fields, message)
+		return respond(fxpStatus, appendString(fields, "en"))
+	}
+	defer func() {
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+	}()
+
+	switch typ {
+	case fxpClose:
+		d.string()
+		return statusOf(statusOK, "closed"), true
+	case fxpReaddir:
+		return s.readdir(d.string(), respond, statusOf), true
+	case fxpRead:
+		req.path = strings.TrimPrefix(d.string(), "file:")
+		req.offset, req.length = d.uint64(), d.uint32()
+		f := s.files[req.path]
+		if req.offset >= uint64(len(f.data)) {
+			return statusOf(statusEOF, "end of file"), true
+		}
+		n := int(req.length)
+		if s.chunk > 0 {
+			n = min(n, s.chunk)
+		}
+		end := min(int(req.offset)+n, len(f.data))
+		return respond(fxpData, appendString(nil, f.data[req.offset:end])), true
+	}
+
+	req.path = d.string()
+	if req.path == s.hangup {
+		return nil, false
+	}
+	f, ok := s.files[req.path]
+	switch {
+	case !ok:
+		return statusOf(statusNoSuchFile, "no such file"), true
+	case f.denied:
+		return statusOf(statusDenied, "permission denied"), true
+	}
+	switch typ {
+	case fxpLstat:
+		return respond(fxpAttrs, fakeAttrs(f)), true
+	case fxpOpen:
+		return respond(fxpHandle, appendString(nil, "file:"+req.path)), true
+	case fxpOpendir:
+		if !f.dir {
+			return statusOf(statusNoSuchFile, "not a folder"), true
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.listings = append(s.listings, append([]string{".", ".."}, s.children(req.path)...))
+		return respond(fxpHandle, appendString(nil, string(rune('0'+len(s.listings)-1)))), true
+	case fxpSetstat:
+		return statusOf(statusOK, "set"), true
+	}
+	return statusOf(4, "unsupported request"), true
+}
+
+// readdir answers a READDIR request with the next page of the listing of handle.
+func (s *fakeServer) readdir(handle string, respond func(byte, []byte) []byte, statusOf func(uint32, string) []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := int(handle[0] - '0')
+	names := s.listings[i]
+	if len(names) == 0 {
+		return statusOf(statusEOF, "end of folder")
+	}
+	n := len(names)
+	if s.page > 0 {
+		n = min(n, s.page)
+	}
+	fields := binary.BigEndian.AppendUint32(nil, uint32(n))
+	for _, name := range names[:n] {
+		f := s.files[name]
+		if f == nil {
+			f = &fakeFile{dir: true}
+		}
+		fields = appendString(fields, path.Base(name))
+		fields = appendString(fields, "drwxr-xr-x long name")
+		fields = append(fields, fakeAttrs(f)...)
+	}
+	s.listings[i] = names[n:]
+	return respond(fxpName, fields)
+}
+
+// children returns the paths of the files in the folder, sorted in reverse so that the
+// client has to sort them.
+func (s *fakeServer) children(dir string) []string {
+	var children []string
+	for name := range s.files {
+		if path.Dir(name) == dir && name != dir {
+			children = append(children, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(children)))
+	return children
+}
+
+// fakeAttrs encodes the attributes of f, with its owner and an extension for the client to
+// skip.
+func fakeAttrs(f *fakeFile) []byte {
+	mode := uint32(0o100644)
+	if f.dir {
+		mode = 0o040755
+	}
+	attrs := binary.BigEndian.AppendUint32(nil, attrSize|attrUIDGID|attrPerm|attrTimes|attrExtends)
+	attrs = binary.BigEndian.AppendUint64(attrs, uint64(len(f.data)))
+	attrs = binary.BigEndian.AppendUint32(attrs, 1000)
+	attrs = binary.BigEndian.AppendUint32(attrs, 1000)
+	attrs = binary.BigEndian.AppendUint32(attrs, mode)
+	attrs = binary.BigEndian.AppendUint32(attrs, uint32(f.modified.Unix()))
+	attrs = binary.BigEndian.AppendUint32(attrs, uint32(f.modified.Unix()))
+	attrs = binary.BigEndian.AppendUint32(attrs, 1)
+	attrs = appendString(attrs, "acl@example.com")
+	return appendString(attrs, "none")
+}
+
+// requestsOf returns the requests of the type the server received.
+func (s *fakeServer) requestsOf(typ byte) []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var of []request
+	for _, r := range s.requests {
+		if r.typ == typ {
+			of = append(of, r)
+		}
+	}
+	return of
+}
@@ -0,0 +1,421 @@
+// Package sftp is a minimal SFTP version 3 client, enough to walk a remote export, read
+// its sidecars and set the times of its media. It talks to the server through the system's
+// ssh command, so keys, agents, known hosts and ~/.ssh/config work as they do for ssh.
+package sftp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Packet types of the protocol.
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpOpen    = 3
+	fxpClose   = 4
+	fxpRead    = 5
+	fxpLstat   = 7
+	fxpSetstat = 9
+	fxpOpendir = 11
+	fxpReaddir = 12
+	fxpStatus  = 101
+	fxpHandle  = 102
+	fxpData    = 103
+	fxpName    = 104
+	fxpAttrs   = 105
+)
+
+// Flags of open requests and file attributes.
+const (
+	openRead    = 0x1
+	attrSize    = 0x1
+	attrUIDGID  = 0x2
+	attrPerm    = 0x4
+	attrTimes   = 0x8
+	attrExtends = 0x80000000
+)
+
+// readChunk is how much of a file is asked for at a time, and maxPacket the largest
+// packet accepted from the server.
+const (
+	readChunk = 32 * 1024
+	maxPacket = 256 * 1024
+)
+
+// Status codes of the protocol.
+const (
+	statusOK         = 0
+	statusEOF        = 1
+	statusNoSuchFile = 2
+	statusDenied     = 3
+)
+
+// StatusError is an error status returned by the server.
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sftp: %s (status %d)", e.Message, e.Code)
+}
+
+// Is makes missing files match fs.ErrNotExist and denied requests fs.ErrPermission.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e.Code == statusNoSuchFile
+	case fs.ErrPermission:
+		return e.Code == statusDenied
+	}
+	return false
+}
+
+// Client is a connection to an SFTP server. It is safe for concurrent use; requests from
+// several goroutines are sent without waiting for each other's responses.
+type Client struct {
+	w    io.WriteCloser
+	wait func() error // waits for the server to end once w is closed
+
+	mu      sync.Mutex // guards w, next and pending
+	next    uint32
+	pending map[uint32]chan []byte
+	err     error // why the connection ended, once it has
+}
+
+// Dial starts ssh for the host of an sftp://[user@]host[:port]/path URL and opens an SFTP
+// session on it. The ssh command can be replaced with the TAKEOUT_SSH environment variable.
+func Dial(u *url.URL) (*Client, error) {
+	if u.Scheme != "sftp" || u.Hostname() == "" {
+		return nil, fmt.Errorf("sftp: expected sftp://[user@]host[:port]/path, got %s", u.Redacted())
+	}
+	destination := u.Hostname()
+	if u.User != nil {
+		destination = u.User.Username() + "@" + destination
+	}
+	args := []string{"-s"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", destination, "sftp")
+
+	program := os.Getenv("TAKEOUT_SSH")
+	if program == "" {
+		program = "ssh"
+	}
+	cmd := exec.Command(program, args...)
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("sftp: starting %s: %w", program, err)
+	}
+	return newClient(r, w, cmd.Wait)
+}
+
+// newClient opens an SFTP session with the server reading the requests from w and writing
+// its responses to r. wait waits for the server to end once w is closed.
+func newClient(r io.Reader, w io.WriteCloser, wait func() error) (*Client, error) {
+	c := &Client{w: w, wait: wait, pending: make(map[uint32]chan []byte)}
+	reader := bufio.NewReader(r)
+	if err := c.handshake(reader); err != nil {
+		c.Close()
+		return nil, err
+	}
+	go c.receive(reader)
+	return c, nil
+}
+
+// handshake exchanges the protocol versions.
+func (c *Client) handshake(r io.Reader) error {
+	if err := writePacket(c.w, fxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return fmt.Errorf("sftp: %w", err)
+	}
+	typ, payload, err := readPacket(r)
+	if err != nil {
+		return fmt.Errorf("sftp: no SFTP server on the host: %w", err)
+	}
+	if typ != fxpVersion || len(payload) < 4 {
+		return errors.New("sftp: unexpected response to the handshake")
+	}
+	if version := binary.BigEndian.Uint32(payload); version < 3 {
+		return fmt.Errorf("sftp: server speaks version %d, 3 is needed", version)
+	}
+	return nil
+}
+
+// receive hands every response to the request waiting for it until the connection ends.
+func (c *Client) receive(r io.Reader) {
+	for {
+		typ, payload, err := readPacket(r)
+		if err == nil && len(payload) < 4 {
+			err = errors.New("short response")
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.err = fmt.Errorf("sftp: connection closed: %w", err)
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			return
+		}
+		id := binary.BigEndian.Uint32(payload)
+		c.mu.Lock()
+		ch := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- append([]byte{typ}, payload[4:]...)
+		}
+	}
+}
+
+// request sends a request and waits for its response, returned with its type first and
+// without the request ID.
+func (c *Client) request(typ byte, payload []byte) ([]byte, error) {
+	ch := make(chan []byte, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.next++
+	id := c.next
+	c.pending[id] = ch
+	err := writePacket(c.w, typ, append(binary.BigEndian.AppendUint32(nil, id), payload...))
+	if err != nil {
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+
+	response, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+	return response, nil
+}
+
+// Close ends the session and waits for ssh to exit.
+func (c *Client) Close() error {
+	c.w.Close()
+	return c.wait()
+}
+
+// remotePath turns a path built with the filepath package back into the slash-separated
+// path the server expects, so that callers on Windows may use filepath.Join on it.
+func remotePath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// status turns a status response into an error, nil for OK. Other responses than want and
+// status are a protocol error.
+func status(response []byte, want byte) error {
+	if response[0] == want && want != fxpStatus {
+		return nil
+	}
+	if response[0] != fxpStatus {
+		return fmt.Errorf("sftp: unexpected response type %d", response[0])
+	}
+	d := decoder{data: response[1:]}
+	code := d.uint32()
+	message := d.string()
+	if d.err != nil {
+		return d.err
+	}
+	if code == statusOK {
+		return nil
+	}
+	return &StatusError{Code: code, Message: message}
+}
+
+// Lstat returns the attributes of the file at name, without following symlinks.
+func (c *Client) Lstat(name string) (fs.FileInfo, error) {
+	name = remotePath(name)
+	response, err := c.request(fxpLstat, appendString(nil, name))
+	if err != nil {
+		return nil, err
+	}
+	if err := status(response, fxpAttrs); err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	d := decoder{data: response[1:]}
+	info := d.attrs(path.Base(name))
+	return info, d.err
+}
+
+// ReadDir returns the entries of the directory at name, sorted by name like os.ReadDir.
+func (c *Client) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = remotePath(name)
+	handle, err := c.open(fxpOpendir, appendString(nil, name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer c.close(handle)
+
+	var entries []fs.DirEntry
+	for {
+		response, err := c.request(fxpReaddir, appendString(nil, handle))
+		if err != nil {
+			return entries, err
+		}
+		if err := status(response, fxpName); err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && statusErr.Code == statusEOF {
+				break
+			}
+			return entries, &fs.PathError{Op: "readdir", Path: name, Err: err}
+		}
+		d := decoder{data: response[1:]}
+		for count := d.uint32(); count > 0 && d.err == nil; count-- {
+			filename := d.string()
+			d.string() // longname
+			info := d.attrs(filename)
+			if filename != "." && filename != ".." {
+				entries = append(entries, fs.FileInfoToDirEntry(info))
+			}
+		}
+		if d.err != nil {
+			return entries, d.err
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// ReadFile returns the contents of the file at name.
+func (c *Client) ReadFile(name string) ([]byte, error) {
+	name = remotePath(name)
+	payload := appendString(nil, name)
+	payload = binary.BigEndian.AppendUint32(payload, openRead)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // no attributes
+	handle, err := c.open(fxpOpen, payload)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer c.close(handle)
+
+	var data []byte
+	for {
+		request := appendString(nil, handle)
+		request = binary.BigEndian.AppendUint64(request, uint64(len(data)))
+		request = binary.BigEndian.AppendUint32(request, readChunk)
+		response, err := c.request(fxpRead, request)
+		if err != nil {
+			return nil, err
+		}
+		if err := status(response, fxpData); err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && statusErr.Code == statusEOF {
+				return data, nil
+			}
+			return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+		}
+		d := decoder{data: response[1:]}
+		chunk := d.string()
+		if d.err != nil {
+			return nil, d.err
+		}
+		if len(chunk) == 0 {
+			return data, nil
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// Chtimes sets the access and modification times of the file at name. The protocol keeps
+// times as unsigned 32-bit seconds, so times before 1970 or after 2106 can't be set.
+func (c *Client) Chtimes(name string, atime, mtime time.Time) error {
+	name = remotePath(name)
+	for _, t := range []time.Time{atime, mtime} {
+		if t.Unix() < 0 || t.Unix() > 1<<32-1 {
+			return &fs.PathError{Op: "chtimes", Path: name, Err: fmt.Errorf("sftp: can't set a time outside 1970-2106, %s", t.UTC().Format(time.RFC3339))}
+		}
+	}
+	payload := appendString(nil, name)
+	payload = binary.BigEndian.AppendUint32(payload, attrTimes)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(atime.Unix()))
+	payload = binary.BigEndian.AppendUint32(payload, uint32(mtime.Unix()))
+	response, err := c.request(fxpSetstat, payload)
+	if err != nil {
+		return err
+	}
+	if err := status(response, fxpStatus); err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	return nil
+}
+
+// open sends an open request and returns the handle.
+func (c *Client) open(typ byte, payload []byte) (string, error) {
+	response, err := c.request(typ, payload)
+	if err != nil {
+		return "", err
+	}
+	if err := status(response, fxpHandle); err != nil {
+		return "", err
+	}
+	d := decoder{data: response[1:]}
+	handle := d.string()
+	return handle, d.err
+}
+
+// close releases a handle, ignoring errors as nothing was written through it.
+func (c *Client) close(handle string) {
+	_, _ = c.request(fxpClose, appendString(nil, handle))
+}
+
+// writePacket writes a length-prefixed packet.
+func writePacket(w io.Writer, typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(make([]byte, 0, 5+len(payload)), uint32(1+len(payload)))
+	packet = append(packet, typ)
+	_, err := w.Write(append(packet, payload...))
+	return err
+}
+
+// readPacket reads a length-prefixed packet.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > maxPacket {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+// appendString appends a length-prefixed string.
+func appendString(out []byte, s string) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(s)))
+	return append(out, s...)
+}
@@ -0,0 +1,322 @@
+package sftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// modified is the modification time of the fake servers' files.
+var modified = time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+// export returns the files of a small export.
+func export() map[string]*fakeFile {
+	return map[string]*fakeFile{
+		"photos":                {dir: true, modified: modified},
+		"photos/IMG_1.jpg":      {data: "jpeg data", modified: modified},
+		"photos/IMG_1.jpg.json": {data: `{"title":"IMG_1.jpg"}`, modified: modified},
+		"photos/IMG_2.jpg":      {data: "more jpeg data", modified: modified},
+		"photos/IMG_2.jpg.json": {data: `{"title":"IMG_2.jpg"}`, modified: modified},
+		"photos/private.jpg":    {data: "secret", modified: modified, denied: true},
+		"photos/Trip":           {dir: true, modified: modified},
+		"photos/Trip/IMG_3.jpg": {data: "trip", modified: modified},
+		"photos/Trip/large.mp4": {data: strings.Repeat("0123456789", 10_000), modified: modified},
+		"photos/Trip/empty.jpg": {modified: modified},
+		"locked":                {dir: true, modified: modified, denied: true},
+		"locked/IMG_9.jpg":      {data: "locked", modified: modified},
+	}
+}
+
+func TestPacketFraming(t *testing.T) {
+	var buf bytes.Buffer
+	payloads := [][]byte{nil, []byte("a"), bytes.Repeat([]byte("x"), maxPacket-1)}
+	for i, payload := range payloads {
+		if err := writePacket(&buf, byte(i+1), payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A reader returning a byte at a time stands for a connection delivering packets in pieces.
+	r := iotest.OneByteReader(&buf)
+	for i, want := range payloads {
+		typ, payload, err := readPacket(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != byte(i+1) || !bytes.Equal(payload, want) {
+			t.Errorf("packet %d read back as type %d with %d bytes, want type %d with %d", i, typ, len(payload), i+1, len(want))
+		}
+	}
+	if _, _, err := readPacket(r); !errors.Is(err, io.EOF) {
+		t.Errorf("reading past the last packet returned %v, want io.EOF", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":     binary.BigEndian.AppendUint32(nil, 0),
+		"too large": binary.BigEndian.AppendUint32(nil, maxPacket+1),
+	} {
+		if _, _, err := readPacket(bytes.NewReader(append(data, 1))); err == nil || !strings.Contains(err.Error(), "invalid packet length") {
+			t.Errorf("%s packet returned %v, want an invalid length", name, err)
+		}
+	}
+	truncated := append(binary.BigEndian.AppendUint32(nil, 10), fxpData, 'a', 'b')
+	if _, _, err := readPacket(bytes.NewReader(truncated)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated packet returned %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	if _, err := (&fakeServer{version: 2}).dial(nil); err == nil || !strings.Contains(err.Error(), "version 2") {
+		t.Errorf("a version 2 server returned %v, want a version error", err)
+	}
+	if _, err := (&fakeServer{version: 6}).dial(nil); err != nil {
+		t.Errorf("a version 6 server returned %v, want it used as version 3", err)
+	}
+}
+
+func TestLstat(t *testing.T) {
+	s := &fakeServer{files: export()}
+	c := s.connect(t, nil)
+
+	info, err := c.Lstat("photos//Trip/../IMG_2.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "IMG_2.jpg" || info.Size() != int64(len("more jpeg data")) || info.Mode() != 0o644 || !info.ModTime().Equal(modified) {
+		t.Errorf("Lstat = %s %d %v %v", info.Name(), info.Size(), info.Mode(), info.ModTime())
+	}
+	if got := s.requestsOf(fxpLstat)[0].path; got != "photos/IMG_2.jpg" {
+		t.Errorf("asked for %q, want the cleaned path", got)
+	}
+	if info, err := c.Lstat("photos/Trip"); err != nil || !info.IsDir() || info.Mode().Perm() != 0o755 {
+		t.Errorf("Lstat of a folder = %v, %v", info, err)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	c := (&fakeServer{files: export()}).connect(t, nil)
+
+	_, err := c.Lstat("photos/missing.jpg")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file returned %v, want fs.ErrNotExist", err)
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Op != "lstat" || pathErr.Path != "photos/missing.jpg" {
+		t.Errorf("missing file returned %#v, want the path error of the lstat", err)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != statusNoSuchFile || statusErr.Message != "no such file" {
+		t.Errorf("missing file returned %v, want the server's status", err)
+	}
+
+	if _, err := c.ReadFile("photos/private.jpg"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("reading a denied file returned %v, want fs.ErrPermission", err)
+	}
+	if _, err := c.ReadDir("locked"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("listing a denied folder returned %v, want fs.ErrPermission", err)
+	}
+	if _, err := c.ReadDir("photos/IMG_1.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("listing a file returned %v, want the server's error", err)
+	}
+	if err := c.Chtimes("photos/missing.jpg", modified, modified); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("setting the times of a missing file returned %v, want fs.ErrNotExist", err)
+	}
+
+	if err := status([]byte{fxpHandle, 0, 0, 0, 1, 'h'}, fxpName); err == nil || !strings.Contains(err.Error(), "unexpected response type") {
+		t.Errorf("a response of the wrong type returned %v", err)
+	}
+	if err := status([]byte{fxpStatus, 0, 0}, fxpName); !errors.Is(err, errShortPacket) {
+		t.Errorf("a truncated status returned %v, want errShortPacket", err)
+	}
+}
+
+func TestReadDirPaging(t *testing.T) {
+	for _, page := range []int{0, 1, 2, 5} {
+		s := &fakeServer{files: export(), page: page}
+		c := s.connect(t, nil)
+
+		entries, err := c.ReadDir("photos")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		want := "IMG_1.jpg IMG_1.jpg.json IMG_2.jpg IMG_2.jpg.json Trip private.jpg"
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("page size %d listed %q, want %q", page, got, want)
+		}
+		if !entries[4].IsDir() || entries[0].IsDir() {
+			t.Errorf("page size %d lost the folder types", page)
+		}
+
+		// The six entries, "." and "..", then the end of the folder.
+		pages := 2
+		if page > 0 {
+			pages = (8+page-1)/page + 1
+		}
+		if got := len(s.requestsOf(fxpReaddir)); got != pages {
+			t.Errorf("page size %d took %d READDIR requests, want %d", page, got, pages)
+		}
+		if got := len(s.requestsOf(fxpClose)); got != 1 {
+			t.Errorf("page size %d closed %d handles, want 1", page, got)
+		}
+	}
+}
+
+func TestReadFileShortReads(t *testing.T) {
+	files := export()
+	large := files["photos/Trip/large.mp4"].data
+	for _, chunk := range []int{0, 1000, 4096} {
+		s := &fakeServer{files: files, chunk: chunk}
+		c := s.connect(t, func(r io.Reader, w io.WriteCloser) (io.Reader, io.WriteCloser) {
+			return iotest.HalfReader(r), w
+		})
+
+		data, err := c.ReadFile("photos/Trip/large.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != large {
+			t.Fatalf("chunk %d read %d bytes, want %d", chunk, len(data), len(large))
+		}
+		// Every read continues where the data of the last one ended.
+		var next uint64
+		for _, read := range s.requestsOf(fxpRead) {
+			if read.offset != next || read.length != readChunk {
+				t.Fatalf("chunk %d asked for %d bytes at %d, want %d at %d", chunk, read.length, read.offset, readChunk, next)
+			}
+			n := uint64(read.length)
+			if chunk > 0 {
+				n = min(n, uint64(chunk))
+			}
+			next = min(read.offset+n, uint64(len(large)))
+		}
+
+		if data, err := c.ReadFile("photos/Trip/empty.jpg"); err != nil || len(data) != 0 {
+			t.Errorf("empty file read as %q, %v", data, err)
+		}
+	}
+}
+
+func TestChtimes(t *testing.T) {
+	s := &fakeServer{files: export()}
+	c := s.connect(t, nil)
+	atime, mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), modified
+	if err := c.Chtimes("photos/IMG_1.jpg", atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	setstats := s.requestsOf(fxpSetstat)
+	d := decoder{data: setstats[len(setstats)-1].payload}
+	if name, flags := d.string(), d.uint32(); name != "photos/IMG_1.jpg" || flags != attrTimes {
+		t.Errorf("SETSTAT of %q with flags %#x, want only the times of photos/IMG_1.jpg", name, flags)
+	}
+	if a, m := d.uint32(), d.uint32(); int64(a) != atime.Unix() || int64(m) != mtime.Unix() || d.err != nil || len(d.data) != 0 {
+		t.Errorf("SETSTAT times %d and %d, want %d and %d", a, m, atime.Unix(), mtime.Unix())
+	}
+
+	for _, outside := range []time.Time{time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2107, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		if err := c.Chtimes("photos/IMG_1.jpg", outside, outside); err == nil || !strings.Contains(err.Error(), "outside 1970-2106") {
+			t.Errorf("setting %v returned %v, want an out of range error", outside, err)
+		}
+	}
+	if got := len(s.requestsOf(fxpSetstat)); got != len(setstats) {
+		t.Errorf("times out of range were sent to the server")
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	// The server answers eight requests at a time in reverse order, so each response has to
+	// find its request by ID.
+	files := export()
+	s := &fakeServer{files: files, batch: 8}
+	c := s.connect(t, nil)
+	names := []string{"photos/IMG_1.jpg", "photos/IMG_2.jpg", "photos/Trip/IMG_3.jpg", "photos/Trip/large.mp4"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			info, err := c.Lstat(name)
+			if err == nil && info.Size() != int64(len(files[name].data)) {
+				err = errors.New(name + " got the attributes of another file")
+			}
+			errs <- err
+		}(names[i%len(names)])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConnectionClosed(t *testing.T) {
+	c := (&fakeServer{files: export(), hangup: "photos/IMG_1.jpg"}).connect(t, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Lstat("photos/IMG_1.jpg")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "connection closed") {
+			t.Errorf("a request the server hung up on returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a request the server hung up on is still waiting")
+	}
+	if _, err := c.Lstat("photos/IMG_2.jpg"); err == nil || !strings.Contains(err.Error(), "connection closed") {
+		t.Errorf("a request after the hang up returned %v", err)
+	}
+}
+
+// failingWriter fails every write once fail is set.
+type failingWriter struct {
+	io.WriteCloser
+	mu   sync.Mutex
+	fail bool
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fail {
+		return 1, io.ErrShortWrite
+	}
+	return w.WriteCloser.Write(p)
+}
+
+func TestFailedWrite(t *testing.T) {
+	var writer *failingWriter
+	s := &fakeServer{files: export()}
+	c := s.connect(t, func(r io.Reader, w io.WriteCloser) (io.Reader, io.WriteCloser) {
+		writer = &failingWriter{WriteCloser: w}
+		return r, writer
+	})
+	writer.mu.Lock()
+	writer.fail = true
+	writer.mu.Unlock()
+
+	if _, err := c.Lstat("photos/IMG_1.jpg"); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("a request that couldn't be sent returned %v, want io.ErrShortWrite", err)
+	}
+	c.mu.Lock()
+	pending := len(c.pending)
+	c.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d requests left waiting for a response", pending)
+	}
+}
@@ -0,0 +1,120 @@
+package takeout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TempSuffix marks the temporary files written by this package, so leftovers can be
+// recognised.
+const TempSuffix = ".takeout.tmp"
+
+// TempRegistry keeps track of the temporary files CreateTemp creates, so that those a
+// crash leaves behind can be found and removed later.
+type TempRegistry interface {
+	// Register records the temporary file called name before anything is written to it.
+	Register(name string) error
+	// Unregister forgets the temporary file called name once it was committed or discarded.
+	Unregister(name string)
+}
+
+// Temps is the TempRegistry of CreateTemp, nil to keep track of nothing.
+var Temps TempRegistry
+
+// CreateTemp creates a temporary file next to path, registered with Temps. It has the
+// permissions of the file at path, or 0644 if there is none yet, rather than the 0600 of
+// os.CreateTemp. It must be finished with CommitTemp or DiscardTemp.
+func CreateTemp(path string) (*os.File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(abs), filepath.Base(abs)+".*"+TempSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if Temps != nil {
+		if err := Temps.Register(file.Name()); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, fmt.Errorf("failed to register temporary file: %w", err)
+		}
+	}
+	perm := os.FileMode(0o644)
+	if info, err := os.Stat(abs); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := file.Chmod(perm); err != nil {
+		DiscardTemp(file)
+		return nil, err
+	}
+	return file, nil
+}
+
+// unregister forgets the finished temporary file called name.
+func unregister(name string) {
+	if Temps != nil {
+		Temps.Unregister(name)
+	}
+}
+
+// CommitTemp closes the temporary file and moves it over path, recording path in the
+// listing kept by MediaNames.
+func CommitTemp(file *os.File, path string) error {
+	defer unregister(file.Name())
+	defer removeTempName(file.Name())
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	AddMediaName(filepath.Dir(path), filepath.Base(path))
+	return nil
+}
+
+// DiscardTemp closes and removes the temporary file.
+func DiscardTemp(file *os.File) {
+	defer unregister(file.Name())
+	defer removeTempName(file.Name())
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// removeTempName drops the temporary file called name from the listing kept by MediaNames,
+// should its folder have been listed while the file existed.
+func removeTempName(name string) {
+	RemoveMediaName(filepath.Dir(name), filepath.Base(name))
+}
+
+// WriteFileAtomic writes path through a temporary file, so a crash mid-write never leaves a
+// truncated file behind.
+func WriteFileAtomic(path string, write func(w io.Writer) error) error {
+	file, err := CreateTemp(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		DiscardTemp(file)
+		return err
+	}
+	return CommitTemp(file, path)
+}
+
+// ReplaceFile replaces the file at path with data through a temporary file, keeping its
+// permissions. The built-in handlers and WriteXMP write through it.
+func ReplaceFile(path string, data []byte) error {
+	file, err := CreateTemp(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		DiscardTemp(file)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return CommitTemp(file, path)
+}
@@ -0,0 +1,40 @@
+package takeout
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTempFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no permission bits")
+	}
+	dir := t.TempDir()
+	created := filepath.Join(dir, "report.json")
+	if err := WriteFileAtomic(created, func(w io.Writer) error {
+		_, err := io.WriteString(w, "{}")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	replaced := filepath.Join(dir, "private.jpg")
+	if err := os.WriteFile(replaced, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceFile(replaced, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]os.FileMode{created: 0o644, replaced: 0o600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %v, want %v", filepath.Base(path), got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package timestamps
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetCreated sets the birth time of the file with setattrlist.
+func SetCreated(path string, t time.Time) error {
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Commonattr: unix.ATTR_CMN_CRTIME}
+	ts := unix.NsecToTimespec(t.UnixNano())
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))
+	if err := unix.Setattrlist(path, &attrs, buf, 0); err != nil {
+		return fmt.Errorf("failed to set creation time: %w", err)
+	}
+	return nil
+}
+
+// CreationNotSupported reports whether err from SetCreated means the filesystem
+// doesn't keep birth times.
+func CreationNotSupported(err error) bool {
+	return errors.Is(err, ErrCreationUnsupported) || errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EINVAL)
+}
+
+// FileTimes returns the last access and birth times recorded in the file info.
+func FileTimes(info os.FileInfo) (accessed, created time.Time) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(st.Atimespec.Unix()), time.Unix(st.Birthtimespec.Unix())
+}
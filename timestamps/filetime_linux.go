@@ -0,0 +1,29 @@
+package timestamps
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// SetCreated can't set the creation time on Linux: no filesystem exposes a way
+// to change the birth time, so modification and access times are all that is set.
+func SetCreated(path string, t time.Time) error {
+	return ErrCreationUnsupported
+}
+
+// CreationNotSupported reports whether err from SetCreated means creation times can't be set.
+func CreationNotSupported(err error) bool {
+	return errors.Is(err, ErrCreationUnsupported)
+}
+
+// FileTimes returns the last access time recorded in the file info. Linux doesn't report
+// the birth time through stat, so the modification time stands in for it.
+func FileTimes(info os.FileInfo) (accessed, created time.Time) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(st.Atim.Unix()), info.ModTime()
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !darwin && !linux
+
+package timestamps
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// SetCreated can't set creation times on this platform.
+func SetCreated(path string, t time.Time) error {
+	return ErrCreationUnsupported
+}
+
+// CreationNotSupported reports whether err from SetCreated means creation times can't be set.
+func CreationNotSupported(err error) bool {
+	return errors.Is(err, ErrCreationUnsupported)
+}
+
+// FileTimes falls back to the modification time for the access and creation times.
+func FileTimes(info os.FileInfo) (accessed, created time.Time) {
+	return info.ModTime(), info.ModTime()
+}
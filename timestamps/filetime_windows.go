@@ -0,0 +1,62 @@
+package timestamps
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// timeToFiletime converts a time.Time to a Windows FILETIME structure.
+// Windows FILETIME counts 100-nanosecond intervals since January 1, 1601.
+func timeToFiletime(t time.Time) syscall.Filetime {
+	const ticksPerSecond = 10000000     // 10^7 100-ns intervals per second
+	const epochDifference = 11644473600 // seconds between 1601-01-01 and 1970-01-01
+	unixTime := t.Unix()
+	nano := t.Nanosecond()
+	total := uint64(unixTime+epochDifference)*ticksPerSecond + uint64(nano)/100
+	return syscall.Filetime{
+		LowDateTime:  uint32(total & 0xFFFFFFFF),
+		HighDateTime: uint32(total >> 32),
+	}
+}
+
+// SetCreated changes the creation date of the file using syscall.SetFileTime.
+func SetCreated(path string, t time.Time) error {
+	// Open the file with read-write access.
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	// Get the underlying Windows handle.
+	handle := syscall.Handle(file.Fd())
+	// Convert t to Windows FILETIME.
+	ft := timeToFiletime(t)
+
+	// Set the file's creation, last access, and last write times.
+	if err := syscall.SetFileTime(handle, &ft, &ft, &ft); err != nil {
+		return fmt.Errorf("failed to set creation time: %w", err)
+	}
+
+	return nil
+}
+
+// CreationNotSupported reports whether err from SetCreated means the filesystem
+// doesn't keep creation times, as some network shares answer.
+func CreationNotSupported(err error) bool {
+	return errors.Is(err, ErrCreationUnsupported) || errors.Is(err, windows.ERROR_NOT_SUPPORTED) || errors.Is(err, windows.ERROR_INVALID_FUNCTION)
+}
+
+// FileTimes returns the last access and creation times recorded in the file info.
+func FileTimes(info os.FileInfo) (accessed, created time.Time) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(0, data.LastAccessTime.Nanoseconds()), time.Unix(0, data.CreationTime.Nanoseconds())
+}
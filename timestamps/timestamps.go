@@ -0,0 +1,24 @@
+// Package timestamps sets the modification, access and creation times of files, using
+// the platform's own calls for creation times where it has them.
+package timestamps
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrCreationUnsupported means the platform or filesystem can't set creation times.
+var ErrCreationUnsupported = errors.New("creation time not supported")
+
+// Set gives the file at path t as its modification, access and creation time. Where
+// creation times can't be set, only the other two are.
+func Set(path string, t time.Time) error {
+	if err := os.Chtimes(path, t, t); err != nil {
+		return err
+	}
+	if err := SetCreated(path, t); err != nil && !CreationNotSupported(err) {
+		return err
+	}
+	return nil
+}
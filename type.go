@@ -1,5 +1,21 @@
-package main
+// Package takeout reads the JSON sidecars Google Takeout exports next to Google Photos
+// media and pairs them with the media files they describe. Its handlers write what a
+// sidecar holds back into the media: EXIF and IPTC for JPEG and TIFF files, movie headers
+// for MP4 style files and XMP sidecars for every format.
+package takeout
 
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Takeout is the metadata of a single media item, as found in its JSON sidecar.
 type Takeout struct {
 	Title                 string             `json:"title"`
 	Description           string             `json:"description"`
@@ -11,13 +27,109 @@ type Takeout struct {
 	URL                   string             `json:"url"`
 	GooglePhotosOrigin    GooglePhotosOrigin `json:"googlePhotosOrigin"`
 	PhotoLastModifiedTime Time               `json:"photoLastModifiedTime"`
+	Favorited             bool               `json:"favorited"`
+	Archived              bool               `json:"archived"`
+	Trashed               bool               `json:"trashed"`
+	InLockedFolder        bool               `json:"inLockedFolder"`
+	People                []Person           `json:"people"`
+}
+
+// Person is someone Google Photos recognized in the item and the user named.
+type Person struct {
+	Name string `json:"name"`
+}
+
+// PeopleNames returns the names of the people in the item, in sidecar order and without
+// empty or repeated names.
+func (t *Takeout) PeopleNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range t.People {
+		name := strings.TrimSpace(p.Name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Name returns the media file name from the title. Titles occasionally carry directories
+// from the original upload, so only the base name is used.
+func (t *Takeout) Name() string {
+	return path.Base(strings.ReplaceAll(t.Title, `\`, "/"))
 }
 
+// PathHint returns the directories the title carried from the original upload,
+// slash-separated, or an empty string if the title is a plain file name.
+func (t *Takeout) PathHint() string {
+	dir := path.Dir(strings.ReplaceAll(t.Title, `\`, "/"))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// States returns the state flags set on the item: "archived", "trashed" and "locked".
+func (t *Takeout) States() []string {
+	var states []string
+	if t.Archived {
+		states = append(states, "archived")
+	}
+	if t.Trashed {
+		states = append(states, "trashed")
+	}
+	if t.InLockedFolder {
+		states = append(states, "locked")
+	}
+	return states
+}
+
+// Time is a timestamp in a sidecar: Unix seconds and the same time as Google formatted it.
 type Time struct {
 	Timestamp string `json:"timestamp"`
 	Formatted string `json:"formatted"`
 }
 
+// Time parses the Unix timestamp.
+func (t Time) Time() (time.Time, error) {
+	ts, err := strconv.ParseInt(t.Timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// formattedLayouts are the layouts Google formats sidecar times with, in English and the
+// common day-first and numeric forms. Newer exports put a narrow no-break space before AM/PM.
+var formattedLayouts = []string{
+	"Jan 2, 2006, 3:04:05 PM MST",
+	"Jan 2, 2006, 3:04:05\u202fPM MST",
+	"2 Jan 2006, 15:04:05 MST",
+	"02.01.2006, 15:04:05 MST",
+	"02/01/2006, 15:04:05 MST",
+	"2006-01-02, 15:04:05 MST",
+	"2006-01-02 15:04:05 MST",
+}
+
+// FormattedTime parses the formatted time. Only times formatted in UTC, as Google writes
+// them, are accepted, since other zone abbreviations don't tell the offset.
+func (t Time) FormattedTime() (time.Time, error) {
+	for _, layout := range formattedLayouts {
+		parsed, err := time.Parse(layout, t.Formatted)
+		if err != nil {
+			continue
+		}
+		if zone, _ := parsed.Zone(); zone != "UTC" && zone != "GMT" {
+			return time.Time{}, fmt.Errorf("formatted time %q is not in UTC", t.Formatted)
+		}
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("unknown time format %q", t.Formatted)
+}
+
+// GeoData is a location in a sidecar. Google writes zeros when it has none.
 type GeoData struct {
 	Latitude      float64 `json:"latitude"`
 	Longitude     float64 `json:"longitude"`
@@ -26,10 +138,84 @@ type GeoData struct {
 	LongitudeSpan float64 `json:"longitudeSpan"`
 }
 
+// GooglePhotosOrigin records how the item got into Google Photos. Only one of the fields is set.
 type GooglePhotosOrigin struct {
-	MobileUpload MobileUpload `json:"mobileUpload"`
+	MobileUpload       MobileUpload    `json:"mobileUpload"`
+	WebUpload          json.RawMessage `json:"webUpload"`
+	FromPartnerSharing json.RawMessage `json:"fromPartnerSharing"`
+	FromSharedAlbum    json.RawMessage `json:"fromSharedAlbum"`
+	Composition        json.RawMessage `json:"composition"`
 }
 
+// Kind names the origin: "mobile", "web", "partner", "shared" or "composition",
+// or an empty string if the sidecar doesn't say.
+func (o GooglePhotosOrigin) Kind() string {
+	switch {
+	case o.FromPartnerSharing != nil:
+		return "partner"
+	case o.FromSharedAlbum != nil:
+		return "shared"
+	case o.Composition != nil:
+		return "composition"
+	case o.WebUpload != nil:
+		return "web"
+	case o.MobileUpload.DeviceType != "":
+		return "mobile"
+	}
+	return ""
+}
+
+// MobileUpload is the origin of items uploaded from a phone.
 type MobileUpload struct {
 	DeviceType string `json:"deviceType"`
 }
+
+// Album is the metadata.json Google writes into every album folder.
+type Album struct {
+	Title               string               `json:"title"`
+	Description         string               `json:"description"`
+	Access              string               `json:"access"`
+	Date                Time                 `json:"date"`
+	Location            string               `json:"location"`
+	GeoData             GeoData              `json:"geoData"`
+	SharedAlbumComments []SharedAlbumComment `json:"sharedAlbumComments"`
+}
+
+// SharedAlbumComment is a comment left on a shared album.
+type SharedAlbumComment struct {
+	Text             string `json:"text"`
+	CreationTime     Time   `json:"creationTime"`
+	ContentOwnerName string `json:"contentOwnerName"`
+}
+
+// ignoredFields are sidecar fields Google writes that the tool deliberately doesn't parse.
+var ignoredFields = []string{"appSource"}
+
+// UnknownFields returns the top-level fields of a sidecar that are neither parsed
+// into Takeout nor known to be ignored, in sorted order. Read in strict mode treats
+// them as a sign that the export's schema changed.
+func UnknownFields(data []byte) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, name := range ignoredFields {
+		known[name] = true
+	}
+	typ := reflect.TypeOf(Takeout{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+
+	var unknown []string
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
@@ -0,0 +1,69 @@
+package takeout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EditedSuffixes are the suffixes Google adds to the names of edited copies, by export
+// language.
+var EditedSuffixes = []string{
+	"-edited",     // English
+	"-bearbeitet", // German
+	"-modifié",    // French
+	"-editado",    // Spanish, Portuguese
+	"-ha editado", // Spanish
+	"-editat",     // Catalan
+	"-modificato", // Italian
+	"-bewerkt",    // Dutch
+	"-edytowane",  // Polish
+	"-編集済み",       // Japanese
+}
+
+// EditedVariants returns the edited copies of the media at imagePath in its folder, named
+// with one of suffixes, e.g. "IMG_1234-edited.jpg" for "IMG_1234.jpg" with EditedSuffixes.
+// Names are compared like LooseName.
+func EditedVariants(imagePath string, suffixes []string) []string {
+	dir, base := filepath.Split(imagePath)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	var variants []string
+	for _, suffix := range suffixes {
+		for _, name := range mediaNamed(Local, dir, LooseName(stem+suffix+ext)) {
+			variants = append(variants, filepath.Join(dir, name))
+		}
+	}
+	return variants
+}
+
+// CompanionExts are the extensions of the videos paired with motion and Live Photos.
+var CompanionExts = []string{".mp", ".mov", ".mp4"}
+
+// CompanionVideos returns the motion videos paired with the photo at imagePath in its
+// folder that have no sidecar of their own, such as IMG_1234.MP next to IMG_1234.jpg.
+// sidecarDir is the folder of the photo's sidecar, where a video's own sidecar would be.
+func CompanionVideos(sidecarDir, imagePath string) []string {
+	dir, base := filepath.Split(imagePath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	var videos []string
+	for _, ext := range CompanionExts {
+		for _, name := range mediaNamed(Local, dir, LooseName(stem+ext)) {
+			if !hasOwnSidecar(sidecarDir, name) {
+				videos = append(videos, filepath.Join(dir, name))
+			}
+		}
+	}
+	return videos
+}
+
+// hasOwnSidecar reports whether the media called name has a sidecar in dir, which gives
+// the media its own times.
+func hasOwnSidecar(dir, name string) bool {
+	for _, sidecar := range []string{name + ".json", name + ".supplemental-metadata.json"} {
+		if _, err := os.Stat(filepath.Join(dir, sidecar)); err == nil {
+			return true
+		}
+	}
+	return false
+}
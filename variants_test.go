@@ -0,0 +1,52 @@
+package takeout
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// touch creates empty files called names in dir.
+func touch(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEditedVariants(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "IMG_1.jpg", "IMG_1-edited.JPG", "IMG_1-bearbeitet.jpg", "IMG_1-edited.png", "IMG_10-edited.jpg")
+
+	var got []string
+	for _, variant := range EditedVariants(filepath.Join(dir, "IMG_1.jpg"), EditedSuffixes) {
+		got = append(got, filepath.Base(variant))
+	}
+	slices.Sort(got)
+	if want := []string{"IMG_1-bearbeitet.jpg", "IMG_1-edited.JPG"}; !slices.Equal(got, want) {
+		t.Errorf("EditedVariants = %q, want %q", got, want)
+	}
+}
+
+func TestCompanionVideos(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "IMG_1.jpg", "IMG_1.MP", "IMG_2.HEIC", "IMG_2.mov", "IMG_3.jpg", "IMG_3.mp4", "IMG_3.mp4.json", "IMG_4.jpg")
+
+	for photo, want := range map[string][]string{
+		"IMG_1.jpg":  {"IMG_1.MP"},
+		"IMG_2.HEIC": {"IMG_2.mov"},
+		"IMG_3.jpg":  nil, // the video has a sidecar of its own
+		"IMG_4.jpg":  nil,
+	} {
+		var got []string
+		for _, video := range CompanionVideos(dir, filepath.Join(dir, photo)) {
+			got = append(got, filepath.Base(video))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("CompanionVideos(%s) = %q, want %q", photo, got, want)
+		}
+	}
+}
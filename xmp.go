@@ -0,0 +1,138 @@
+package takeout
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrXMPExists means an XMP sidecar not written by this package is already next to the media.
+var ErrXMPExists = errors.New("an XMP sidecar from another program already exists")
+
+// xmpCreator marks XMP sidecars written by this package, so later runs may replace them.
+const xmpCreator = `xmp:CreatorTool="takeout"`
+
+// XMPPath returns the XMP sidecar of the media at path, e.g. "clip.mp4.xmp".
+func XMPPath(path string) string {
+	return path + ".xmp"
+}
+
+// xmpCoordinate formats a coordinate the way XMP GPS properties hold it, e.g. "35,41.2200N".
+func xmpCoordinate(coordinate float64, ref string) string {
+	d, m, s := degrees(coordinate)
+	return fmt.Sprintf("%d,%.4f%s", int(d), m+s/60, ref)
+}
+
+// XMP is what an XMP sidecar holds: the taken time if Dates is set, the location if GPS is
+// set, a rating unless it is zero, a description unless it is empty and keywords.
+type XMP struct {
+	Taken       time.Time
+	Dates       bool
+	Location    GeoData
+	GPS         bool
+	Rating      int
+	Description string
+	Keywords    []string
+}
+
+// XMPFlags returns the rating and keywords that keep the item's Google Photos flags: favorites
+// are rated 5 stars and trashed items rejected, as Lightroom and digiKam read xmp:Rating, and
+// every flag is also added as a keyword.
+func XMPFlags(meta *Takeout) (rating int, keywords []string) {
+	if meta.Favorited {
+		rating = 5
+		keywords = append(keywords, "Favorite")
+	}
+	if meta.Archived {
+		keywords = append(keywords, "Archived")
+	}
+	if meta.Trashed {
+		rating = -1
+		keywords = append(keywords, "Trash")
+	}
+	return rating, keywords
+}
+
+// Packet returns the XMP packet holding f.
+func (f XMP) Packet() string {
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n")
+	if f.Dates {
+		b.WriteString("    xmlns:photoshop=\"http://ns.adobe.com/photoshop/1.0/\"\n")
+	}
+	if f.Description != "" || len(f.Keywords) > 0 {
+		b.WriteString("    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	}
+	b.WriteString("    xmlns:exif=\"http://ns.adobe.com/exif/1.0/\"\n")
+	fmt.Fprintf(&b, "    %s", xmpCreator)
+	if f.Dates {
+		stamp := f.Taken.Format("2006-01-02T15:04:05-07:00")
+		fmt.Fprintf(&b, "\n    xmp:CreateDate=\"%s\"", stamp)
+		fmt.Fprintf(&b, "\n    photoshop:DateCreated=\"%s\"", stamp)
+		fmt.Fprintf(&b, "\n    exif:DateTimeOriginal=\"%s\"", stamp)
+	}
+	if f.Rating != 0 {
+		fmt.Fprintf(&b, "\n    xmp:Rating=\"%d\"", f.Rating)
+	}
+	if f.GPS {
+		g := f.Location
+		latRef, lonRef := hemispheres(g)
+		below := 0
+		if g.Altitude < 0 {
+			below = 1
+		}
+		b.WriteString("\n    exif:GPSVersionID=\"2.3.0.0\"")
+		fmt.Fprintf(&b, "\n    exif:GPSLatitude=\"%s\"", xmpCoordinate(g.Latitude, latRef))
+		fmt.Fprintf(&b, "\n    exif:GPSLongitude=\"%s\"", xmpCoordinate(g.Longitude, lonRef))
+		fmt.Fprintf(&b, "\n    exif:GPSAltitudeRef=\"%d\"", below)
+		fmt.Fprintf(&b, "\n    exif:GPSAltitude=\"%d/100\"", int(math.Round(math.Abs(g.Altitude)*100)))
+	}
+	if f.Description == "" && len(f.Keywords) == 0 {
+		b.WriteString("/>\n")
+	} else {
+		b.WriteString(">\n")
+		if f.Description != "" {
+			b.WriteString("   <dc:description>\n    <rdf:Alt>\n")
+			fmt.Fprintf(&b, "     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n", xmlText(f.Description))
+			b.WriteString("    </rdf:Alt>\n   </dc:description>\n")
+		}
+		if len(f.Keywords) > 0 {
+			b.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+			for _, keyword := range f.Keywords {
+				fmt.Fprintf(&b, "     <rdf:li>%s</rdf:li>\n", xmlText(keyword))
+			}
+			b.WriteString("    </rdf:Bag>\n   </dc:subject>\n")
+		}
+		b.WriteString("  </rdf:Description>\n")
+	}
+	b.WriteString(" </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>\n")
+	return b.String()
+}
+
+// xmlText escapes s for use as XML character data.
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteXMP writes the packet into the XMP sidecar of the media at path through ReplaceFile,
+// and returns the sidecar's path. A sidecar written by another program is left alone,
+// returning ErrXMPExists.
+func WriteXMP(path, packet string) (string, error) {
+	target := XMPPath(path)
+	if existing, err := os.ReadFile(target); err == nil && !bytes.Contains(existing, []byte(xmpCreator)) {
+		return target, ErrXMPExists
+	}
+
+	return target, ReplaceFile(target, []byte(packet))
+}
@@ -0,0 +1,114 @@
+package takeout
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xmpDescription is the rdf:Description of a packet, as read back by encoding/xml.
+type xmpDescription struct {
+	Attrs       []xml.Attr `xml:",any,attr"`
+	Description string     `xml:"description>Alt>li"`
+	Keywords    []string   `xml:"subject>Bag>li"`
+}
+
+// parsePacket reads the packet back and returns its description and its attributes by
+// local name.
+func parsePacket(t *testing.T, packet string) (xmpDescription, map[string]string) {
+	t.Helper()
+	var meta struct {
+		Description xmpDescription `xml:"RDF>Description"`
+	}
+	if err := xml.Unmarshal([]byte(packet), &meta); err != nil {
+		t.Fatalf("%v in packet:\n%s", err, packet)
+	}
+	attrs := make(map[string]string)
+	for _, attr := range meta.Description.Attrs {
+		attrs[attr.Name.Local] = attr.Value
+	}
+	return meta.Description, attrs
+}
+
+func TestXMPPacket(t *testing.T) {
+	taken := time.Date(2017, 7, 14, 4, 40, 0, 0, time.FixedZone("CEST", 2*3600))
+	packet := XMP{
+		Taken:       taken,
+		Dates:       true,
+		Location:    GeoData{Latitude: -33.8568, Longitude: 151.2153, Altitude: -2.5},
+		GPS:         true,
+		Rating:      5,
+		Description: `Fish & chips <"at the pier">`,
+		Keywords:    []string{"Favorite", "Zoë"},
+	}.Packet()
+
+	description, attrs := parsePacket(t, packet)
+	for name, want := range map[string]string{
+		"CreatorTool":      "takeout",
+		"CreateDate":       "2017-07-14T04:40:00+02:00",
+		"DateCreated":      "2017-07-14T04:40:00+02:00",
+		"DateTimeOriginal": "2017-07-14T04:40:00+02:00",
+		"Rating":           "5",
+		"GPSLatitude":      "33,51.4080S",
+		"GPSLongitude":     "151,12.9180E",
+		"GPSAltitudeRef":   "1",
+		"GPSAltitude":      "250/100",
+	} {
+		if got := attrs[name]; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if want := `Fish & chips <"at the pier">`; description.Description != want {
+		t.Errorf("description = %q, want %q", description.Description, want)
+	}
+	if want := []string{"Favorite", "Zoë"}; !slices.Equal(description.Keywords, want) {
+		t.Errorf("keywords = %q, want %q", description.Keywords, want)
+	}
+}
+
+func TestXMPPacketLeavesOutUnset(t *testing.T) {
+	description, attrs := parsePacket(t, XMP{Location: GeoData{Latitude: 1, Longitude: 2}}.Packet())
+	for _, name := range []string{"CreateDate", "Rating", "GPSLatitude"} {
+		if value, ok := attrs[name]; ok {
+			t.Errorf("%s = %q written without being set", name, value)
+		}
+	}
+	if description.Description != "" || len(description.Keywords) > 0 {
+		t.Errorf("captions written without being set: %+v", description)
+	}
+}
+
+func TestWriteXMP(t *testing.T) {
+	dir := t.TempDir()
+	media := filepath.Join(dir, "clip.mp4")
+	first := XMP{Rating: 5}.Packet()
+	if path, err := WriteXMP(media, first); err != nil || path != media+".xmp" {
+		t.Fatalf("WriteXMP = %s, %v", path, err)
+	}
+	// A sidecar of an earlier run is replaced.
+	second := XMP{Rating: -1}.Packet()
+	if _, err := WriteXMP(media, second); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(media + ".xmp"); err != nil || string(got) != second {
+		t.Errorf("sidecar holds %q (%v), want the second packet", got, err)
+	}
+
+	// One from another program is left alone.
+	foreign := filepath.Join(dir, "photo.jpg")
+	other := `<x:xmpmeta xmlns:x="adobe:ns:meta/" xmp:CreatorTool="Lightroom"/>`
+	if err := os.WriteFile(foreign+".xmp", []byte(other), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteXMP(foreign, first); !errors.Is(err, ErrXMPExists) {
+		t.Errorf("replacing another program's sidecar returned %v, want ErrXMPExists", err)
+	}
+	if got, _ := os.ReadFile(foreign + ".xmp"); !strings.Contains(string(got), "Lightroom") {
+		t.Error("another program's sidecar was changed")
+	}
+}